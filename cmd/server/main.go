@@ -6,29 +6,67 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
-	. "github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
-	"github.com/Roman-Samoilenko/http-load-balancer/internal/balancer"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/app"
 	"github.com/Roman-Samoilenko/http-load-balancer/internal/config"
-	"github.com/Roman-Samoilenko/http-load-balancer/internal/health"
-	"github.com/Roman-Samoilenko/http-load-balancer/internal/proxy"
-	"github.com/Roman-Samoilenko/http-load-balancer/internal/ratelimit"
 	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
 )
 
 func main() {
 	// Разбор аргументов командной строки
 	configPath := flag.String("config", "configs/config.json", "путь к конфигурационному файлу")
+	watchInterval := flag.Duration("watch-config", 0, "период проверки изменения конфигурационного файла; 0 - не отслеживать")
+	configFormat := flag.String("config-format", "", "формат конфигурационного файла: json, yaml или toml; по умолчанию - по расширению")
+	checkConfig := flag.Bool("check-config", false, "проверить конфигурационный файл и завершить работу")
+	printConfig := flag.String("print-config", "", "вывести действующую конфигурацию со значениями по умолчанию в формате json, yaml или toml и завершить работу")
+	printSources := flag.Bool("print-sources", false, "вывести значения конфигурации с их источниками и завершить работу")
+	var overrides stringList
+	flag.Var(&overrides, "set", "переопределить поле конфигурации: путь=значение, например server.port=9000; можно указать несколько раз")
 	flag.Parse()
 
+	// Значения из файла переопределяются переменными окружения LB_*, а их - флагами -set
+	src := config.Source{Path: *configPath, Format: *configFormat, Env: os.Environ(), Flags: overrides}
+
+	// Проверка конфигурации без запуска: ненулевой код возврата при ошибках
+	if *checkConfig {
+		if _, err := src.Load(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(*configPath + ": конфигурация корректна")
+		return
+	}
+
+	// Вывод действующей конфигурации
+	if *printConfig != "" || *printSources {
+		cfg, origins, err := src.LoadWithOrigins()
+		if err == nil {
+			var data []byte
+			if *printSources {
+				data, err = origins.Report(cfg)
+			} else {
+				data, err = config.Marshal(cfg, *printConfig)
+			}
+			if err == nil {
+				_, err = os.Stdout.Write(data)
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Инициализация логгера
 	log := logger.New("info")
 	log.Info("Запуск балансировщика нагрузки")
 
 	// Загрузка конфигурации
-	cfg, err := config.LoadConfig(*configPath)
+	cfg, err := src.Load()
 
 	if err != nil {
 		log.Error("Ошибка загрузки конфигурации:", err)
@@ -36,69 +74,46 @@ func main() {
 	}
 	log.Info("Конфигурация загружена успешно")
 
-	// Создание бэкендов
-	var backends []*Backend
-	for _, backendCfg := range cfg.Backends {
-		backend := &Backend{
-			URL:     backendCfg.URL,
-			Weight:  backendCfg.Weight,
-			IsAlive: true,
-		}
-		backends = append(backends, backend)
-		log.Info("Добавлен бэкенд: ", backendCfg.URL)
+	// Сборка и запуск балансировщика
+	application, err := app.New(cfg, log)
+	if err != nil {
+		log.Error("Ошибка конфигурации: ", err)
+		os.Exit(1)
 	}
-
-	// Создание балансировщика
-	var bal balancer.Balancer
-	switch cfg.BalancerType {
-	case "round-robin":
-		bal = balancer.NewRoundRobin(backends)
-		log.Info("Используется алгоритм балансировки Round-Robin")
-	case "random":
-		bal = balancer.NewRandom(backends)
-		log.Info("Используется алгоритм балансировки Random")
-	default:
-		log.Info("Используется алгоритм балансировки Round-Robin (по умолчанию)")
-		bal = balancer.NewRoundRobin(backends)
+	application.Start()
+	if *watchInterval > 0 {
+		application.WatchConfig(src, *watchInterval)
+		log.Info("Отслеживается изменение файла конфигурации ", *configPath)
 	}
 
-	// Настройка rate limiting
-	var rateLimiter *ratelimit.Manager
-	if cfg.RateLimit.Enabled {
-		rateLimiter = ratelimit.NewManager(cfg.RateLimit.DefaultCapacity, cfg.RateLimit.DefaultRate)
-		log.Info("Rate limiting включен. Стандартный лимит: ", cfg.RateLimit.DefaultRate, " запросов в секунду")
+	// SIGHUP перезагружает конфигурацию, SIGINT и SIGTERM - graceful shutdown
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		log.Info("Получен сигнал SIGHUP, выполняется перезагрузка конфигурации")
+		_ = application.ReloadFile(src)
 	}
 
-	// Настройка health checker
-	healthChecker := health.NewChecker(bal, cfg.HealthCheck.Interval, cfg.HealthCheck.Timeout, log)
-	healthChecker.Start()
-	log.Info("Запущена проверка доступности бэкендов")
-
-	// Создание прокси
-	prx := proxy.NewLoadBalancer(bal, rateLimiter, log)
-
-	// Запуск сервера
-	serverAddr := fmt.Sprintf(":%d", cfg.Server.Port)
-	server := prx.Start(serverAddr)
-	log.Info("Сервер запущен на ", serverAddr)
-
-	// Обработка сигналов для graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
 	log.Info("Получен сигнал остановки, выполняется graceful shutdown...")
 
-	// Остановка health checker
-	healthChecker.Stop()
-
-	// Graceful shutdown сервера
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-
-	if err := server.Shutdown(ctx); err != nil {
-		log.Error("Ошибка при остановке сервера:", err)
-	}
+	application.Shutdown(ctx)
 
 	log.Info("Сервер остановлен")
 }
+
+// stringList - значение флага, который можно указать несколько раз
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
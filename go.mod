@@ -1,3 +1,17 @@
 module github.com/Roman-Samoilenko/http-load-balancer
 
 go 1.22
+
+require (
+	github.com/BurntSushi/toml v1.5.0
+	github.com/alicebob/miniredis/v2 v2.30.4
+	go.etcd.io/bbolt v1.3.11
+	golang.org/x/net v0.35.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
+	github.com/yuin/gopher-lua v1.1.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+)
@@ -0,0 +1,99 @@
+package acl
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+func TestTrieLongestPrefixMatch(t *testing.T) {
+	trie := &Trie{}
+	for entry, action := range map[string]Action{
+		"10.0.0.0/8":      Deny,
+		"10.1.0.0/16":     Allow,
+		"10.1.2.3":        Deny,
+		"2001:db8::/32":   Deny,
+		"2001:db8:1::/48": Allow,
+	} {
+		prefix, err := ParsePrefix(entry)
+		if err != nil {
+			t.Fatalf("Ошибка разбора %q: %v", entry, err)
+		}
+		trie.Insert(prefix, action)
+	}
+
+	for addr, want := range map[string]Action{
+		"10.200.0.1":         Deny,
+		"10.1.9.9":           Allow,
+		"10.1.2.3":           Deny,
+		"::ffff:10.1.9.9":    Allow, // IPv4, отображенный в IPv6
+		"192.168.0.1":        None,
+		"2001:db8:ffff::1":   Deny,
+		"2001:db8:1:abcd::1": Allow,
+		"2001:db9::1":        None,
+	} {
+		if got := trie.Lookup(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("Адрес %s: ожидалось %v, получено %v", addr, want, got)
+		}
+	}
+
+	// При одинаковом префиксе запрет важнее разрешения
+	trie.Insert(netip.MustParsePrefix("192.168.0.0/24"), Deny)
+	trie.Insert(netip.MustParsePrefix("192.168.0.0/24"), Allow)
+	if got := trie.Lookup(netip.MustParseAddr("192.168.0.7")); got != Deny {
+		t.Errorf("Ожидался запрет при конфликте правил, получено %v", got)
+	}
+}
+
+func TestListReloadsFileOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.txt")
+	write := func(content string, mtime time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Явное время изменения: на быстрой файловой системе оно может совпасть
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := time.Now().Add(-time.Hour)
+	write("# заблокированные\n198.51.100.0/24\n", base)
+
+	list, err := NewList("test", Rules{Allow: []string{"198.51.100.7"}, DenyFile: path}, logger.New("error"))
+	if err != nil {
+		t.Fatalf("Ошибка загрузки списка: %v", err)
+	}
+	list.Watch(10 * time.Millisecond)
+	defer list.Stop()
+
+	addr := netip.MustParseAddr("203.0.113.5")
+	if list.Check(netip.MustParseAddr("198.51.100.1")) != Deny || list.Check(netip.MustParseAddr("198.51.100.7")) != Allow {
+		t.Fatalf("Правила из файла и конфигурации не применены")
+	}
+
+	write("203.0.113.0/24\n", base.Add(time.Minute))
+	waitFor(t, func() bool { return list.Check(addr) == Deny })
+
+	// Некорректный файл не заменяет действующий список
+	write("not-an-ip\n", base.Add(2*time.Minute))
+	time.Sleep(50 * time.Millisecond)
+	if list.Check(addr) != Deny {
+		t.Errorf("После ошибки загрузки должен действовать прежний список")
+	}
+}
+
+// waitFor ждет выполнения условия не дольше секунды
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Условие не выполнено за отведенное время")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
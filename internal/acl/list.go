@@ -0,0 +1,199 @@
+package acl
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+// Rules описывает источники правил списка доступа
+type Rules struct {
+	Allow       []string // Адреса и подсети, заданные в конфигурации
+	Deny        []string
+	AllowFile   string // Файлы с адресами и подсетями, по одному в строке
+	DenyFile    string
+	DefaultDeny bool // Запрещать адреса, не подходящие ни под одно правило
+}
+
+// Empty сообщает, что правила не заданы и список ничего не ограничивает
+func (r Rules) Empty() bool {
+	return len(r.Allow) == 0 && len(r.Deny) == 0 && r.AllowFile == "" && r.DenyFile == "" && !r.DefaultDeny
+}
+
+// List - список доступа из встроенных правил и внешних файлов.
+// При изменении файлов список пересобирается и атомарно подменяется,
+// поэтому проверки не блокируются перезагрузкой
+type List struct {
+	name   string
+	rules  Rules
+	trie   atomic.Pointer[Trie]
+	mtimes map[string]time.Time // Время изменения файлов при последней загрузке
+	logger *logger.Logger
+	stopCh chan struct{}
+	stop   sync.Once
+	wg     sync.WaitGroup
+}
+
+// NewList загружает список доступа; name используется в логах
+func NewList(name string, rules Rules, log *logger.Logger) (*List, error) {
+	l := &List{
+		name:   name,
+		rules:  rules,
+		mtimes: make(map[string]time.Time),
+		logger: log,
+		stopCh: make(chan struct{}),
+	}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Name возвращает имя списка
+func (l *List) Name() string {
+	return l.name
+}
+
+// Check возвращает действие для адреса с учетом правила по умолчанию
+func (l *List) Check(addr netip.Addr) Action {
+	action := l.trie.Load().Lookup(addr)
+	if action == None && l.rules.DefaultDeny {
+		return Deny
+	}
+	return action
+}
+
+// load собирает дерево из встроенных правил и файлов
+func (l *List) load() error {
+	trie := &Trie{}
+	sources := []struct {
+		inline []string
+		file   string
+		action Action
+	}{
+		{l.rules.Allow, l.rules.AllowFile, Allow},
+		{l.rules.Deny, l.rules.DenyFile, Deny},
+	}
+
+	mtimes := make(map[string]time.Time)
+	for _, src := range sources {
+		entries := src.inline
+		if src.file != "" {
+			info, err := os.Stat(src.file)
+			if err != nil {
+				return err
+			}
+			fileEntries, err := readEntries(src.file)
+			if err != nil {
+				return err
+			}
+			entries = append(append([]string(nil), entries...), fileEntries...)
+			mtimes[src.file] = info.ModTime()
+		}
+
+		for _, entry := range entries {
+			prefix, err := ParsePrefix(entry)
+			if err != nil {
+				return err
+			}
+			trie.Insert(prefix, src.action)
+		}
+	}
+
+	l.trie.Store(trie)
+	l.mtimes = mtimes
+	return nil
+}
+
+// readEntries читает адреса из файла; пустые строки и комментарии после # пропускаются
+func readEntries(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		entry, _, _ := strings.Cut(scanner.Text(), "#")
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if _, err := ParsePrefix(entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// changed сообщает, изменился ли какой-либо из файлов списка
+func (l *List) changed() bool {
+	for _, path := range []string{l.rules.AllowFile, l.rules.DenyFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			// Пропавший файл - тоже изменение: ошибка попадет в лог при загрузке
+			return true
+		}
+		if !info.ModTime().Equal(l.mtimes[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch периодически проверяет время изменения файлов и перезагружает
+// список. При ошибке загрузки продолжает действовать прежний список
+func (l *List) Watch(interval time.Duration) {
+	if l.rules.AllowFile == "" && l.rules.DenyFile == "" {
+		return
+	}
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		failed := false
+		for {
+			select {
+			case <-ticker.C:
+				if !l.changed() {
+					continue
+				}
+				if err := l.load(); err != nil {
+					// Ошибка логируется один раз, пока файл не будет исправлен
+					if !failed {
+						l.logger.Error("Ошибка перезагрузки списка доступа ", l.name, ": ", err)
+					}
+					failed = true
+					continue
+				}
+				failed = false
+				l.logger.Info("Список доступа ", l.name, " перезагружен")
+			case <-l.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Stop останавливает отслеживание файлов
+func (l *List) Stop() {
+	l.stop.Do(func() { close(l.stopCh) })
+	l.wg.Wait()
+}
@@ -0,0 +1,119 @@
+package acl
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Action - действие правила списка доступа
+type Action uint8
+
+const (
+	None  Action = iota // Адрес не подходит ни под одно правило
+	Allow               // Адрес разрешен
+	Deny                // Адрес запрещен
+)
+
+// String возвращает название действия для логов
+func (a Action) String() string {
+	switch a {
+	case Allow:
+		return "allow"
+	case Deny:
+		return "deny"
+	default:
+		return "none"
+	}
+}
+
+// node - узел двоичного префиксного дерева; уровень узла равен длине префикса
+type node struct {
+	children [2]*node
+	action   Action
+}
+
+// Trie - двоичное префиксное дерево для поиска правила с самым длинным
+// подходящим префиксом. Адреса IPv4 и IPv6 хранятся в отдельных деревьях,
+// поиск занимает не больше 32 или 128 шагов независимо от числа правил
+type Trie struct {
+	v4 node
+	v6 node
+}
+
+// Insert добавляет правило для префикса. Если для одного префикса заданы
+// и разрешение, и запрет, действует запрет
+func (t *Trie) Insert(prefix netip.Prefix, action Action) {
+	prefix = prefix.Masked()
+	addr := prefix.Addr()
+
+	n := t.root(addr)
+	bytes := addr.AsSlice()
+	for i := 0; i < prefix.Bits(); i++ {
+		bit := bitAt(bytes, i)
+		if n.children[bit] == nil {
+			n.children[bit] = &node{}
+		}
+		n = n.children[bit]
+	}
+	if n.action != Deny {
+		n.action = action
+	}
+}
+
+// Lookup возвращает действие правила с самым длинным префиксом,
+// содержащим адрес, или None
+func (t *Trie) Lookup(addr netip.Addr) Action {
+	addr = addr.Unmap()
+
+	n := t.root(addr)
+	result := n.action
+	bytes := addr.AsSlice()
+	for i := 0; i < len(bytes)*8; i++ {
+		n = n.children[bitAt(bytes, i)]
+		if n == nil {
+			break
+		}
+		if n.action != None {
+			result = n.action
+		}
+	}
+	return result
+}
+
+// root возвращает корень дерева для семейства адреса
+func (t *Trie) root(addr netip.Addr) *node {
+	if addr.Is4() {
+		return &t.v4
+	}
+	return &t.v6
+}
+
+// bitAt возвращает i-й бит адреса, начиная со старшего
+func bitAt(bytes []byte, i int) int {
+	return int(bytes[i/8]>>(7-i%8)) & 1
+}
+
+// ParsePrefix разбирает адрес или подсеть в нотации CIDR.
+// Одиночный адрес считается подсетью из одного адреса
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("некорректная подсеть %q: %w", s, err)
+		}
+		if prefix.Addr().Is4In6() {
+			// ::ffff:10.0.0.0/104 эквивалентна 10.0.0.0/8
+			return netip.PrefixFrom(prefix.Addr().Unmap(), max(0, prefix.Bits()-96)), nil
+		}
+		return prefix, nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("некорректный адрес %q: %w", s, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,172 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/balancer"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/ratelimit"
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+// Server - административный HTTP API балансировщика. Работает на отдельном
+// порту и требует токен в заголовке Authorization: Bearer <token>
+type Server struct {
+	token    string
+	mux      *http.ServeMux
+	policies map[string]*ratelimit.Manager // Политики rate limiting по имени
+	bans     *ratelimit.Banlist
+	balancer balancer.Balancer
+	// Бэкенды, добавленные через API и не удаленные через него
+	added map[string]bool
+	// Таймаут вывода бэкенда из пула по умолчанию
+	drainTimeout time.Duration
+	mu           sync.RWMutex // Защищает компоненты, заменяемые при перезагрузке конфигурации
+	logger       *logger.Logger
+	server       *http.Server
+}
+
+// NewServer создает admin API с заданным токеном доступа
+func NewServer(token string, log *logger.Logger) *Server {
+	s := &Server{
+		token:    token,
+		mux:      http.NewServeMux(),
+		policies: make(map[string]*ratelimit.Manager),
+		added:    make(map[string]bool),
+		logger:   log,
+	}
+
+	s.mux.HandleFunc("GET /ratelimit/policies", s.listPolicies)
+	s.mux.HandleFunc("GET /ratelimit/policies/{name}/shadow", s.shadowReport)
+	s.mux.HandleFunc("PUT /ratelimit/policies/{name}/shadow", s.setShadow)
+	s.mux.HandleFunc("GET /bans", s.listBans)
+	s.mux.HandleFunc("DELETE /bans/{id}", s.deleteBan)
+	s.mux.HandleFunc("GET /backends", s.listBackends)
+	s.mux.HandleFunc("POST /backends", s.addBackend)
+	s.mux.HandleFunc("DELETE /backends", s.removeBackend)
+	s.mux.HandleFunc("PUT /backends/weight", s.setWeight)
+	s.mux.HandleFunc("PUT /backends/mode", s.setMode)
+
+	return s
+}
+
+// AddPolicy делает политику rate limiting доступной через API
+func (s *Server) AddPolicy(name string, m *ratelimit.Manager) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policies[name] = m
+}
+
+// SetPolicies заменяет все политики rate limiting, доступные через API
+func (s *Server) SetPolicies(policies map[string]*ratelimit.Manager) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policies = policies
+}
+
+// SetBans делает блокировки клиентов доступными через API; nil отключает их
+func (s *Server) SetBans(bans *ratelimit.Banlist) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bans = bans
+}
+
+// SetBalancer делает пул бэкендов доступным для управления через API.
+// drainTimeout - сколько по умолчанию ждать завершения запросов удаляемого
+// бэкенда
+func (s *Server) SetBalancer(b balancer.Balancer, drainTimeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balancer = b
+	s.drainTimeout = drainTimeout
+}
+
+// policy возвращает политику rate limiting по имени
+func (s *Server) policy(name string) (*ratelimit.Manager, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.policies[name]
+	return m, ok
+}
+
+// banlist возвращает подключенные блокировки клиентов
+func (s *Server) banlist() *ratelimit.Banlist {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.bans
+}
+
+// pool возвращает пул бэкендов и таймаут вывода из пула
+func (s *Server) pool() (balancer.Balancer, time.Duration) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.balancer, s.drainTimeout
+}
+
+// ServeHTTP проверяет токен и передает запрос обработчику
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeError(w, http.StatusUnauthorized, "требуется токен администратора")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Start запускает admin API
+func (s *Server) Start(addr string) *http.Server {
+	s.server = &http.Server{
+		Addr:    addr,
+		Handler: s,
+	}
+
+	go func() {
+		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			s.logger.Error("Ошибка запуска admin API:", err)
+		}
+	}()
+
+	return s.server
+}
+
+// Shutdown останавливает admin API; для незапущенного API ничего не делает
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Shutdown(ctx)
+}
+
+// errorBody - тело ответа с ошибкой
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// writeJSON отвечает значением v в формате JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError отвечает ошибкой в формате JSON
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorBody{Error: message})
+}
+
+// readJSON разбирает тело запроса; при ошибке отвечает 400
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "некорректное тело запроса: "+err.Error())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,217 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/balancer"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/ratelimit"
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+const testToken = "secret"
+
+// call выполняет запрос к admin API с токеном и возвращает ответ
+func call(t *testing.T, s *Server, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	s := NewServer(testToken, logger.New("error"))
+
+	for _, header := range []string{"", "Bearer wrong", testToken} {
+		req := httptest.NewRequest(http.MethodGet, "/ratelimit/policies", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Заголовок %q: ожидался статус 401, получен %d", header, rec.Code)
+		}
+	}
+}
+
+func TestAdminShadowMode(t *testing.T) {
+	manager, err := ratelimit.NewManager(ratelimit.Policy{Capacity: 1, Rate: 0.001})
+	if err != nil {
+		t.Fatalf("Не удалось создать менеджер: %v", err)
+	}
+	defer manager.Close()
+
+	s := NewServer(testToken, logger.New("error"))
+	s.AddPolicy("login", manager)
+
+	if rec := call(t, s, http.MethodPut, "/ratelimit/policies/login/shadow", `{"enabled": true}`); rec.Code != http.StatusOK {
+		t.Fatalf("Ошибка включения теневого режима: %d %s", rec.Code, rec.Body)
+	}
+	if !manager.Shadow() {
+		t.Fatalf("Теневой режим не включен")
+	}
+	if rec := call(t, s, http.MethodPut, "/ratelimit/policies/missing/shadow", `{"enabled": true}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Для неизвестной политики ожидался 404, получен %d", rec.Code)
+	}
+
+	for i := 0; i < 3; i++ {
+		manager.Take("10.0.0.1")
+	}
+	manager.Take("10.0.0.2")
+	manager.Take("10.0.0.2")
+
+	rec := call(t, s, http.MethodGet, "/ratelimit/policies/login/shadow?top=1", "")
+	var report shadowResponse
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Некорректный ответ: %v", err)
+	}
+	if !report.Enabled || report.Rejections != 3 || report.Clients != 2 || report.WindowSeconds != 600 {
+		t.Errorf("Некорректная сводка: %+v", report)
+	}
+	if len(report.Top) != 1 || report.Top[0].ID != "10.0.0.1" || report.Top[0].Rejections != 2 {
+		t.Errorf("Неверный список нарушителей: %+v", report.Top)
+	}
+
+	rec = call(t, s, http.MethodGet, "/ratelimit/policies", "")
+	var states []policyState
+	_ = json.NewDecoder(rec.Body).Decode(&states)
+	if len(states) != 1 || states[0] != (policyState{Name: "login", Shadow: true}) {
+		t.Errorf("Неверный список политик: %+v", states)
+	}
+}
+
+func TestAdminBans(t *testing.T) {
+	bans, err := ratelimit.NewBanlist(ratelimit.BanPolicy{
+		MaxRejections: 1,
+		Window:        time.Minute,
+		Duration:      time.Minute,
+		MaxDuration:   time.Hour,
+		ForgetAfter:   time.Hour,
+	}, logger.New("error"))
+	if err != nil {
+		t.Fatalf("Не удалось создать список блокировок: %v", err)
+	}
+
+	s := NewServer(testToken, logger.New("error"))
+	s.SetBans(bans)
+
+	bans.Reject("10.0.0.1")
+	bans.Reject("10.0.0.1")
+
+	rec := call(t, s, http.MethodGet, "/bans", "")
+	var list []ratelimit.Ban
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("Некорректный ответ: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != "10.0.0.1" || list[0].Level != 1 {
+		t.Fatalf("Неверный список блокировок: %+v", list)
+	}
+
+	if rec := call(t, s, http.MethodDelete, "/bans/10.0.0.1", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("Ошибка снятия блокировки: %d %s", rec.Code, rec.Body)
+	}
+	if _, banned := bans.Banned("10.0.0.1"); banned {
+		t.Errorf("Блокировка не снята")
+	}
+	if rec := call(t, s, http.MethodDelete, "/bans/10.0.0.1", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Для незаблокированного клиента ожидался 404, получен %d", rec.Code)
+	}
+}
+
+func TestAdminBackends(t *testing.T) {
+	first := &backend.Backend{URL: "http://server1:8080", Weight: 1, IsAlive: true}
+	bal := balancer.NewRoundRobin([]*backend.Backend{first})
+
+	s := NewServer(testToken, logger.New("error"))
+	s.SetBalancer(bal, time.Minute)
+
+	if rec := call(t, s, http.MethodPost, "/backends", `{"url": "http://server2:8080", "weight": 3}`); rec.Code != http.StatusCreated {
+		t.Fatalf("Ошибка добавления бэкенда: %d %s", rec.Code, rec.Body)
+	}
+	if rec := call(t, s, http.MethodPost, "/backends", `{"url": "http://server2:8080"}`); rec.Code != http.StatusConflict {
+		t.Errorf("Для повторного бэкенда ожидался 409, получен %d", rec.Code)
+	}
+	if rec := call(t, s, http.MethodPost, "/backends", `{"url": "server3"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Для некорректного URL ожидался 400, получен %d", rec.Code)
+	}
+
+	if rec := call(t, s, http.MethodPut, "/backends/weight", `{"url": "http://server1:8080", "weight": 5}`); rec.Code != http.StatusOK {
+		t.Fatalf("Ошибка изменения веса: %d %s", rec.Code, rec.Body)
+	}
+	if first.GetWeight() != 5 {
+		t.Errorf("Вес не изменен: %d", first.GetWeight())
+	}
+
+	// Выведенный из работы бэкенд не получает новых запросов
+	if rec := call(t, s, http.MethodPut, "/backends/mode", `{"url": "http://server1:8080", "mode": "drain"}`); rec.Code != http.StatusOK {
+		t.Fatalf("Ошибка изменения режима: %d %s", rec.Code, rec.Body)
+	}
+	for i := 0; i < 4; i++ {
+		if b := bal.NextBackend(); b == nil || b.URL != "http://server2:8080" {
+			t.Fatalf("Запрос направлен на бэкенд в режиме drain: %v", b)
+		}
+	}
+	if rec := call(t, s, http.MethodPut, "/backends/mode", `{"url": "http://server1:8080", "mode": "sleep"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Для неизвестного режима ожидался 400, получен %d", rec.Code)
+	}
+
+	rec := call(t, s, http.MethodGet, "/backends", "")
+	var states []backendState
+	if err := json.NewDecoder(rec.Body).Decode(&states); err != nil {
+		t.Fatalf("Некорректный ответ: %v", err)
+	}
+	want := []backendState{
+		{URL: "http://server1:8080", Alive: true, Ready: true, Mode: backend.ModeDrain, Weight: 5, EffectiveWeight: 5},
+		{URL: "http://server2:8080", Alive: true, Ready: true, Available: true, Mode: backend.ModeAuto, Weight: 3, EffectiveWeight: 3,
+			ActiveConnections: 4},
+	}
+	if !reflect.DeepEqual(states, want) {
+		t.Errorf("Неверный список бэкендов: %+v", states)
+	}
+
+	// Бэкенд с запросами в работе удаляется после их завершения
+	rec = call(t, s, http.MethodDelete, "/backends?url=http://server2:8080", "")
+	var state backendState
+	_ = json.NewDecoder(rec.Body).Decode(&state)
+	if rec.Code != http.StatusAccepted || !state.Draining || state.DrainDeadline == nil || state.ActiveConnections != 4 {
+		t.Fatalf("Неверный ответ на вывод бэкенда: %d %+v", rec.Code, state)
+	}
+	if rec := call(t, s, http.MethodPut, "/backends/mode", `{"url": "http://server2:8080", "mode": "up"}`); rec.Code != http.StatusConflict {
+		t.Errorf("Для выводимого бэкенда ожидался 409, получен %d", rec.Code)
+	}
+	server2 := bal.Backend("http://server2:8080")
+	for i := 0; i < 4; i++ {
+		server2.DecrementConnections()
+	}
+	for deadline := time.Now().Add(2 * time.Second); bal.Backend(server2.URL) != nil; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Бэкенд не удален после завершения запросов")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rec := call(t, s, http.MethodDelete, "/backends?url=http://server2:8080", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Для удаленного бэкенда ожидался 404, получен %d", rec.Code)
+	}
+
+	if rec := call(t, s, http.MethodDelete, "/backends?url=http://server1:8080&force=true", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("Ошибка немедленного удаления бэкенда: %d %s", rec.Code, rec.Body)
+	}
+	if len(bal.Backends()) != 0 {
+		t.Errorf("Бэкенд не удален из пула")
+	}
+}
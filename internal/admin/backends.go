@@ -0,0 +1,290 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/balancer"
+)
+
+// backendState - состояние бэкенда в ответах API
+type backendState struct {
+	URL       string `json:"url"`
+	Alive     bool   `json:"alive"`     // Результат последней проверки доступности
+	Ready     bool   `json:"ready"`     // Готовность по данным источника обнаружения
+	Available bool   `json:"available"` // Получает ли новые запросы
+	Mode      string `json:"mode"`
+	Weight    int    `json:"weight"`
+	Priority  int    `json:"priority"` // Уровень приоритета; меньше - предпочтительнее
+	// Метки источника обнаружения
+	Labels map[string]string `json:"labels,omitempty"`
+	// Вес с учетом плавного старта
+	EffectiveWeight   float64 `json:"effective_weight"`
+	ActiveConnections int64   `json:"active_connections"`
+	Draining          bool    `json:"draining"` // Выводится из пула
+	// Срок удаления выводимого бэкенда; отсутствует, если срок не ограничен
+	DrainDeadline *time.Time `json:"drain_deadline,omitempty"`
+}
+
+// addBackendRequest - тело запроса на добавление бэкенда
+type addBackendRequest struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// weightRequest - тело запроса на изменение веса
+type weightRequest struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// modeRequest - тело запроса на изменение режима
+type modeRequest struct {
+	URL  string `json:"url"`
+	Mode string `json:"mode"`
+}
+
+func newBackendState(bal balancer.Balancer, b *backend.Backend) backendState {
+	state := backendState{
+		URL:               b.URL,
+		Alive:             b.Alive(),
+		Ready:             b.IsReady(),
+		Available:         b.Available(),
+		Mode:              b.GetMode(),
+		Weight:            b.GetWeight(),
+		Priority:          b.GetPriority(),
+		Labels:            b.GetLabels(),
+		EffectiveWeight:   bal.EffectiveWeight(b, time.Now()),
+		ActiveConnections: b.GetActiveConnections(),
+	}
+	var deadline time.Time
+	state.Draining, deadline = b.IsDraining()
+	if !deadline.IsZero() {
+		state.DrainDeadline = &deadline
+	}
+	return state
+}
+
+// listBackends возвращает все бэкенды пула
+func (s *Server) listBackends(w http.ResponseWriter, r *http.Request) {
+	bal, _ := s.pool()
+	if bal == nil {
+		writeJSON(w, http.StatusOK, []backendState{})
+		return
+	}
+
+	backends := bal.Backends()
+	states := make([]backendState, 0, len(backends))
+	for _, b := range backends {
+		states = append(states, newBackendState(bal, b))
+	}
+	writeJSON(w, http.StatusOK, states)
+}
+
+// addBackend добавляет бэкенд в пул
+func (s *Server) addBackend(w http.ResponseWriter, r *http.Request) {
+	bal, _ := s.requireBalancer(w)
+	if bal == nil {
+		return
+	}
+
+	var req addBackendRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if err := validateBackendURL(req.URL); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Weight < 0 {
+		writeError(w, http.StatusBadRequest, "вес не может быть отрицательным")
+		return
+	}
+
+	b := &backend.Backend{URL: req.URL, Weight: req.Weight}
+	if err := bal.AddBackend(b); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, balancer.ErrBackendExists) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err.Error()+": "+req.URL)
+		return
+	}
+
+	s.setAdded(req.URL, true)
+	s.logger.Info("Admin API: добавлен бэкенд ", req.URL)
+	writeJSON(w, http.StatusCreated, newBackendState(bal, b))
+}
+
+// removeBackend выводит бэкенд из пула: новые запросы на него не направляются,
+// а после завершения начатых или по истечении таймаута бэкенд удаляется.
+// Параметр force=true удаляет бэкенд сразу
+func (s *Server) removeBackend(w http.ResponseWriter, r *http.Request) {
+	bal, drainTimeout := s.requireBalancer(w)
+	if bal == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	backendURL := query.Get("url")
+	force, _ := strconv.ParseBool(query.Get("force"))
+	if force {
+		if !bal.RemoveBackend(backendURL) {
+			writeError(w, http.StatusNotFound, "бэкенд не найден: "+backendURL)
+			return
+		}
+		s.setAdded(backendURL, false)
+		s.logger.Info("Admin API: удален бэкенд ", backendURL)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	timeout := drainTimeout
+	if raw := query.Get("timeout"); raw != "" {
+		var err error
+		if timeout, err = time.ParseDuration(raw); err != nil {
+			writeError(w, http.StatusBadRequest, "некорректный таймаут: "+raw)
+			return
+		}
+	}
+
+	err := bal.DrainBackend(backendURL, timeout, s.logDrained)
+	switch {
+	case errors.Is(err, balancer.ErrBackendNotFound):
+		writeError(w, http.StatusNotFound, "бэкенд не найден: "+backendURL)
+		return
+	case err != nil && !errors.Is(err, balancer.ErrBackendDraining):
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	case err == nil:
+		s.logger.Info(fmt.Sprintf("Admin API: бэкенд %s выводится из пула, таймаут %v", backendURL, timeout))
+	}
+	s.setAdded(backendURL, false)
+
+	// Повторный запрос на вывод возвращает текущий прогресс
+	if b := bal.Backend(backendURL); b != nil {
+		writeJSON(w, http.StatusAccepted, newBackendState(bal, b))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setAdded отмечает бэкенд как добавленный или удаленный через API
+func (s *Server) setAdded(backendURL string, added bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if added {
+		s.added[backendURL] = true
+	} else {
+		delete(s.added, backendURL)
+	}
+}
+
+// AddedBackends возвращает URL бэкендов, добавленных через API и не
+// удаленных через него. Такие бэкенды сохраняются при перезагрузке
+// конфигурации, даже если их нет в ней
+func (s *Server) AddedBackends() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	urls := make([]string, 0, len(s.added))
+	for backendURL := range s.added {
+		urls = append(urls, backendURL)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// logDrained логирует завершение вывода бэкенда из пула
+func (s *Server) logDrained(result balancer.DrainResult) {
+	if result.Remaining > 0 {
+		s.logger.Warn(result.String())
+		return
+	}
+	s.logger.Info(result.String())
+}
+
+// setWeight изменяет вес бэкенда
+func (s *Server) setWeight(w http.ResponseWriter, r *http.Request) {
+	bal, _ := s.requireBalancer(w)
+	if bal == nil {
+		return
+	}
+
+	var req weightRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Weight < 0 {
+		writeError(w, http.StatusBadRequest, "вес не может быть отрицательным")
+		return
+	}
+
+	b := bal.Backend(req.URL)
+	if b == nil {
+		writeError(w, http.StatusNotFound, "бэкенд не найден: "+req.URL)
+		return
+	}
+	b.SetWeight(req.Weight)
+
+	s.logger.Info(fmt.Sprintf("Admin API: вес бэкенда %s изменен на %d", req.URL, req.Weight))
+	writeJSON(w, http.StatusOK, newBackendState(bal, b))
+}
+
+// setMode принудительно включает, выключает или выводит бэкенд из работы,
+// либо возвращает управление health check (режим auto)
+func (s *Server) setMode(w http.ResponseWriter, r *http.Request) {
+	bal, _ := s.requireBalancer(w)
+	if bal == nil {
+		return
+	}
+
+	var req modeRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	b := bal.Backend(req.URL)
+	if b == nil {
+		writeError(w, http.StatusNotFound, "бэкенд не найден: "+req.URL)
+		return
+	}
+	if draining, _ := b.IsDraining(); draining {
+		writeError(w, http.StatusConflict, balancer.ErrBackendDraining.Error()+": "+req.URL)
+		return
+	}
+	if err := b.SetMode(req.Mode); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.logger.Info(fmt.Sprintf("Admin API: бэкенд %s переведен в режим %s", req.URL, req.Mode))
+	writeJSON(w, http.StatusOK, newBackendState(bal, b))
+}
+
+// requireBalancer возвращает пул бэкендов и таймаут вывода из пула
+// или отвечает 404, если управление бэкендами не подключено
+func (s *Server) requireBalancer(w http.ResponseWriter) (balancer.Balancer, time.Duration) {
+	bal, drainTimeout := s.pool()
+	if bal == nil {
+		writeError(w, http.StatusNotFound, "управление бэкендами отключено")
+	}
+	return bal, drainTimeout
+}
+
+// validateBackendURL проверяет, что URL бэкенда абсолютный и использует HTTP
+func validateBackendURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("некорректный URL бэкенда: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("URL бэкенда должен быть вида http://host:port, получено %q", raw)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/ratelimit"
+)
+
+// defaultTop - число нарушителей в сводке теневого режима по умолчанию
+const defaultTop = 10
+
+// policyState - состояние политики rate limiting
+type policyState struct {
+	Name   string `json:"name"`
+	Shadow bool   `json:"shadow"`
+}
+
+// shadowRequest - тело запроса переключения теневого режима
+type shadowRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// shadowResponse - сводка теневого режима политики
+type shadowResponse struct {
+	Name          string `json:"name"`
+	WindowSeconds int    `json:"window_seconds"`
+	ratelimit.ShadowReport
+}
+
+// listPolicies возвращает политики rate limiting и их режим
+func (s *Server) listPolicies(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	states := make([]policyState, 0, len(s.policies))
+	for name, m := range s.policies {
+		states = append(states, policyState{Name: name, Shadow: m.Shadow()})
+	}
+	s.mu.RUnlock()
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+
+	writeJSON(w, http.StatusOK, states)
+}
+
+// setShadow включает или выключает теневой режим политики
+func (s *Server) setShadow(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	m, ok := s.policy(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "политика не найдена: "+name)
+		return
+	}
+
+	var req shadowRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	m.SetShadow(req.Enabled)
+	s.logger.Info(fmt.Sprintf("Admin API: теневой режим политики %s: %v", name, req.Enabled))
+
+	writeJSON(w, http.StatusOK, policyState{Name: name, Shadow: req.Enabled})
+}
+
+// shadowReport возвращает сводку отказов теневого режима;
+// параметр top ограничивает число клиентов в списке нарушителей
+func (s *Server) shadowReport(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	m, ok := s.policy(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "политика не найдена: "+name)
+		return
+	}
+
+	top := defaultTop
+	if value := r.URL.Query().Get("top"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "некорректное значение top: "+value)
+			return
+		}
+		top = n
+	}
+
+	report := m.ShadowReport(top)
+	writeJSON(w, http.StatusOK, shadowResponse{
+		Name:          name,
+		WindowSeconds: int(report.Window.Seconds()),
+		ShadowReport:  report,
+	})
+}
+
+// listBans возвращает действующие блокировки клиентов
+func (s *Server) listBans(w http.ResponseWriter, r *http.Request) {
+	bans := s.banlist()
+	if bans == nil {
+		writeJSON(w, http.StatusOK, []ratelimit.Ban{})
+		return
+	}
+	writeJSON(w, http.StatusOK, bans.List())
+}
+
+// deleteBan снимает блокировку клиента
+func (s *Server) deleteBan(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	bans := s.banlist()
+	if bans == nil {
+		writeError(w, http.StatusNotFound, "блокировки клиентов отключены")
+		return
+	}
+
+	found, err := bans.Unban(id)
+	if err != nil {
+		s.logger.Error("Ошибка снятия блокировки клиента ", id, ": ", err)
+		writeError(w, http.StatusInternalServerError, "ошибка снятия блокировки: "+err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "клиент не заблокирован: "+id)
+		return
+	}
+
+	s.logger.Info("Admin API: снята блокировка клиента ", id)
+	w.WriteHeader(http.StatusNoContent)
+}
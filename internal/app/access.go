@@ -0,0 +1,78 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/acl"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/config"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/proxy"
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+// accessLists - списки доступа, собранные по секции access конфигурации
+type accessLists struct {
+	global *acl.List // nil - глобальный список не задан
+	rules  []*proxy.AccessRule
+	lists  []*acl.List // Все списки, файлы которых отслеживаются
+}
+
+// newAccessLists загружает списки доступа и запускает отслеживание их файлов.
+// При ошибке уже запущенные списки останавливаются
+func newAccessLists(cfg config.AccessConfig, log *logger.Logger) (a *accessLists, err error) {
+	a = &accessLists{}
+	defer func() {
+		if err != nil {
+			a.stop()
+		}
+	}()
+
+	reloadInterval := cfg.ReloadInterval.Duration()
+	if rules := accessRules(cfg.AccessListConfig); !rules.Empty() {
+		list, err := acl.NewList("global", rules, log)
+		if err != nil {
+			return a, fmt.Errorf("ошибка загрузки глобального списка доступа: %w", err)
+		}
+		list.Watch(reloadInterval)
+		a.lists = append(a.lists, list)
+		a.global = list
+		log.Info("Глобальный список доступа загружен")
+	}
+	for _, routeCfg := range cfg.Routes {
+		list, err := acl.NewList(routeCfg.Name, accessRules(routeCfg.AccessListConfig), log)
+		if err != nil {
+			return a, fmt.Errorf("ошибка загрузки списка доступа %s: %w", routeCfg.Name, err)
+		}
+		list.Watch(reloadInterval)
+		a.lists = append(a.lists, list)
+		a.rules = append(a.rules, &proxy.AccessRule{
+			RouteMatcher: proxy.RouteMatcher{
+				Path:    routeCfg.Path,
+				Methods: routeCfg.Methods,
+				Host:    routeCfg.Host,
+			},
+			Name: routeCfg.Name,
+			List: list,
+		})
+		log.Info("Список доступа для маршрута ", routeCfg.Name, ": ", routeCfg.Path)
+	}
+
+	return a, nil
+}
+
+// stop останавливает отслеживание файлов всех списков
+func (a *accessLists) stop() {
+	for _, list := range a.lists {
+		list.Stop()
+	}
+}
+
+// accessRules переводит настройки списка доступа в правила
+func accessRules(cfg config.AccessListConfig) acl.Rules {
+	return acl.Rules{
+		Allow:       cfg.Allow,
+		Deny:        cfg.Deny,
+		AllowFile:   cfg.AllowFile,
+		DenyFile:    cfg.DenyFile,
+		DefaultDeny: cfg.DefaultDeny,
+	}
+}
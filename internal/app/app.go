@@ -0,0 +1,380 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/admin"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/balancer"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/config"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/discovery"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/health"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/proxy"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/ratelimit"
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+// App связывает компоненты балансировщика, собранные по конфигурации,
+// и применяет новую конфигурацию без перезапуска и разрыва соединений
+type App struct {
+	cfg      *config.Config
+	balancer balancer.Balancer
+	health   *health.Checker
+	limits   *limits // nil - rate limiting выключен
+	access   *accessLists
+	// Источники обнаружения бэкендов и найденные ими бэкенды по источникам
+	discovery  *discoveries
+	discovered map[string][]discovery.Target
+	updates    chan discoveryUpdate
+	store      *ratelimit.BoltStore // Хранилище rate limiting; nil - не используется
+	handler    atomic.Pointer[proxy.LoadBalancer]
+	admin      *admin.Server
+	server     *http.Server
+	logger     *logger.Logger
+	mu         sync.Mutex // Сериализует перезагрузки и остановку
+	stopCh     chan struct{}
+	stop       sync.Once
+	wg         sync.WaitGroup
+}
+
+// New собирает балансировщик по конфигурации
+func New(cfg *config.Config, log *logger.Logger) (a *App, err error) {
+	a = &App{
+		cfg:        cfg,
+		logger:     log,
+		stopCh:     make(chan struct{}),
+		discovered: make(map[string][]discovery.Target),
+		updates:    make(chan discoveryUpdate),
+	}
+	defer func() {
+		if err != nil {
+			a.release()
+		}
+	}()
+
+	if a.balancer, err = newBalancer(cfg, newBackends(cfg.Backends, log), log); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimit.Enabled {
+		if a.store, err = openStore(cfg.RateLimit.Store); err != nil {
+			return nil, err
+		}
+		if a.limits, err = newLimits(cfg.RateLimit, a.store, log); err != nil {
+			return nil, err
+		}
+	}
+	if a.access, err = newAccessLists(cfg.Access, log); err != nil {
+		return nil, err
+	}
+	if cfg.Admin.Enabled {
+		a.admin = admin.NewServer(cfg.Admin.Token, log)
+	}
+
+	a.health = health.NewChecker(a.balancer, cfg.HealthCheck.Interval.Duration(), cfg.HealthCheck.Timeout.Duration(), log)
+	a.apply()
+
+	a.discovery = startDiscovery(newProviders(cfg.Discovery, log), a.updates)
+	a.watchDiscovery()
+	return a, nil
+}
+
+// ServeHTTP передает запрос обработчику текущей конфигурации. Запросы,
+// начатые до перезагрузки, завершаются прежним обработчиком
+func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.handler.Load().ServeHTTP(w, r)
+}
+
+// Start запускает проверку доступности бэкендов, сервер и admin API
+func (a *App) Start() {
+	a.health.Start()
+	a.logger.Info("Запущена проверка доступности бэкендов")
+
+	if a.admin != nil {
+		adminAddr := fmt.Sprintf(":%d", a.cfg.Admin.Port)
+		a.admin.Start(adminAddr)
+		a.logger.Info("Admin API запущен на ", adminAddr)
+	}
+
+	serverAddr := fmt.Sprintf(":%d", a.cfg.Server.Port)
+	a.server = &http.Server{
+		Addr:    serverAddr,
+		Handler: a,
+	}
+	go func() {
+		if err := a.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			a.logger.Error("Ошибка запуска сервера:", err)
+		}
+	}()
+	a.logger.Info("Сервер запущен на ", serverAddr)
+}
+
+// Reload применяет новую конфигурацию. Сначала собираются все изменившиеся
+// компоненты; если конфигурация некорректна, продолжает действовать прежняя.
+// Затем обработка запросов атомарно переключается на новые компоненты,
+// пул бэкендов приводится к конфигурации, проверка доступности
+// перезапускается, а замененные компоненты останавливаются
+func (a *App) Reload(cfg *config.Config) (err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	old := a.cfg
+	if cfg.Server.Port != old.Server.Port || cfg.Admin != old.Admin {
+		a.logger.Warn("Порт сервера и настройки admin API применяются только после перезапуска")
+		cfg.Server.Port, cfg.Admin = old.Server.Port, old.Admin
+	}
+
+	// Сборка новых компонентов; при ошибке собранные останавливаются
+	lim, store := a.limits, a.store
+	rebuildLimits := !reflect.DeepEqual(cfg.RateLimit, old.RateLimit)
+	var openedStore *ratelimit.BoltStore
+	var newLim *limits
+	defer func() {
+		if err == nil {
+			return
+		}
+		if newLim != nil {
+			_ = newLim.close()
+		}
+		if openedStore != nil {
+			_ = openedStore.Close()
+		}
+	}()
+	if rebuildLimits {
+		lim, store = nil, nil
+		if cfg.RateLimit.Enabled {
+			store = a.store
+			if cfg.RateLimit.Store.Path != old.RateLimit.Store.Path || !old.RateLimit.Enabled {
+				if openedStore, err = openStore(cfg.RateLimit.Store); err != nil {
+					return err
+				}
+				store = openedStore
+			}
+			if newLim, err = newLimits(cfg.RateLimit, store, a.logger); err != nil {
+				return err
+			}
+			lim = newLim
+		}
+	}
+
+	access := a.access
+	rebuildAccess := !reflect.DeepEqual(cfg.Access, old.Access)
+	if rebuildAccess {
+		if access, err = newAccessLists(cfg.Access, a.logger); err != nil {
+			return err
+		}
+	}
+
+	// Бэкенды источников, оставшихся в конфигурации, сохраняются
+	// до первого списка от перезапущенного источника
+	discovered := a.discovered
+	rebuildDiscovery := !reflect.DeepEqual(cfg.Discovery, old.Discovery)
+	var providers []discovery.Provider
+	if rebuildDiscovery {
+		providers = newProviders(cfg.Discovery, a.logger)
+		discovered = make(map[string][]discovery.Target)
+		for _, p := range providers {
+			if targets, ok := a.discovered[p.Name()]; ok {
+				discovered[p.Name()] = targets
+			}
+		}
+	}
+
+	bal, err := a.rebalance(cfg, discovered)
+	if err != nil {
+		if rebuildAccess {
+			access.stop()
+		}
+		return err
+	}
+
+	// Переключение на новые компоненты
+	oldLimits, oldAccess, oldStore := a.limits, a.access, a.store
+	if newLim != nil && oldLimits != nil {
+		newLim.inherit(oldLimits)
+	}
+	a.cfg, a.balancer, a.limits, a.access, a.store = cfg, bal, lim, access, store
+	a.discovered = discovered
+	a.apply()
+	if rebuildDiscovery {
+		a.discovery.stop()
+		a.discovery = startDiscovery(providers, a.updates)
+	}
+
+	a.health.Stop()
+	a.health = health.NewChecker(bal, cfg.HealthCheck.Interval.Duration(), cfg.HealthCheck.Timeout.Duration(), a.logger)
+	a.health.Start()
+
+	// Остановка замененных компонентов; запросы, начатые до переключения,
+	// дообрабатываются с ними
+	if rebuildLimits && oldLimits != nil {
+		if err := oldLimits.close(); err != nil {
+			a.logger.Error("Ошибка при сохранении состояний клиентов:", err)
+		}
+	}
+	if oldStore != nil && oldStore != store {
+		if err := oldStore.Close(); err != nil {
+			a.logger.Error("Ошибка закрытия хранилища клиентов:", err)
+		}
+	}
+	if rebuildAccess {
+		oldAccess.stop()
+	}
+
+	a.logger.Info("Конфигурация перезагружена")
+	return nil
+}
+
+// ReloadFile загружает конфигурацию из файла и применяет ее.
+// Ошибка логируется, прежняя конфигурация продолжает действовать
+func (a *App) ReloadFile(src config.Source) error {
+	cfg, err := src.Load()
+	if err == nil {
+		err = a.Reload(cfg)
+	}
+	if err != nil {
+		a.logger.Error("Конфигурация не перезагружена, продолжает действовать прежняя: ", err)
+	}
+	return err
+}
+
+// WatchConfig периодически проверяет время изменения файла конфигурации
+// и перезагружает ее при изменении
+func (a *App) WatchConfig(src config.Source, interval time.Duration) {
+	var mtime time.Time
+	if info, err := os.Stat(src.Path); err == nil {
+		mtime = info.ModTime()
+	}
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				info, err := os.Stat(src.Path)
+				if err != nil || info.ModTime().Equal(mtime) {
+					continue
+				}
+				mtime = info.ModTime()
+				a.logger.Info("Файл конфигурации изменен, выполняется перезагрузка")
+				_ = a.ReloadFile(src)
+			case <-a.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown останавливает отслеживание конфигурации и проверки, дожидается
+// завершения запросов и сохраняет состояния клиентов
+func (a *App) Shutdown(ctx context.Context) {
+	a.stop.Do(func() { close(a.stopCh) })
+	a.wg.Wait()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.health.Stop()
+	a.access.stop()
+
+	if a.server != nil {
+		if err := a.server.Shutdown(ctx); err != nil {
+			a.logger.Error("Ошибка при остановке сервера:", err)
+		}
+	}
+	if a.admin != nil {
+		if err := a.admin.Shutdown(ctx); err != nil {
+			a.logger.Error("Ошибка при остановке admin API:", err)
+		}
+	}
+
+	a.release()
+}
+
+// release останавливает обнаружение бэкендов и rate limiting, закрывает
+// хранилище и останавливает отслеживание списков доступа
+func (a *App) release() {
+	if a.discovery != nil {
+		a.discovery.stop()
+	}
+	if a.limits != nil {
+		if err := a.limits.close(); err != nil {
+			a.logger.Error("Ошибка при сохранении состояний клиентов:", err)
+		}
+	}
+	if a.store != nil {
+		if err := a.store.Close(); err != nil {
+			a.logger.Error("Ошибка закрытия хранилища клиентов:", err)
+		}
+	}
+	if a.access != nil {
+		a.access.stop()
+	}
+}
+
+// apply переключает обработку запросов и admin API на текущие компоненты
+func (a *App) apply() {
+	var manager *ratelimit.Manager
+	if a.limits != nil {
+		manager = a.limits.manager
+	}
+
+	prx := proxy.NewLoadBalancer(a.balancer, manager, a.logger)
+	prx.SetRateLimitFormat(a.cfg.RateLimit.ResponseFormat)
+	prx.SetConcurrencyStatus(a.cfg.RateLimit.Concurrency.Status)
+	policies := make(map[string]*ratelimit.Manager)
+	var bans *ratelimit.Banlist
+	if a.limits != nil {
+		for _, route := range a.limits.routes {
+			prx.AddRoutePolicy(route)
+		}
+		if a.limits.bans != nil {
+			bans = a.limits.bans
+			prx.SetBans(bans)
+		}
+		policies = a.limits.policies()
+	}
+	if a.access.global != nil {
+		prx.SetAccessList(a.access.global, a.cfg.Access.BypassRateLimit)
+	}
+	for _, rule := range a.access.rules {
+		prx.AddAccessRule(rule)
+	}
+	a.handler.Store(prx)
+
+	if a.admin != nil {
+		a.admin.SetBalancer(a.balancer, a.cfg.DrainTimeout.Duration())
+		a.admin.SetPolicies(policies)
+		a.admin.SetBans(bans)
+	}
+}
+
+// openStore открывает хранилище rate limiting, если задан путь к нему
+func openStore(cfg config.StoreConfig) (*ratelimit.BoltStore, error) {
+	if cfg.Path == "" {
+		return nil, nil
+	}
+	store, err := ratelimit.OpenBoltStore(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка открытия хранилища клиентов: %w", err)
+	}
+	return store, nil
+}
+
+// shared оборачивает хранилище приложения для менеджеров rate limiting
+func shared(store *ratelimit.BoltStore) ratelimit.Store {
+	if store == nil {
+		return nil
+	}
+	return sharedStore{store}
+}
@@ -0,0 +1,284 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/balancer"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/config"
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+// newTestBackend запускает бэкенд, отвечающий своим именем
+func newTestBackend(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, name)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// writeConfig записывает конфигурацию во временный файл
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Не удалось записать конфигурацию: %v", err)
+	}
+}
+
+// newTestApp собирает приложение по файлу конфигурации
+func newTestApp(t *testing.T, path string) *App {
+	t.Helper()
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Некорректная конфигурация: %v", err)
+	}
+	a, err := New(cfg, logger.New("error"))
+	if err != nil {
+		t.Fatalf("Не удалось собрать приложение: %v", err)
+	}
+	t.Cleanup(func() { a.Shutdown(context.Background()) })
+	return a
+}
+
+// get выполняет запрос к приложению и возвращает статус и тело ответа
+func get(a *App) (int, string) {
+	return getFrom(a, "10.0.0.1")
+}
+
+// getFrom выполняет запрос клиента с адресом ip
+func getFrom(a *App, ip string) (int, string) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = ip + ":1234"
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.String()
+}
+
+func TestReloadBackends(t *testing.T) {
+	first := newTestBackend(t, "first")
+	second := newTestBackend(t, "second")
+	third := newTestBackend(t, "third")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfig(t, path, fmt.Sprintf(`{
+		"balancer_type": "round-robin",
+		"backends": [{"url": %q}, {"url": %q}]
+	}`, first.URL, second.URL))
+	a := newTestApp(t, path)
+	oldBalancer := a.balancer
+
+	writeConfig(t, path, fmt.Sprintf(`{
+		"balancer_type": "weighted-round-robin",
+		"backends": [{"url": %q, "weight": 2}, {"url": %q}]
+	}`, second.URL, third.URL))
+	if err := a.ReloadFile(config.Source{Path: path}); err != nil {
+		t.Fatalf("Ошибка перезагрузки: %v", err)
+	}
+
+	if _, ok := a.balancer.(*balancer.WeightedRoundRobin); !ok {
+		t.Fatalf("Алгоритм балансировки не заменен: %T", a.balancer)
+	}
+	// Оставшийся бэкенд переносится в новый пул с прежним состоянием
+	kept := a.balancer.Backend(second.URL)
+	if kept == nil || kept != oldBalancer.Backend(second.URL) || kept.GetWeight() != 2 {
+		t.Errorf("Бэкенд %s не перенесен в новый пул с новым весом", second.URL)
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 30; i++ {
+		status, body := get(a)
+		if status != http.StatusOK {
+			t.Fatalf("Неожиданный статус %d: %s", status, body)
+		}
+		counts[body]++
+	}
+	if counts["first"] != 0 || counts["second"] != 20 || counts["third"] != 10 {
+		t.Errorf("Неверное распределение запросов после перезагрузки: %v", counts)
+	}
+
+	// Исключенный бэкенд без запросов в работе удаляется из старого пула
+	for deadline := time.Now().Add(2 * time.Second); oldBalancer.Backend(first.URL) != nil; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Исключенный бэкенд не выведен из пула")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReloadRestoresDrainingBackend(t *testing.T) {
+	first := newTestBackend(t, "first")
+	second := newTestBackend(t, "second")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	both := fmt.Sprintf(`{
+		"drain_timeout": "200ms",
+		"backends": [{"url": %q}, {"url": %q, "weight": 3}]
+	}`, first.URL, second.URL)
+	writeConfig(t, path, both)
+	a := newTestApp(t, path)
+
+	// Запрос в работе не дает выводу завершиться сразу
+	b := a.balancer.Backend(second.URL)
+	b.IncrementConnections()
+
+	writeConfig(t, path, fmt.Sprintf(`{"drain_timeout": "200ms", "backends": [{"url": %q}]}`, first.URL))
+	if err := a.ReloadFile(config.Source{Path: path}); err != nil {
+		t.Fatalf("Ошибка перезагрузки: %v", err)
+	}
+	if draining, _ := b.IsDraining(); !draining {
+		t.Fatalf("Исключенный бэкенд не выводится из пула")
+	}
+
+	// Бэкенд возвращен в конфигурацию до окончания вывода
+	writeConfig(t, path, both)
+	if err := a.ReloadFile(config.Source{Path: path}); err != nil {
+		t.Fatalf("Ошибка перезагрузки: %v", err)
+	}
+	b.DecrementConnections()
+	time.Sleep(400 * time.Millisecond)
+
+	if a.balancer.Backend(second.URL) != b {
+		t.Fatalf("Возвращенный в конфигурацию бэкенд удален по окончании вывода")
+	}
+	if draining, _ := b.IsDraining(); draining || !b.Available() || b.GetWeight() != 3 {
+		t.Errorf("Бэкенд не восстановлен: draining %v, available %v, вес %d", draining, b.Available(), b.GetWeight())
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 10; i++ {
+		_, body := get(a)
+		counts[body]++
+	}
+	if counts["second"] == 0 {
+		t.Errorf("Запросы не направляются на восстановленный бэкенд: %v", counts)
+	}
+}
+
+func TestReloadKeepsAdminBackends(t *testing.T) {
+	first := newTestBackend(t, "first")
+	added := newTestBackend(t, "added")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	cfg := fmt.Sprintf(`{
+		"admin": {"enabled": true, "token": "secret"},
+		"backends": [{"url": %q}]
+	}`, first.URL)
+	writeConfig(t, path, cfg)
+	a := newTestApp(t, path)
+
+	admin := func(method, target, body string) int {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		a.admin.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if status := admin(http.MethodPost, "/backends", fmt.Sprintf(`{"url": %q, "weight": 1}`, added.URL)); status != http.StatusCreated {
+		t.Fatalf("Бэкенд не добавлен через admin API: %d", status)
+	}
+
+	// Перезагрузка не выводит из пула бэкенд, добавленный через admin API
+	if err := a.ReloadFile(config.Source{Path: path}); err != nil {
+		t.Fatalf("Ошибка перезагрузки: %v", err)
+	}
+	b := a.balancer.Backend(added.URL)
+	if b == nil {
+		t.Fatalf("Бэкенд, добавленный через admin API, удален при перезагрузке")
+	}
+	if draining, _ := b.IsDraining(); draining {
+		t.Fatalf("Бэкенд, добавленный через admin API, выводится при перезагрузке")
+	}
+
+	// Удаленный через admin API бэкенд больше не сохраняется
+	if status := admin(http.MethodDelete, "/backends?force=true&url="+added.URL, ""); status != http.StatusNoContent {
+		t.Fatalf("Бэкенд не удален через admin API: %d", status)
+	}
+	if got := a.admin.AddedBackends(); len(got) != 0 {
+		t.Errorf("Удаленный бэкенд остался в списке добавленных: %v", got)
+	}
+}
+
+func TestReloadRateLimits(t *testing.T) {
+	backend := newTestBackend(t, "backend")
+	path := filepath.Join(t.TempDir(), "config.json")
+	limited := func(capacity int, algorithm string) string {
+		return fmt.Sprintf(`{
+			"backends": [{"url": %q}],
+			"rate_limit": {"enabled": true, "algorithm": %q, "default_capacity": %d, "default_rate": 0.001}
+		}`, backend.URL, algorithm, capacity)
+	}
+
+	writeConfig(t, path, limited(1, "token_bucket"))
+	a := newTestApp(t, path)
+	if status, _ := get(a); status != http.StatusOK {
+		t.Fatalf("Первый запрос должен пройти, получен %d", status)
+	}
+	if status, _ := get(a); status != http.StatusTooManyRequests {
+		t.Fatalf("Второй запрос должен быть отклонен, получен %d", status)
+	}
+
+	// Некорректная конфигурация не применяется
+	oldLimits := a.limits
+	writeConfig(t, path, limited(5, "unknown"))
+	if err := a.ReloadFile(config.Source{Path: path}); err == nil {
+		t.Fatalf("Ожидалась ошибка перезагрузки некорректной конфигурации")
+	}
+	if a.limits != oldLimits || a.cfg.RateLimit.DefaultCapacity != 1 {
+		t.Errorf("Некорректная конфигурация заменила действующую")
+	}
+	if status, _ := get(a); status != http.StatusTooManyRequests {
+		t.Errorf("После отклоненной перезагрузки лимит должен действовать, получен %d", status)
+	}
+
+	writeConfig(t, path, limited(3, "token_bucket"))
+	if err := a.ReloadFile(config.Source{Path: path}); err != nil {
+		t.Fatalf("Ошибка перезагрузки: %v", err)
+	}
+	// Исчерпанный бакет переносится в новую политику: перезагрузка
+	// не выдает клиенту новые токены
+	if status, _ := get(a); status != http.StatusTooManyRequests {
+		t.Errorf("Исчерпанный лимит сброшен перезагрузкой, получен %d", status)
+	}
+	for i := 0; i < 3; i++ {
+		if status, _ := getFrom(a, "10.0.0.2"); status != http.StatusOK {
+			t.Fatalf("Запрос %d должен пройти по новому лимиту, получен %d", i+1, status)
+		}
+	}
+	if status, _ := getFrom(a, "10.0.0.2"); status != http.StatusTooManyRequests {
+		t.Errorf("Запрос сверх нового лимита должен быть отклонен, получен %d", status)
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	first := newTestBackend(t, "first")
+	second := newTestBackend(t, "second")
+	path := filepath.Join(t.TempDir(), "config.json")
+
+	writeConfig(t, path, fmt.Sprintf(`{"backends": [{"url": %q}]}`, first.URL))
+	a := newTestApp(t, path)
+	a.WatchConfig(config.Source{Path: path}, 10*time.Millisecond)
+
+	writeConfig(t, path, fmt.Sprintf(`{"backends": [{"url": %q}]}`, second.URL))
+	// Время изменения файла может не отличаться при быстрой записи
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(path, future, future)
+
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		if _, body := get(a); body == "second" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Изменение файла конфигурации не применено")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
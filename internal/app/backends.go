@@ -0,0 +1,153 @@
+package app
+
+import (
+	"fmt"
+
+	. "github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/balancer"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/config"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/discovery"
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+// newBalancer создает балансировщик заданного типа над бэкендами
+func newBalancer(cfg *config.Config, backends []*Backend, log *logger.Logger) (balancer.Balancer, error) {
+	var bal balancer.Balancer
+	switch cfg.BalancerType {
+	case "round-robin":
+		bal = balancer.NewRoundRobin(backends)
+		log.Info("Используется алгоритм балансировки Round-Robin")
+	case "weighted-round-robin":
+		bal = balancer.NewWeightedRoundRobin(backends)
+		log.Info("Используется алгоритм балансировки Weighted Round-Robin")
+	case "random":
+		bal = balancer.NewRandom(backends)
+		log.Info("Используется алгоритм балансировки Random")
+	default:
+		return nil, fmt.Errorf("неизвестный алгоритм балансировки: %q", cfg.BalancerType)
+	}
+
+	// Плавный старт добавленных и восстановленных бэкендов
+	if cfg.SlowStart.Window > 0 {
+		slowStart := slowStart(cfg.SlowStart)
+		if err := slowStart.Validate(); err != nil {
+			return nil, fmt.Errorf("некорректные настройки плавного старта: %w", err)
+		}
+		bal.SetSlowStart(slowStart)
+		log.Info(fmt.Sprintf("Плавный старт бэкендов: %v от %.0f%% веса", slowStart.Window, slowStart.MinFactor*100))
+	}
+
+	return bal, nil
+}
+
+// slowStart переводит настройки плавного старта в параметры балансировщика
+func slowStart(cfg config.SlowStartConfig) balancer.SlowStart {
+	return balancer.SlowStart{
+		Window:    cfg.Window.Duration(),
+		MinFactor: cfg.MinWeight,
+		Curve:     cfg.Curve,
+	}
+}
+
+// newBackends создает бэкенды по конфигурации
+func newBackends(cfgs []config.BackendConfig, log *logger.Logger) []*Backend {
+	var backends []*Backend
+	for _, backendCfg := range cfgs {
+		backends = append(backends, &Backend{
+			URL:     backendCfg.URL,
+			Weight:  backendCfg.Weight,
+			IsAlive: true,
+		})
+		log.Info("Добавлен бэкенд: ", backendCfg.URL)
+	}
+	return backends
+}
+
+// rebalance приводит пул бэкендов к новой конфигурации. Бэкенды, оставшиеся
+// в конфигурации, сохраняют состояние и счетчики; при смене алгоритма они
+// переносятся в новый балансировщик. Новые бэкенды добавляются с плавным
+// стартом, исключенные выводятся из старого пула с ожиданием начатых запросов;
+// вывод возвращенного в конфигурацию бэкенда отменяется.
+// Бэкенды, найденные источниками обнаружения и добавленные через admin API,
+// остаются в пуле.
+// Возвращает балансировщик, который должен обслуживать запросы
+func (a *App) rebalance(cfg *config.Config, discovered map[string][]discovery.Target) (balancer.Balancer, error) {
+	old := a.balancer
+	current := make(map[string]*Backend)
+	for _, b := range old.Backends() {
+		// Выводимые из пула бэкенды доживают в старом пуле
+		if draining, _ := b.IsDraining(); !draining {
+			current[b.URL] = b
+		}
+	}
+
+	wanted := wantedBackends(cfg, discovered, a.adminBackends())
+
+	bal := old
+	if cfg.BalancerType != a.cfg.BalancerType || cfg.SlowStart != a.cfg.SlowStart {
+		var kept []*Backend
+		for _, b := range old.Backends() {
+			if current[b.URL] == b && wanted[b.URL] {
+				kept = append(kept, b)
+			}
+		}
+		var err error
+		if bal, err = newBalancer(cfg, kept, a.logger); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, backendCfg := range cfg.Backends {
+		b, exists := current[backendCfg.URL]
+		// Бэкенд, возвращенный в конфигурацию до окончания вывода,
+		// остается в пуле: иначе он был бы удален по завершении вывода
+		if !exists && bal == old && old.CancelDrain(backendCfg.URL) {
+			b, exists = old.Backend(backendCfg.URL), true
+			a.logger.Info(fmt.Sprintf("Вывод бэкенда %s из пула отменен", backendCfg.URL))
+		}
+		if !exists {
+			err := bal.AddBackend(&Backend{URL: backendCfg.URL, Weight: backendCfg.Weight})
+			if err != nil {
+				a.logger.Warn(fmt.Sprintf("Бэкенд %s не добавлен: %v", backendCfg.URL, err))
+				continue
+			}
+			a.logger.Info("Добавлен бэкенд: ", backendCfg.URL)
+			continue
+		}
+		if b.GetWeight() != backendCfg.Weight {
+			b.SetWeight(backendCfg.Weight)
+			a.logger.Info(fmt.Sprintf("Вес бэкенда %s изменен на %d", backendCfg.URL, backendCfg.Weight))
+		}
+	}
+
+	drainTimeout := cfg.DrainTimeout.Duration()
+	for url := range current {
+		if wanted[url] {
+			continue
+		}
+		if err := old.DrainBackend(url, drainTimeout, a.logDrained); err != nil {
+			a.logger.Warn(fmt.Sprintf("Бэкенд %s не выведен из пула: %v", url, err))
+			continue
+		}
+		a.logger.Info(fmt.Sprintf("Бэкенд %s выводится из пула, таймаут %v", url, drainTimeout))
+	}
+
+	return bal, nil
+}
+
+// adminBackends возвращает бэкенды, добавленные через admin API
+func (a *App) adminBackends() []string {
+	if a.admin == nil {
+		return nil
+	}
+	return a.admin.AddedBackends()
+}
+
+// logDrained логирует завершение вывода бэкенда из пула
+func (a *App) logDrained(result balancer.DrainResult) {
+	if result.Remaining > 0 {
+		a.logger.Warn(result.String())
+		return
+	}
+	a.logger.Info(result.String())
+}
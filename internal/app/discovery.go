@@ -0,0 +1,231 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	. "github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/config"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/discovery"
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+// discoveries - запущенные источники обнаружения бэкендов
+type discoveries struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// discoveryUpdate - список бэкендов, полученный от источника
+type discoveryUpdate struct {
+	owner   *discoveries // Запуск источника; списки остановленных источников не применяются
+	source  string
+	targets []discovery.Target
+}
+
+// newProviders создает источники обнаружения бэкендов по конфигурации
+func newProviders(cfg config.DiscoveryConfig, log *logger.Logger) []discovery.Provider {
+	var providers []discovery.Provider
+	for _, dns := range cfg.DNS {
+		providers = append(providers, discovery.NewDNS(discovery.DNSConfig{
+			Name:        dns.Name,
+			Type:        dns.Type,
+			Port:        dns.Port,
+			Scheme:      dns.Scheme,
+			Weight:      dns.Weight,
+			Priority:    dns.Priority,
+			Server:      dns.Server,
+			MinInterval: dns.MinInterval.Duration(),
+			MaxInterval: dns.MaxInterval.Duration(),
+		}, log))
+	}
+	for _, file := range cfg.Files {
+		providers = append(providers, discovery.NewFile(discovery.FileConfig{
+			Path:     file.Path,
+			Format:   file.Format,
+			Interval: file.Interval.Duration(),
+		}, log))
+	}
+	for _, docker := range cfg.Docker {
+		providers = append(providers, discovery.NewDocker(discovery.DockerConfig{
+			Socket:        docker.Socket,
+			Pool:          docker.Pool,
+			Network:       docker.Network,
+			Port:          docker.Port,
+			Scheme:        docker.Scheme,
+			Weight:        docker.Weight,
+			Priority:      docker.Priority,
+			RetryInterval: docker.RetryInterval.Duration(),
+		}, log))
+	}
+	for _, kube := range cfg.Kubernetes {
+		providers = append(providers, discovery.NewKubernetes(discovery.KubernetesConfig{
+			Namespace:      kube.Namespace,
+			Service:        kube.Service,
+			PortName:       kube.PortName,
+			Scheme:         kube.Scheme,
+			Weight:         kube.Weight,
+			Priority:       kube.Priority,
+			Kubeconfig:     kube.Kubeconfig,
+			ResyncInterval: kube.ResyncInterval.Duration(),
+			RetryInterval:  kube.RetryInterval.Duration(),
+		}, log))
+	}
+	return providers
+}
+
+// startDiscovery запускает источники; найденные ими бэкенды передаются в updates
+func startDiscovery(providers []discovery.Provider, updates chan<- discoveryUpdate) *discoveries {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &discoveries{cancel: cancel}
+	for _, p := range providers {
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			p.Run(ctx, func(targets []discovery.Target) {
+				select {
+				case updates <- discoveryUpdate{owner: d, source: p.Name(), targets: targets}:
+				case <-ctx.Done():
+				}
+			})
+		}()
+	}
+	return d
+}
+
+// stop останавливает источники и дожидается их завершения
+func (d *discoveries) stop() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+// watchDiscovery применяет списки бэкендов, найденные источниками
+func (a *App) watchDiscovery() {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		for {
+			select {
+			case u := <-a.updates:
+				a.applyDiscovered(u)
+			case <-a.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// applyDiscovered приводит пул к списку бэкендов источника: новые
+// добавляются с плавным стартом, у найденных ранее обновляются вес,
+// приоритет, метки и готовность, пропавшие и завершающие работу
+// выводятся из пула с ожиданием начатых запросов. Вывод бэкенда,
+// вернувшегося в список, отменяется
+func (a *App) applyDiscovered(u discoveryUpdate) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if u.owner != a.discovery {
+		return
+	}
+	previous := a.discovered[u.source]
+	a.discovered[u.source] = u.targets
+	wanted := wantedBackends(a.cfg, a.discovered, a.adminBackends())
+	found := make(map[string]bool, len(previous))
+	for _, target := range previous {
+		if !target.Terminating {
+			found[target.URL] = true
+		}
+	}
+
+	for _, target := range u.targets {
+		if target.Terminating {
+			continue
+		}
+		b := a.balancer.Backend(target.URL)
+		if b == nil {
+			err := a.balancer.AddBackend(&Backend{
+				URL:      target.URL,
+				Weight:   target.Weight,
+				Priority: target.Priority,
+				Labels:   target.Labels,
+				NotReady: target.NotReady,
+			})
+			if err != nil {
+				a.logger.Warn(fmt.Sprintf("Бэкенд %s не добавлен: %v", target.URL, err))
+				continue
+			}
+			a.logger.Info(fmt.Sprintf("Добавлен бэкенд %s из %s", target.URL, u.source))
+			continue
+		}
+		// Бэкенд, снова найденный до окончания вывода, остается в пуле.
+		// Вывод бэкенда, который источник не терял, начат через admin API
+		// и не отменяется
+		if !found[target.URL] && a.balancer.CancelDrain(target.URL) {
+			a.logger.Info(fmt.Sprintf("Бэкенд %s снова найден в %s, вывод из пула отменен", target.URL, u.source))
+		}
+		if b.GetWeight() != target.Weight {
+			b.SetWeight(target.Weight)
+			a.logger.Info(fmt.Sprintf("Вес бэкенда %s изменен на %d", target.URL, target.Weight))
+		}
+		if b.GetPriority() != target.Priority {
+			b.SetPriority(target.Priority)
+			a.logger.Info(fmt.Sprintf("Приоритет бэкенда %s изменен на %d", target.URL, target.Priority))
+		}
+		if !maps.Equal(b.GetLabels(), target.Labels) {
+			b.SetLabels(target.Labels)
+		}
+		if b.IsReady() == target.NotReady {
+			b.SetReady(!target.NotReady)
+			a.logger.Info(fmt.Sprintf("Готовность бэкенда %s по данным %s: %v", target.URL, u.source, !target.NotReady))
+		}
+	}
+
+	drainTimeout := a.cfg.DrainTimeout.Duration()
+	for _, target := range slices.Concat(u.targets, previous) {
+		if wanted[target.URL] {
+			continue
+		}
+		// Бэкенд уже удален или выводится из пула
+		b := a.balancer.Backend(target.URL)
+		if b == nil {
+			continue
+		}
+		if draining, _ := b.IsDraining(); draining {
+			continue
+		}
+		if err := a.balancer.DrainBackend(target.URL, drainTimeout, a.logDrained); err != nil {
+			a.logger.Warn(fmt.Sprintf("Бэкенд %s не выведен из пула: %v", target.URL, err))
+			continue
+		}
+		reason := "больше не найден в"
+		if target.Terminating {
+			reason = "завершает работу по данным"
+		}
+		a.logger.Info(fmt.Sprintf("Бэкенд %s %s %s и выводится из пула, таймаут %v",
+			target.URL, reason, u.source, drainTimeout))
+	}
+}
+
+// wantedBackends возвращает URL бэкендов, которые должны быть в пуле:
+// заданных в конфигурации, добавленных через admin API и найденных
+// источниками обнаружения, кроме завершающих работу
+func wantedBackends(cfg *config.Config, discovered map[string][]discovery.Target, added []string) map[string]bool {
+	wanted := make(map[string]bool, len(cfg.Backends)+len(added))
+	for _, backendCfg := range cfg.Backends {
+		wanted[backendCfg.URL] = true
+	}
+	for _, url := range added {
+		wanted[url] = true
+	}
+	for _, targets := range discovered {
+		for _, target := range targets {
+			if !target.Terminating {
+				wanted[target.URL] = true
+			}
+		}
+	}
+	return wanted
+}
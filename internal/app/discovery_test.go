@@ -0,0 +1,185 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/config"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/discovery"
+)
+
+// fakeProvider передает в пул списки бэкендов, отправленные тестом
+type fakeProvider struct {
+	lists chan []discovery.Target
+}
+
+func (p *fakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *fakeProvider) Run(ctx context.Context, update func([]discovery.Target)) {
+	for {
+		select {
+		case targets := <-p.lists:
+			update(targets)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// useProvider заменяет источники обнаружения приложения
+func useProvider(a *App, p discovery.Provider) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.discovery.stop()
+	a.discovery = startDiscovery([]discovery.Provider{p}, a.updates)
+}
+
+// waitBackend ждет, пока бэкенд появится в пуле или будет удален из него
+func waitBackend(t *testing.T, a *App, url string, present bool) *Backend {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		a.mu.Lock()
+		b := a.balancer.Backend(url)
+		a.mu.Unlock()
+		if (b != nil) == present {
+			return b
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Бэкенд %s: ожидалось присутствие в пуле %v", url, present)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// distribution выполняет запросы и считает ответы бэкендов
+func distribution(t *testing.T, a *App, n int) map[string]int {
+	t.Helper()
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		status, body := get(a)
+		if status != http.StatusOK {
+			t.Fatalf("Неожиданный статус %d: %s", status, body)
+		}
+		counts[body]++
+	}
+	return counts
+}
+
+func TestDiscoveredBackends(t *testing.T) {
+	static := newTestBackend(t, "static")
+	found := newTestBackend(t, "found")
+	backup := newTestBackend(t, "backup")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfig(t, path, fmt.Sprintf(`{"backends": [{"url": %q}]}`, static.URL))
+	a := newTestApp(t, path)
+	provider := &fakeProvider{lists: make(chan []discovery.Target)}
+	useProvider(a, provider)
+
+	provider.lists <- []discovery.Target{{URL: found.URL, Weight: 2}, {URL: backup.URL, Priority: 1}}
+	if b := waitBackend(t, a, backup.URL, true); b.GetPriority() != 1 {
+		t.Errorf("Приоритет найденного бэкенда %d, ожидался 1", b.GetPriority())
+	}
+	// Резервный уровень не получает запросов, пока доступен основной
+	if counts := distribution(t, a, 20); counts["backup"] != 0 || counts["found"] == 0 || counts["static"] == 0 {
+		t.Errorf("Неверное распределение запросов: %v", counts)
+	}
+
+	// Перезагрузка конфигурации не выводит найденные бэкенды из пула
+	writeConfig(t, path, fmt.Sprintf(`{"balancer_type": "weighted-round-robin", "backends": [{"url": %q}]}`, static.URL))
+	if err := a.ReloadFile(config.Source{Path: path}); err != nil {
+		t.Fatalf("Ошибка перезагрузки: %v", err)
+	}
+	if b := waitBackend(t, a, found.URL, true); b.GetWeight() != 2 {
+		t.Errorf("Вес найденного бэкенда после перезагрузки %d, ожидался 2", b.GetWeight())
+	}
+
+	// Бэкенд, пропавший из списка источника, выводится из пула
+	provider.lists <- []discovery.Target{{URL: backup.URL, Priority: 1}}
+	waitBackend(t, a, found.URL, false)
+	if counts := distribution(t, a, 5); counts["static"] != 5 {
+		t.Errorf("Запросы должны направляться только на оставшийся бэкенд основного уровня: %v", counts)
+	}
+}
+
+func TestDiscoveredBackendReturnsDuringDrain(t *testing.T) {
+	static := newTestBackend(t, "static")
+	found := newTestBackend(t, "found")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfig(t, path, fmt.Sprintf(`{"drain_timeout": "200ms", "backends": [{"url": %q}]}`, static.URL))
+	a := newTestApp(t, path)
+	provider := &fakeProvider{lists: make(chan []discovery.Target)}
+	useProvider(a, provider)
+
+	provider.lists <- []discovery.Target{{URL: found.URL}}
+	b := waitBackend(t, a, found.URL, true)
+	// Запрос в работе не дает выводу завершиться сразу
+	b.IncrementConnections()
+
+	waitDraining := func(draining bool) {
+		t.Helper()
+		for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			if current, _ := b.IsDraining(); current == draining {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Бэкенд %s: ожидалось draining %v", found.URL, draining)
+			}
+		}
+	}
+	provider.lists <- []discovery.Target{}
+	waitDraining(true)
+
+	// Бэкенд снова найден до окончания вывода
+	provider.lists <- []discovery.Target{{URL: found.URL}}
+	waitDraining(false)
+	b.DecrementConnections()
+	time.Sleep(400 * time.Millisecond)
+
+	if waitBackend(t, a, found.URL, true) != b {
+		t.Fatalf("Снова найденный бэкенд удален по окончании вывода")
+	}
+	if counts := distribution(t, a, 10); counts["found"] == 0 {
+		t.Errorf("Запросы не направляются на снова найденный бэкенд: %v", counts)
+	}
+}
+
+func TestDiscoveredReadiness(t *testing.T) {
+	ready := newTestBackend(t, "ready")
+	starting := newTestBackend(t, "starting")
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfig(t, path, `{"discovery": {"files": [{"path": "targets.json"}]}}`)
+	a := newTestApp(t, path)
+	provider := &fakeProvider{lists: make(chan []discovery.Target)}
+	useProvider(a, provider)
+
+	// Не готовый бэкенд остается в пуле, но не получает запросов
+	provider.lists <- []discovery.Target{{URL: ready.URL}, {URL: starting.URL, NotReady: true}}
+	b := waitBackend(t, a, starting.URL, true)
+	if counts := distribution(t, a, 6); counts["ready"] != 6 {
+		t.Errorf("Запросы должны направляться только на готовый бэкенд: %v", counts)
+	}
+
+	provider.lists <- []discovery.Target{{URL: ready.URL}, {URL: starting.URL}}
+	for deadline := time.Now().Add(2 * time.Second); !b.IsReady(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Бэкенд не стал готовым")
+		}
+	}
+
+	// Завершающий работу бэкенд выводится из пула, хотя источник его еще сообщает
+	provider.lists <- []discovery.Target{{URL: ready.URL, Terminating: true}, {URL: starting.URL}}
+	waitBackend(t, a, ready.URL, false)
+	if counts := distribution(t, a, 4); counts["starting"] != 4 {
+		t.Errorf("Запросы должны направляться только на оставшийся бэкенд: %v", counts)
+	}
+}
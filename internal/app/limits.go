@@ -0,0 +1,295 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/config"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/proxy"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/ratelimit"
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/redis"
+)
+
+// limits - rate limiting, собранный по секции rate_limit конфигурации:
+// общая политика, политики маршрутов и блокировки клиентов
+type limits struct {
+	manager *ratelimit.Manager
+	routes  []*proxy.RoutePolicy
+	bans    *ratelimit.Banlist
+}
+
+// sharedStore - хранилище, которым владеет приложение. Менеджеры
+// пересоздаются при перезагрузке конфигурации, поэтому не закрывают его
+type sharedStore struct {
+	ratelimit.Store
+}
+
+// Close не закрывает хранилище: оно закрывается при остановке приложения
+func (sharedStore) Close() error {
+	return nil
+}
+
+// newLimits создает rate limiting по конфигурации. store может быть nil;
+// политики маршрутов хранят состояния в отдельных областях хранилища.
+// При ошибке уже созданные компоненты останавливаются
+func newLimits(cfg config.RateLimitConfig, store *ratelimit.BoltStore, log *logger.Logger) (l *limits, err error) {
+	l = &limits{}
+	defer func() {
+		if err != nil {
+			_ = l.close()
+		}
+	}()
+
+	l.manager, err = ratelimit.NewManager(ratelimit.Policy{
+		Algorithm: cfg.Algorithm,
+		Capacity:  cfg.DefaultCapacity,
+		Rate:      cfg.DefaultRate,
+	})
+	if err != nil {
+		return l, fmt.Errorf("некорректные настройки rate limiting: %w", err)
+	}
+	log.Info("Rate limiting включен. Алгоритм: ", cfg.Algorithm,
+		", стандартный лимит: ", cfg.DefaultRate, " запросов в секунду")
+	l.manager.SetShadowWindow(cfg.ShadowWindow.Duration())
+	l.manager.SetShadow(cfg.Shadow)
+	if cfg.Shadow {
+		log.Info("Общая политика rate limiting работает в теневом режиме")
+	}
+	if ccfg := cfg.Concurrency; ccfg.MaxInFlight > 0 {
+		l.manager.SetMaxInFlight(ccfg.MaxInFlight, ccfg.QueueTimeout.Duration())
+		log.Info("Лимит одновременных запросов клиента: ", ccfg.MaxInFlight)
+	}
+	l.manager.StartEviction(cfg.ClientTTL.Duration(), cfg.MaxClients, log)
+
+	dcfg := cfg.Distributed
+	var redisClient *redis.Client
+	if dcfg.Enabled {
+		redisClient = redis.NewClient(redis.Options{
+			Addr:     dcfg.Address,
+			Password: dcfg.Password,
+			DB:       dcfg.DB,
+			Timeout:  dcfg.Timeout.Duration(),
+		})
+		distributed, err := ratelimit.NewDistributed(redisClient, dcfg.KeyPrefix, dcfg.OnError, log)
+		if err != nil {
+			_ = redisClient.Close()
+			return l, fmt.Errorf("некорректные настройки распределенного rate limiting: %w", err)
+		}
+		l.manager.SetDistributed(distributed)
+		log.Info("Распределенный rate limiting через ", dcfg.Address, ", при сбое: ", dcfg.OnError)
+	}
+
+	// Политики маршрутов с собственными бакетами получают отдельный менеджер;
+	// имя политики входит в ключи общего хранилища, поэтому должно быть уникальным
+	routeNames := make(map[string]bool)
+	for _, routeCfg := range cfg.Routes {
+		if routeCfg.Name == "" || routeNames[routeCfg.Name] {
+			return l, fmt.Errorf("политика маршрута %s должна иметь уникальное имя", routeCfg.Path)
+		}
+		routeNames[routeCfg.Name] = true
+
+		route := &proxy.RoutePolicy{
+			RouteMatcher: proxy.RouteMatcher{
+				Path:    routeCfg.Path,
+				Methods: routeCfg.Methods,
+				Host:    routeCfg.Host,
+			},
+			Name: routeCfg.Name,
+			Cost: routeCfg.Cost,
+		}
+		l.routes = append(l.routes, route)
+		if routeCfg.Capacity > 0 {
+			if routeCfg.Cost > routeCfg.Capacity {
+				return l, fmt.Errorf("стоимость запроса маршрута %s превышает емкость", routeCfg.Name)
+			}
+			route.Limiter, err = ratelimit.NewManager(ratelimit.Policy{
+				Algorithm: routeCfg.Algorithm,
+				Capacity:  routeCfg.Capacity,
+				Rate:      routeCfg.Rate,
+			})
+			if err != nil {
+				return l, fmt.Errorf("некорректная политика маршрута %s: %w", routeCfg.Name, err)
+			}
+			route.Limiter.SetShadowWindow(cfg.ShadowWindow.Duration())
+			route.Limiter.SetShadow(routeCfg.Shadow)
+			route.Limiter.StartEviction(cfg.ClientTTL.Duration(), cfg.MaxClients, log)
+			if redisClient != nil {
+				distributed, err := ratelimit.NewDistributed(redisClient,
+					dcfg.KeyPrefix+"route:"+routeCfg.Name+":", dcfg.OnError, log)
+				if err != nil {
+					return l, fmt.Errorf("некорректные настройки распределенного rate limiting: %w", err)
+				}
+				route.Limiter.SetDistributed(distributed)
+			}
+		}
+		log.Info("Политика rate limiting для маршрута ", routeCfg.Name, ": ", routeCfg.Path,
+			", стоимость запроса: ", routeCfg.Cost)
+	}
+
+	// Квоты подключаются до хранилища, чтобы восстановить их счетчики
+	for _, quotaCfg := range cfg.Quotas {
+		quota, err := newQuota(quotaCfg)
+		if err != nil {
+			return l, fmt.Errorf("некорректная квота %s: %w", quotaCfg.Name, err)
+		}
+		l.manager.AddQuota(quota)
+		log.Info("Квота ", quotaCfg.Name, ": ", quotaCfg.Limit, " запросов, период ", quotaCfg.Period,
+			", сброс в ", quotaCfg.ResetAt, " ", quotaCfg.Timezone)
+	}
+
+	// Временные блокировки клиентов, которые продолжают превышать лимиты;
+	// отказы всех политик учитываются в общем списке
+	var bans *ratelimit.Banlist
+	if bcfg := cfg.Ban; bcfg.Enabled {
+		bans, err = ratelimit.NewBanlist(ratelimit.BanPolicy{
+			MaxRejections: bcfg.MaxRejections,
+			Window:        bcfg.Window.Duration(),
+			Duration:      bcfg.Duration.Duration(),
+			MaxDuration:   bcfg.MaxDuration.Duration(),
+			ForgetAfter:   bcfg.ForgetAfter.Duration(),
+		}, log)
+		if err != nil {
+			return l, fmt.Errorf("некорректные настройки блокировок: %w", err)
+		}
+	}
+
+	// Политики клиентов проверяются до подключения хранилища: отклоненная
+	// конфигурация не должна сохранять в него свое состояние
+	clients := make(map[string]ratelimit.Policy, len(cfg.Clients))
+	for _, clientCfg := range cfg.Clients {
+		policy := ratelimit.Policy{
+			Algorithm: clientCfg.Algorithm,
+			Capacity:  clientCfg.Capacity,
+			Rate:      clientCfg.Rate,
+		}
+		if err := policy.Validate(); err != nil {
+			return l, fmt.Errorf("некорректная политика клиента %s: %w", clientCfg.ID, err)
+		}
+		clients[clientCfg.ID] = policy
+	}
+
+	if store != nil {
+		if err := l.manager.AttachStore(shared(store), cfg.Store.SnapshotInterval.Duration(), log); err != nil {
+			return l, fmt.Errorf("ошибка загрузки состояний клиентов: %w", err)
+		}
+		for _, route := range l.routes {
+			if route.Limiter == nil {
+				continue
+			}
+			scope, err := store.Scope("route:" + route.Name)
+			if err != nil {
+				return l, fmt.Errorf("ошибка открытия хранилища политики %s: %w", route.Name, err)
+			}
+			if err := route.Limiter.AttachStore(shared(scope), cfg.Store.SnapshotInterval.Duration(), log); err != nil {
+				return l, fmt.Errorf("ошибка загрузки состояний клиентов политики %s: %w", route.Name, err)
+			}
+		}
+		log.Info("Состояния клиентов хранятся в ", cfg.Store.Path)
+	}
+
+	if bans != nil {
+		if store != nil {
+			if err := bans.AttachStore(store); err != nil {
+				return l, fmt.Errorf("ошибка загрузки блокировок клиентов: %w", err)
+			}
+		}
+		bans.Start()
+		l.bans = bans
+		l.manager.SetBans(bans)
+		for _, route := range l.routes {
+			if route.Limiter != nil {
+				route.Limiter.SetBans(bans)
+			}
+		}
+		log.Info(fmt.Sprintf("Блокировка клиентов после %d отказов за %v на %v",
+			cfg.Ban.MaxRejections, cfg.Ban.Window, cfg.Ban.Duration))
+	}
+
+	// Индивидуальные политики из конфигурации имеют приоритет над сохраненными
+	for id, policy := range clients {
+		if err := l.manager.SetClientPolicy(id, policy); err != nil {
+			return l, fmt.Errorf("ошибка сохранения политики клиента %s: %w", id, err)
+		}
+	}
+
+	return l, nil
+}
+
+// policies возвращает политики с собственными бакетами по имени
+func (l *limits) policies() map[string]*ratelimit.Manager {
+	policies := map[string]*ratelimit.Manager{proxy.DefaultPolicy: l.manager}
+	for _, route := range l.routes {
+		if route.Limiter != nil {
+			policies[route.Name] = route.Limiter
+		}
+	}
+	return policies
+}
+
+// inherit переносит состояние клиентов из заменяемого rate limiting:
+// общей политики, политик маршрутов с тем же именем и блокировок.
+// Без этого перезагрузка сбрасывала бы лимиты всех клиентов, а с
+// хранилищем возвращала бы им состояние последнего снимка
+func (l *limits) inherit(old *limits) {
+	l.manager.Inherit(old.manager)
+	oldRoutes := make(map[string]*ratelimit.Manager)
+	for _, route := range old.routes {
+		if route.Limiter != nil {
+			oldRoutes[route.Name] = route.Limiter
+		}
+	}
+	for _, route := range l.routes {
+		if oldLimiter := oldRoutes[route.Name]; route.Limiter != nil && oldLimiter != nil {
+			route.Limiter.Inherit(oldLimiter)
+		}
+	}
+	if l.bans != nil && old.bans != nil {
+		l.bans.Inherit(old.bans)
+	}
+}
+
+// close останавливает блокировки и сохраняет состояния клиентов
+// общей политики и политик маршрутов
+func (l *limits) close() error {
+	if l.bans != nil {
+		l.bans.Close()
+	}
+	for _, route := range l.routes {
+		if route.Limiter != nil {
+			_ = route.Limiter.Close()
+		}
+	}
+	if l.manager == nil {
+		return nil
+	}
+	return l.manager.Close()
+}
+
+// newQuota создает квоту по конфигурации
+func newQuota(cfg config.QuotaConfig) (*ratelimit.Quota, error) {
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	resetAt, err := time.Parse("15:04", cfg.ResetAt)
+	if err != nil {
+		return nil, fmt.Errorf("некорректное время сброса %q", cfg.ResetAt)
+	}
+
+	quota, err := ratelimit.NewQuota(ratelimit.QuotaPolicy{
+		Name:     cfg.Name,
+		Period:   cfg.Period,
+		Limit:    cfg.Limit,
+		Location: location,
+		ResetAt:  time.Duration(resetAt.Hour())*time.Hour + time.Duration(resetAt.Minute())*time.Minute,
+		ResetDay: cfg.ResetDay,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for id, limit := range cfg.Clients {
+		quota.SetClientLimit(id, limit)
+	}
+	return quota, nil
+}
@@ -1,16 +1,41 @@
 package backend
 
 import (
+	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
+)
+
+// Административные режимы бэкенда
+const (
+	ModeAuto  = "auto"  // Доступность определяет health check
+	ModeUp    = "up"    // Принудительно доступен независимо от health check
+	ModeDown  = "down"  // Принудительно недоступен
+	ModeDrain = "drain" // Новые запросы не направляются, начатые завершаются
 )
 
 // Backend представляет бэкенд-сервер
 type Backend struct {
 	URL         string
 	Weight      int
+	Priority    int               // Уровень приоритета: меньшее значение предпочтительнее, следующие уровни - резерв
+	Labels      map[string]string // Метки из источника обнаружения
 	ActiveConns int64
 	IsAlive     bool
+	// Источник обнаружения сообщает, что бэкенд не готов принимать
+	// запросы; учитывается вместе с health check
+	NotReady bool
+	Mode     string // Административный режим; пусто - ModeAuto
+	Draining bool   // Бэкенд выводится из пула и будет удален
+	// Срок удаления выводимого бэкенда; нулевое значение - ждать
+	// завершения всех запросов без ограничения
+	DrainDeadline time.Time
+	// Номер текущего вывода из пула: увеличивается при каждом StartDrain
+	DrainGeneration uint64
+	// Момент добавления в пул или восстановления, от которого
+	// отсчитывается плавный старт
+	WarmupSince time.Time
 	Mu          sync.RWMutex
 }
 
@@ -31,6 +56,168 @@ func (b *Backend) SetAlive(isAlive bool) {
 	b.IsAlive = isAlive
 }
 
+// Alive возвращает результат последней проверки доступности
+func (b *Backend) Alive() bool {
+	b.Mu.RLock()
+	defer b.Mu.RUnlock()
+	return b.IsAlive
+}
+
+// SetReady устанавливает готовность бэкенда по данным источника обнаружения
+func (b *Backend) SetReady(ready bool) {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	b.NotReady = !ready
+}
+
+// IsReady возвращает готовность бэкенда по данным источника обнаружения
+func (b *Backend) IsReady() bool {
+	b.Mu.RLock()
+	defer b.Mu.RUnlock()
+	return !b.NotReady
+}
+
+// SetWeight устанавливает вес бэкенда
+func (b *Backend) SetWeight(weight int) {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	b.Weight = weight
+}
+
+// GetWeight возвращает вес бэкенда
+func (b *Backend) GetWeight() int {
+	b.Mu.RLock()
+	defer b.Mu.RUnlock()
+	return b.Weight
+}
+
+// SetPriority устанавливает уровень приоритета бэкенда
+func (b *Backend) SetPriority(priority int) {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	b.Priority = priority
+}
+
+// GetPriority возвращает уровень приоритета бэкенда
+func (b *Backend) GetPriority() int {
+	b.Mu.RLock()
+	defer b.Mu.RUnlock()
+	return b.Priority
+}
+
+// SetLabels заменяет метки бэкенда
+func (b *Backend) SetLabels(labels map[string]string) {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	b.Labels = labels
+}
+
+// GetLabels возвращает метки бэкенда
+func (b *Backend) GetLabels() map[string]string {
+	b.Mu.RLock()
+	defer b.Mu.RUnlock()
+	return b.Labels
+}
+
+// SetMode устанавливает административный режим бэкенда
+func (b *Backend) SetMode(mode string) error {
+	switch mode {
+	case ModeAuto, ModeUp, ModeDown, ModeDrain:
+	default:
+		return fmt.Errorf("неизвестный режим бэкенда %q", mode)
+	}
+
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	b.Mode = mode
+	return nil
+}
+
+// GetMode возвращает административный режим бэкенда
+func (b *Backend) GetMode() string {
+	b.Mu.RLock()
+	defer b.Mu.RUnlock()
+	if b.Mode == "" {
+		return ModeAuto
+	}
+	return b.Mode
+}
+
+// StartWarmup начинает отсчет плавного старта с момента now
+func (b *Backend) StartWarmup(now time.Time) {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	b.WarmupSince = now
+}
+
+// WarmupStart возвращает начало плавного старта
+func (b *Backend) WarmupStart() time.Time {
+	b.Mu.RLock()
+	defer b.Mu.RUnlock()
+	return b.WarmupSince
+}
+
+// StartDrain помечает бэкенд как выводимый из пула и возвращает номер
+// начатого вывода. Возвращает false, если бэкенд уже выводится
+func (b *Backend) StartDrain(deadline time.Time) (uint64, bool) {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	if b.Draining {
+		return 0, false
+	}
+	b.Draining = true
+	b.DrainDeadline = deadline
+	b.DrainGeneration++
+	return b.DrainGeneration, true
+}
+
+// CancelDrain возвращает выводимый бэкенд в пул.
+// Возвращает false, если бэкенд не выводится
+func (b *Backend) CancelDrain() bool {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+	if !b.Draining {
+		return false
+	}
+	b.Draining = false
+	b.DrainDeadline = time.Time{}
+	return true
+}
+
+// IsDraining сообщает, выводится ли бэкенд из пула, и срок его удаления
+func (b *Backend) IsDraining() (bool, time.Time) {
+	b.Mu.RLock()
+	defer b.Mu.RUnlock()
+	return b.Draining, b.DrainDeadline
+}
+
+// DrainCurrent сообщает, продолжается ли вывод с номером generation:
+// он не отменен и не начат заново
+func (b *Backend) DrainCurrent(generation uint64) bool {
+	b.Mu.RLock()
+	defer b.Mu.RUnlock()
+	return b.Draining && b.DrainGeneration == generation
+}
+
+// Available сообщает, можно ли направлять на бэкенд новые запросы
+// с учетом health check, готовности и административного режима
+func (b *Backend) Available() bool {
+	b.Mu.RLock()
+	defer b.Mu.RUnlock()
+
+	if b.Draining {
+		return false
+	}
+	switch b.Mode {
+	case ModeUp:
+		return true
+	case ModeDown, ModeDrain:
+		return false
+	default:
+		return b.IsAlive && !b.NotReady
+	}
+}
+
 // GetActiveConnections возвращает текущее количество активных соединений
 func (b *Backend) GetActiveConnections() int64 {
 	return atomic.LoadInt64(&b.ActiveConns)
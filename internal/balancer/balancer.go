@@ -1,37 +1,65 @@
 package balancer
 
 import (
-	. "github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
+	"errors"
 	"sync"
+	"time"
+
+	. "github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
+)
+
+var (
+	// ErrBackendExists возвращается при добавлении бэкенда с URL, который уже есть в пуле
+	ErrBackendExists = errors.New("бэкенд уже есть в пуле")
+	// ErrBackendNotFound возвращается, если бэкенда с URL нет в пуле
+	ErrBackendNotFound = errors.New("бэкенд не найден")
+	// ErrBackendDraining возвращается при повторном выводе бэкенда из пула
+	ErrBackendDraining = errors.New("бэкенд уже выводится из пула")
 )
 
 // Balancer интерфейс для различных алгоритмов балансировки
 type Balancer interface {
 	NextBackend() *Backend
-	AddBackend(backend *Backend)
-	RemoveBackend(url string)
+	AddBackend(backend *Backend) error
+	RemoveBackend(url string) bool
+	DrainBackend(url string, timeout time.Duration, done func(DrainResult)) error
+	CancelDrain(url string) bool
 	MarkBackendDown(url string)
 	MarkBackendUp(url string)
+	Backend(url string) *Backend
 	Backends() []*Backend
+	SetSlowStart(s SlowStart)
+	EffectiveWeight(backend *Backend, now time.Time) float64
 }
 
 type BaseBalancer struct {
-	backends []*Backend
-	mu       sync.RWMutex
+	backends  []*Backend
+	slowStart SlowStart
+	mu        sync.RWMutex
 }
 
-// AddBackend добавляет новый бэкенд в пул
-func (bb *BaseBalancer) AddBackend(backend *Backend) {
+// AddBackend добавляет новый бэкенд в пул.
+// Возвращает ErrBackendExists, если бэкенд с таким URL уже есть
+func (bb *BaseBalancer) AddBackend(backend *Backend) error {
 	bb.mu.Lock()
 	defer bb.mu.Unlock()
 
+	for _, b := range bb.backends {
+		if b.URL == backend.URL {
+			return ErrBackendExists
+		}
+	}
+
 	// Устанавливаем флаг активности по умолчанию
 	backend.SetAlive(true)
+	backend.StartWarmup(time.Now())
 	bb.backends = append(bb.backends, backend)
+	return nil
 }
 
-// RemoveBackend удаляет бэкенд из пула по URL
-func (bb *BaseBalancer) RemoveBackend(url string) {
+// RemoveBackend удаляет бэкенд из пула по URL.
+// Возвращает false, если бэкенда нет в пуле
+func (bb *BaseBalancer) RemoveBackend(url string) bool {
 	bb.mu.Lock()
 	defer bb.mu.Unlock()
 
@@ -39,9 +67,10 @@ func (bb *BaseBalancer) RemoveBackend(url string) {
 		if backend.URL == url {
 			// Удаляем бэкенд из слайса
 			bb.backends = append(bb.backends[:i], bb.backends[i+1:]...)
-			return
+			return true
 		}
 	}
+	return false
 }
 
 // MarkBackendDown помечает бэкенд как недоступный
@@ -57,23 +86,42 @@ func (bb *BaseBalancer) MarkBackendDown(url string) {
 	}
 }
 
-// MarkBackendUp помечает бэкенд как доступный
+// MarkBackendUp помечает бэкенд как доступный. Восстановленный
+// бэкенд вводится в работу плавно
 func (bb *BaseBalancer) MarkBackendUp(url string) {
 	bb.mu.RLock()
 	defer bb.mu.RUnlock()
 
 	for _, backend := range bb.backends {
 		if backend.URL == url {
+			if !backend.Alive() {
+				backend.StartWarmup(time.Now())
+			}
 			backend.SetAlive(true)
 			return
 		}
 	}
 }
 
-// Backends возвращает список всех бэкендов
+// Backend возвращает бэкенд по URL или nil, если его нет в пуле
+func (bb *BaseBalancer) Backend(url string) *Backend {
+	bb.mu.RLock()
+	defer bb.mu.RUnlock()
+
+	for _, backend := range bb.backends {
+		if backend.URL == url {
+			return backend
+		}
+	}
+	return nil
+}
+
+// Backends возвращает копию списка всех бэкендов
 func (bb *BaseBalancer) Backends() []*Backend {
 	bb.mu.RLock()
 	defer bb.mu.RUnlock()
 
-	return bb.backends
+	backends := make([]*Backend, len(bb.backends))
+	copy(backends, bb.backends)
+	return backends
 }
@@ -0,0 +1,127 @@
+package balancer
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
+)
+
+// drainPollInterval - период проверки числа запросов выводимого бэкенда
+const drainPollInterval = 100 * time.Millisecond
+
+// DrainResult - итог вывода бэкенда из пула
+type DrainResult struct {
+	URL      string
+	Duration time.Duration // Сколько длился вывод
+	// Запросов в работе на момент удаления; больше нуля,
+	// если истек таймаут
+	Remaining int64
+}
+
+// String описывает итог вывода бэкенда для лога
+func (r DrainResult) String() string {
+	if r.Remaining > 0 {
+		return fmt.Sprintf("Бэкенд %s удален из пула по таймауту через %v, прервано запросов: %d",
+			r.URL, r.Duration.Round(time.Millisecond), r.Remaining)
+	}
+	return fmt.Sprintf("Бэкенд %s удален из пула после завершения запросов за %v",
+		r.URL, r.Duration.Round(time.Millisecond))
+}
+
+// DrainBackend выводит бэкенд из пула: новые запросы на него не направляются,
+// начатые запросы (в том числе upgrade-соединения) завершаются. Бэкенд
+// удаляется, когда запросов в работе не остается или истекает timeout;
+// timeout <= 0 - ждать без ограничения. done вызывается после удаления
+func (bb *BaseBalancer) DrainBackend(url string, timeout time.Duration, done func(DrainResult)) error {
+	backend := bb.Backend(url)
+	if backend == nil {
+		return ErrBackendNotFound
+	}
+
+	start := time.Now()
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = start.Add(timeout)
+	}
+	generation, ok := backend.StartDrain(deadline)
+	if !ok {
+		return ErrBackendDraining
+	}
+
+	go bb.drain(backend, generation, start, timeout, done)
+	return nil
+}
+
+// CancelDrain возвращает выводимый бэкенд в пул с плавным стартом;
+// начатый вывод завершается без удаления и без вызова done.
+// Возвращает false, если бэкенда нет в пуле или он не выводится
+func (bb *BaseBalancer) CancelDrain(url string) bool {
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+
+	for _, backend := range bb.backends {
+		if backend.URL == url && backend.CancelDrain() {
+			backend.StartWarmup(time.Now())
+			return true
+		}
+	}
+	return false
+}
+
+// drain ждет завершения запросов бэкенда или истечения таймаута и удаляет его.
+// Вывод прекращается, если его отменили или начали заново
+func (bb *BaseBalancer) drain(backend *Backend, generation uint64, start time.Time, timeout time.Duration, done func(DrainResult)) {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+wait:
+	for backend.GetActiveConnections() > 0 {
+		select {
+		case <-ticker.C:
+			if !backend.DrainCurrent(generation) {
+				return
+			}
+		case <-expired:
+			break wait
+		}
+	}
+
+	if !bb.removeDrained(backend, generation) {
+		return
+	}
+	if done != nil {
+		done(DrainResult{
+			URL:       backend.URL,
+			Duration:  time.Since(start),
+			Remaining: backend.GetActiveConnections(),
+		})
+	}
+}
+
+// removeDrained удаляет бэкенд, если его вывод с номером generation
+// не отменен и не начат заново.
+// Проверка и удаление выполняются под блокировкой пула, поэтому
+// не пересекаются с CancelDrain
+func (bb *BaseBalancer) removeDrained(backend *Backend, generation uint64) bool {
+	bb.mu.Lock()
+	defer bb.mu.Unlock()
+
+	if !backend.DrainCurrent(generation) {
+		return false
+	}
+	for i, b := range bb.backends {
+		if b == backend {
+			bb.backends = append(bb.backends[:i], bb.backends[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
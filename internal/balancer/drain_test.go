@@ -0,0 +1,131 @@
+package balancer
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
+)
+
+func TestDrainBackend(t *testing.T) {
+	backend1 := &Backend{URL: "http://server1:8080", IsAlive: true}
+	backend2 := &Backend{URL: "http://server2:8080", IsAlive: true}
+	balancer := NewRoundRobin([]*Backend{backend1, backend2})
+
+	// Запрос, начатый до вывода из пула
+	backend1.IncrementConnections()
+
+	results := make(chan DrainResult, 1)
+	if err := balancer.DrainBackend(backend1.URL, time.Minute, func(r DrainResult) { results <- r }); err != nil {
+		t.Fatalf("Ошибка вывода бэкенда: %v", err)
+	}
+	if err := balancer.DrainBackend(backend1.URL, time.Minute, nil); err != ErrBackendDraining {
+		t.Errorf("Ожидалась ошибка повторного вывода, получено %v", err)
+	}
+	if err := balancer.DrainBackend("http://missing:8080", time.Minute, nil); err != ErrBackendNotFound {
+		t.Errorf("Ожидалась ошибка отсутствия бэкенда, получено %v", err)
+	}
+
+	// Новые запросы не направляются на выводимый бэкенд
+	for i := 0; i < 4; i++ {
+		if selected := balancer.NextBackend(); selected != backend2 {
+			t.Fatalf("Запрос направлен на выводимый бэкенд")
+		}
+	}
+
+	select {
+	case <-results:
+		t.Fatalf("Бэкенд удален до завершения запросов")
+	case <-time.After(3 * drainPollInterval):
+	}
+
+	backend1.DecrementConnections()
+	select {
+	case result := <-results:
+		if result.Remaining != 0 || balancer.Backend(backend1.URL) != nil {
+			t.Errorf("Неверный итог вывода: %+v", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Бэкенд не удален после завершения запросов")
+	}
+}
+
+func TestCancelDrain(t *testing.T) {
+	backend1 := &Backend{URL: "http://server1:8080", IsAlive: true}
+	balancer := NewRoundRobin([]*Backend{backend1})
+	backend1.IncrementConnections()
+
+	results := make(chan DrainResult, 1)
+	if err := balancer.DrainBackend(backend1.URL, 50*time.Millisecond, func(r DrainResult) { results <- r }); err != nil {
+		t.Fatalf("Ошибка вывода бэкенда: %v", err)
+	}
+	if !balancer.CancelDrain(backend1.URL) {
+		t.Fatalf("Вывод бэкенда не отменен")
+	}
+	if balancer.CancelDrain(backend1.URL) {
+		t.Errorf("Повторная отмена должна вернуть false")
+	}
+
+	// Отмененный вывод не удаляет бэкенд по таймауту
+	select {
+	case result := <-results:
+		t.Fatalf("Бэкенд удален после отмены вывода: %+v", result)
+	case <-time.After(3 * drainPollInterval):
+	}
+	if balancer.Backend(backend1.URL) != backend1 || !backend1.Available() {
+		t.Errorf("Бэкенд не возвращен в пул")
+	}
+}
+
+func TestDrainRestartedWithoutTimeout(t *testing.T) {
+	backend1 := &Backend{URL: "http://server1:8080", IsAlive: true}
+	balancer := NewRoundRobin([]*Backend{backend1})
+	backend1.IncrementConnections()
+
+	// Вывод без таймаута отменен и начат заново: у обоих нулевой срок
+	first := make(chan DrainResult, 1)
+	if err := balancer.DrainBackend(backend1.URL, 0, func(r DrainResult) { first <- r }); err != nil {
+		t.Fatalf("Ошибка вывода бэкенда: %v", err)
+	}
+	if !balancer.CancelDrain(backend1.URL) {
+		t.Fatalf("Вывод бэкенда не отменен")
+	}
+	second := make(chan DrainResult, 1)
+	if err := balancer.DrainBackend(backend1.URL, 0, func(r DrainResult) { second <- r }); err != nil {
+		t.Fatalf("Ошибка повторного вывода бэкенда: %v", err)
+	}
+
+	// Отмененный вывод завершается, не дожидаясь запросов
+	time.Sleep(2 * drainPollInterval)
+	backend1.DecrementConnections()
+	select {
+	case <-second:
+	case <-time.After(time.Second):
+		t.Fatalf("Бэкенд не удален после завершения запросов")
+	}
+	select {
+	case result := <-first:
+		t.Errorf("Отмененный вывод завершил удаление: %+v", result)
+	default:
+	}
+}
+
+func TestDrainBackendTimeout(t *testing.T) {
+	backend1 := &Backend{URL: "http://server1:8080", IsAlive: true}
+	balancer := NewRoundRobin([]*Backend{backend1})
+	backend1.IncrementConnections()
+
+	results := make(chan DrainResult, 1)
+	if err := balancer.DrainBackend(backend1.URL, 50*time.Millisecond, func(r DrainResult) { results <- r }); err != nil {
+		t.Fatalf("Ошибка вывода бэкенда: %v", err)
+	}
+
+	select {
+	case result := <-results:
+		if result.Remaining != 1 || len(balancer.Backends()) != 0 {
+			t.Errorf("Неверный итог вывода по таймауту: %+v", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Бэкенд не удален по таймауту")
+	}
+}
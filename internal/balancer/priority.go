@@ -0,0 +1,22 @@
+package balancer
+
+import (
+	. "github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
+)
+
+// activeTier возвращает наименьший уровень приоритета среди доступных
+// бэкендов. Запросы направляются только на бэкенды этого уровня, бэкенды
+// следующих уровней получают запросы, когда недоступны все предыдущие.
+// false - доступных бэкендов нет
+func activeTier(backends []*Backend) (int, bool) {
+	tier, found := 0, false
+	for _, b := range backends {
+		if !b.Available() {
+			continue
+		}
+		if p := b.GetPriority(); !found || p < tier {
+			tier, found = p, true
+		}
+	}
+	return tier, found
+}
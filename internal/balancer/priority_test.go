@@ -0,0 +1,46 @@
+package balancer
+
+import (
+	"testing"
+
+	. "github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
+)
+
+func TestPriorityTiers(t *testing.T) {
+	constructors := map[string]func([]*Backend) Balancer{
+		"round-robin":          func(b []*Backend) Balancer { return NewRoundRobin(b) },
+		"weighted-round-robin": func(b []*Backend) Balancer { return NewWeightedRoundRobin(b) },
+		"random":               func(b []*Backend) Balancer { return NewRandom(b) },
+	}
+	for name, newBalancer := range constructors {
+		t.Run(name, func(t *testing.T) {
+			primary := []*Backend{
+				{URL: "http://primary1:8080", IsAlive: true, Priority: 10},
+				{URL: "http://primary2:8080", IsAlive: true, Priority: 10},
+			}
+			backup := &Backend{URL: "http://backup:8080", IsAlive: true, Priority: 20}
+			bal := newBalancer([]*Backend{backup, primary[0], primary[1]})
+
+			for i := 0; i < 10; i++ {
+				if b := bal.NextBackend(); b == nil || b.GetPriority() != 10 {
+					t.Fatalf("Запрос направлен не на бэкенд основного уровня: %+v", b)
+				}
+			}
+
+			// Резервный уровень используется, только когда недоступен весь основной
+			bal.MarkBackendDown(primary[0].URL)
+			if b := bal.NextBackend(); b != primary[1] {
+				t.Fatalf("Ожидался оставшийся бэкенд основного уровня, получен %+v", b)
+			}
+			bal.MarkBackendDown(primary[1].URL)
+			if b := bal.NextBackend(); b != backup {
+				t.Fatalf("Ожидался резервный бэкенд, получен %+v", b)
+			}
+
+			bal.MarkBackendDown(backup.URL)
+			if b := bal.NextBackend(); b != nil {
+				t.Errorf("Без доступных бэкендов ожидался nil, получен %+v", b)
+			}
+		})
+	}
+}
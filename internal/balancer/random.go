@@ -1,8 +1,10 @@
 package balancer
 
 import (
-	. "github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
 	"math/rand/v2"
+	"time"
+
+	. "github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
 )
 
 type Random struct {
@@ -17,26 +19,45 @@ func NewRandom(backends []*Backend) *Random {
 	}
 }
 
+// NextBackend выбирает доступный бэкенд случайно и равновероятно; веса
+// бэкендов не учитываются. Бэкенд в окне плавного старта выбирается
+// реже пропорционально доле веса
 func (r *Random) NextBackend() *Backend {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	backAlive := make([]*Backend, 0)
+	tier, ok := activeTier(r.backends)
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	backAlive := make([]*Backend, 0, len(r.backends))
+	weights := make([]float64, 0, len(r.backends))
+	var total float64
 
 	for _, b := range r.backends {
-		b.Mu.RLock()
-		if b.IsAlive {
+		if b.Available() && b.GetPriority() == tier {
+			weight := r.slowStartFactor(b, now)
 			backAlive = append(backAlive, b)
+			weights = append(weights, weight)
+			total += weight
 		}
-		b.Mu.RUnlock()
 	}
 
 	if len(backAlive) == 0 {
 		return nil
 	}
 
-	indexBE := rand.N(len(backAlive))
+	point := rand.Float64() * total
+	indexBE := len(backAlive) - 1
+	for i, weight := range weights {
+		if point < weight {
+			indexBE = i
+			break
+		}
+		point -= weight
+	}
+
 	backAlive[indexBE].IncrementConnections()
 	return backAlive[indexBE]
-
 }
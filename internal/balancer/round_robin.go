@@ -28,7 +28,8 @@ func (r *RoundRobin) NextBackend() *Backend {
 	defer r.mu.RUnlock()
 
 	// Если нет доступных бэкендов, возвращаем nil
-	if len(r.backends) == 0 {
+	tier, ok := activeTier(r.backends)
+	if !ok {
 		return nil
 	}
 
@@ -40,12 +41,9 @@ func (r *RoundRobin) NextBackend() *Backend {
 		idx := (next + i) % uint32(len(r.backends))
 		backend := r.backends[idx]
 
-		// Проверяем, что бэкенд доступен
-		backend.Mu.RLock()
-		isAlive := backend.IsAlive
-		backend.Mu.RUnlock()
-
-		if isAlive {
+		// Проверяем, что бэкенд доступен, не выведен из работы
+		// и относится к действующему уровню приоритета
+		if backend.Available() && backend.GetPriority() == tier {
 			// Инкрементируем счетчик соединений для выбранного бэкенда
 			backend.IncrementConnections()
 			return backend
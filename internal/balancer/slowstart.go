@@ -0,0 +1,63 @@
+package balancer
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	. "github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
+)
+
+// SlowStart описывает плавный ввод бэкенда в работу: после добавления
+// в пул или восстановления его эффективный вес растет за Window от доли
+// MinFactor до полного веса. Curve - показатель степени кривой роста:
+// 1 - линейный рост, больше 1 - медленнее в начале окна, меньше 1 - быстрее
+type SlowStart struct {
+	Window    time.Duration
+	MinFactor float64
+	Curve     float64
+}
+
+// Validate проверяет корректность параметров плавного старта
+func (s SlowStart) Validate() error {
+	if s.Window < 0 {
+		return fmt.Errorf("окно плавного старта не может быть отрицательным")
+	}
+	if s.Window == 0 {
+		return nil
+	}
+	if s.MinFactor <= 0 || s.MinFactor > 1 {
+		return fmt.Errorf("начальная доля веса должна быть в интервале (0, 1], получено %v", s.MinFactor)
+	}
+	if s.Curve <= 0 {
+		return fmt.Errorf("показатель кривой плавного старта должен быть положительным, получено %v", s.Curve)
+	}
+	return nil
+}
+
+// factor возвращает долю полного веса через elapsed после ввода в работу
+func (s SlowStart) factor(elapsed time.Duration) float64 {
+	if s.Window <= 0 || elapsed >= s.Window {
+		return 1
+	}
+	progress := math.Max(0, float64(elapsed)/float64(s.Window))
+	return s.MinFactor + (1-s.MinFactor)*math.Pow(progress, s.Curve)
+}
+
+// SetSlowStart включает плавный старт для бэкендов, добавленных или
+// восстановленных после вызова. Вызывается до начала обработки запросов
+func (bb *BaseBalancer) SetSlowStart(s SlowStart) {
+	bb.slowStart = s
+}
+
+// EffectiveWeight возвращает вес бэкенда с учетом плавного старта.
+// Вес меньше 1 считается равным 1
+func (bb *BaseBalancer) EffectiveWeight(backend *Backend, now time.Time) float64 {
+	weight := float64(max(1, backend.GetWeight()))
+	return weight * bb.slowStartFactor(backend, now)
+}
+
+// slowStartFactor возвращает долю полного веса бэкенда в окне плавного старта
+func (bb *BaseBalancer) slowStartFactor(backend *Backend, now time.Time) float64 {
+	return bb.slowStart.factor(now.Sub(backend.WarmupStart()))
+}
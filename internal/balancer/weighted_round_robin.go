@@ -0,0 +1,81 @@
+package balancer
+
+import (
+	"sync"
+	"time"
+
+	. "github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
+)
+
+// WeightedRoundRobin реализует плавный взвешенный Round-Robin: бэкенд
+// с весом 3 получает втрое больше запросов, чем бэкенд с весом 1,
+// и запросы к нему перемежаются с запросами к остальным
+type WeightedRoundRobin struct {
+	BaseBalancer
+	current map[*Backend]float64 // Текущие веса алгоритма
+	wmu     sync.Mutex           // Защищает current
+}
+
+// NewWeightedRoundRobin создает новый экземпляр взвешенного Round-Robin
+func NewWeightedRoundRobin(backends []*Backend) *WeightedRoundRobin {
+	return &WeightedRoundRobin{
+		BaseBalancer: BaseBalancer{
+			backends: backends,
+		},
+		current: make(map[*Backend]float64),
+	}
+}
+
+// NextBackend возвращает доступный бэкенд с наибольшим текущим весом.
+// Каждый вызов увеличивает текущие веса на эффективные веса бэкендов,
+// а у выбранного уменьшает на их сумму
+func (r *WeightedRoundRobin) NextBackend() *Backend {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	r.wmu.Lock()
+	defer r.wmu.Unlock()
+
+	// Забываем бэкенды, удаленные из пула
+	known := 0
+	for _, backend := range r.backends {
+		if _, ok := r.current[backend]; ok {
+			known++
+		}
+	}
+	if known < len(r.current) {
+		current := make(map[*Backend]float64, len(r.backends))
+		for _, backend := range r.backends {
+			if weight, ok := r.current[backend]; ok {
+				current[backend] = weight
+			}
+		}
+		r.current = current
+	}
+
+	tier, ok := activeTier(r.backends)
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	var selected *Backend
+	var total float64
+	for _, backend := range r.backends {
+		if !backend.Available() || backend.GetPriority() != tier {
+			continue
+		}
+		weight := r.EffectiveWeight(backend, now)
+		r.current[backend] += weight
+		total += weight
+		if selected == nil || r.current[backend] > r.current[selected] {
+			selected = backend
+		}
+	}
+
+	if selected == nil {
+		return nil
+	}
+	r.current[selected] -= total
+	selected.IncrementConnections()
+	return selected
+}
@@ -0,0 +1,112 @@
+package balancer
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
+)
+
+func TestWeightedRoundRobin(t *testing.T) {
+	backend1 := &Backend{URL: "http://server1:8080", Weight: 1, IsAlive: true}
+	backend2 := &Backend{URL: "http://server2:8080", Weight: 3, IsAlive: true}
+	balancer := NewWeightedRoundRobin([]*Backend{backend1, backend2})
+
+	counts := make(map[*Backend]int)
+	for i := 0; i < 40; i++ {
+		selected := balancer.NextBackend()
+		if selected == nil {
+			t.Fatalf("Ожидался бэкенд, получен nil")
+		}
+		counts[selected]++
+	}
+	if counts[backend1] != 10 || counts[backend2] != 30 {
+		t.Errorf("Запросы распределены не по весам: %d и %d", counts[backend1], counts[backend2])
+	}
+
+	// Недоступный бэкенд пропускается
+	balancer.MarkBackendDown(backend2.URL)
+	for i := 0; i < 3; i++ {
+		if balancer.NextBackend() != backend1 {
+			t.Errorf("Выбран недоступный бэкенд")
+		}
+	}
+
+	// Удаленный бэкенд забывается, даже если пул не уменьшился
+	balancer.RemoveBackend(backend2.URL)
+	backend3 := &Backend{URL: "http://server3:8080", Weight: 1, IsAlive: true}
+	if err := balancer.AddBackend(backend3); err != nil {
+		t.Fatalf("Ошибка добавления бэкенда: %v", err)
+	}
+	balancer.NextBackend()
+	if _, ok := balancer.current[backend2]; ok || len(balancer.current) != 2 {
+		t.Errorf("Текущий вес удаленного бэкенда не забыт: %v", balancer.current)
+	}
+}
+
+func TestRandomIgnoresWeights(t *testing.T) {
+	backend1 := &Backend{URL: "http://server1:8080", Weight: 1, IsAlive: true}
+	backend2 := &Backend{URL: "http://server2:8080", Weight: 9, IsAlive: true}
+	balancer := NewRandom([]*Backend{backend1, backend2})
+
+	counts := make(map[*Backend]int)
+	for i := 0; i < 10000; i++ {
+		counts[balancer.NextBackend()]++
+	}
+	if counts[backend1] < 4500 || counts[backend1] > 5500 {
+		t.Errorf("Бэкенды должны выбираться равновероятно: %d и %d", counts[backend1], counts[backend2])
+	}
+}
+
+func TestSlowStartFactor(t *testing.T) {
+	linear := SlowStart{Window: 10 * time.Second, MinFactor: 0.1, Curve: 1}
+	quadratic := SlowStart{Window: 10 * time.Second, MinFactor: 0.1, Curve: 2}
+
+	tests := []struct {
+		slowStart SlowStart
+		elapsed   time.Duration
+		want      float64
+	}{
+		{linear, 0, 0.1},
+		{linear, 5 * time.Second, 0.55},
+		{linear, 10 * time.Second, 1},
+		{linear, time.Hour, 1},
+		{quadratic, 5 * time.Second, 0.325},
+		{SlowStart{}, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := tt.slowStart.factor(tt.elapsed); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%+v через %v: ожидалась доля %v, получено %v", tt.slowStart, tt.elapsed, tt.want, got)
+		}
+	}
+}
+
+func TestSlowStartOnAddAndRecovery(t *testing.T) {
+	backend1 := &Backend{URL: "http://server1:8080", Weight: 1, IsAlive: true}
+	balancer := NewWeightedRoundRobin([]*Backend{backend1})
+	balancer.SetSlowStart(SlowStart{Window: time.Hour, MinFactor: 0.1, Curve: 1})
+
+	// Добавленный бэкенд сначала получает около десятой доли своего веса
+	backend2 := &Backend{URL: "http://server2:8080", Weight: 1}
+	if err := balancer.AddBackend(backend2); err != nil {
+		t.Fatalf("Ошибка добавления бэкенда: %v", err)
+	}
+	counts := make(map[*Backend]int)
+	for i := 0; i < 110; i++ {
+		counts[balancer.NextBackend()]++
+	}
+	if counts[backend2] < 8 || counts[backend2] > 12 {
+		t.Errorf("Новый бэкенд получил %d запросов из 110, ожидалось около 10", counts[backend2])
+	}
+
+	// Начальные бэкенды работают с полным весом, пока не восстановятся после сбоя
+	if w := balancer.EffectiveWeight(backend1, time.Now()); w != 1 {
+		t.Errorf("Начальный бэкенд должен иметь полный вес, получено %v", w)
+	}
+	balancer.MarkBackendDown(backend1.URL)
+	balancer.MarkBackendUp(backend1.URL)
+	if w := balancer.EffectiveWeight(backend1, time.Now()); w > 0.11 {
+		t.Errorf("Восстановленный бэкенд должен начинать с малого веса, получено %v", w)
+	}
+}
@@ -1,18 +1,130 @@
 package config
 
 import (
-	"encoding/json"
+	"fmt"
 	"os"
+	"reflect"
 	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/discovery"
 )
 
 // Config представляет основную конфигурацию приложения
 type Config struct {
 	Server       ServerConfig      `json:"server"`
 	Backends     []BackendConfig   `json:"backends"`
+	Discovery    DiscoveryConfig   `json:"discovery"`
 	BalancerType string            `json:"balancer_type"`
+	DrainTimeout Duration          `json:"drain_timeout"` // Ожидание завершения запросов удаляемого бэкенда
+	SlowStart    SlowStartConfig   `json:"slow_start"`
 	RateLimit    RateLimitConfig   `json:"rate_limit"`
 	HealthCheck  HealthCheckConfig `json:"health_check"`
+	Admin        AdminConfig       `json:"admin"`
+	Access       AccessConfig      `json:"access"`
+
+	secrets map[string]string // Поля, полученные по ссылкам $file и $env, и описания ссылок
+}
+
+// DiscoveryConfig содержит источники обнаружения бэкендов. Найденные
+// бэкенды добавляются в пул к заданным в backends
+type DiscoveryConfig struct {
+	DNS        []DNSDiscoveryConfig        `json:"dns,omitempty"`
+	Files      []FileDiscoveryConfig       `json:"files,omitempty"`
+	Docker     []DockerDiscoveryConfig     `json:"docker,omitempty"`
+	Kubernetes []KubernetesDiscoveryConfig `json:"kubernetes,omitempty"`
+}
+
+// DNSDiscoveryConfig содержит настройки обнаружения бэкендов по DNS.
+// Записи перечитываются по истечении TTL в границах min_interval и max_interval
+type DNSDiscoveryConfig struct {
+	Name        string   `json:"name"`         // Имя хоста или SRV-записи
+	Type        string   `json:"type"`         // a - записи A и AAAA, srv - записи SRV
+	Port        int      `json:"port"`         // Порт бэкендов для записей A и AAAA
+	Scheme      string   `json:"scheme"`       // http или https
+	Weight      int      `json:"weight"`       // Вес бэкендов для записей A и AAAA
+	Priority    int      `json:"priority"`     // Уровень приоритета бэкендов для записей A и AAAA
+	Server      string   `json:"server"`       // DNS-сервер host:port; пусто - из /etc/resolv.conf
+	MinInterval Duration `json:"min_interval"` // Наименьший период обновления
+	MaxInterval Duration `json:"max_interval"` // Наибольший период обновления
+}
+
+// FileDiscoveryConfig содержит настройки обнаружения бэкендов по файлу
+// со списком, который ведут внешние скрипты
+type FileDiscoveryConfig struct {
+	Path     string   `json:"path"`
+	Format   string   `json:"format"`   // json или yaml; пусто - по расширению файла
+	Interval Duration `json:"interval"` // Период проверки изменения файла
+}
+
+// DockerDiscoveryConfig содержит настройки обнаружения бэкендов среди
+// контейнеров Docker с меткой lb.pool. Порт, вес и приоритет задаются
+// метками lb.port, lb.weight и lb.priority или значениями по умолчанию
+type DockerDiscoveryConfig struct {
+	Socket        string   `json:"socket"`         // Unix-сокет Docker Engine API
+	Pool          string   `json:"pool"`           // Значение метки lb.pool
+	Network       string   `json:"network"`        // Сеть контейнеров; пусто - первая по имени
+	Port          int      `json:"port"`           // Порт контейнеров без метки lb.port
+	Scheme        string   `json:"scheme"`         // http или https
+	Weight        int      `json:"weight"`         // Вес контейнеров без метки lb.weight
+	Priority      int      `json:"priority"`       // Приоритет контейнеров без метки lb.priority
+	RetryInterval Duration `json:"retry_interval"` // Пауза перед повторным подключением
+}
+
+// KubernetesDiscoveryConfig содержит настройки обнаружения бэкендов по
+// EndpointSlice сервиса Kubernetes. Без kubeconfig используется
+// сервисный аккаунт пода
+type KubernetesDiscoveryConfig struct {
+	Namespace      string   `json:"namespace"`       // Пусто - из kubeconfig или пода
+	Service        string   `json:"service"`         // Имя сервиса
+	PortName       string   `json:"port_name"`       // Имя порта; пусто - первый порт
+	Scheme         string   `json:"scheme"`          // http или https
+	Weight         int      `json:"weight"`          // Вес бэкендов
+	Priority       int      `json:"priority"`        // Уровень приоритета бэкендов
+	Kubeconfig     string   `json:"kubeconfig"`      // Путь к kubeconfig
+	ResyncInterval Duration `json:"resync_interval"` // Период полного перечитывания
+	RetryInterval  Duration `json:"retry_interval"`  // Пауза перед повторным подключением
+}
+
+// SlowStartConfig содержит настройки плавного ввода в работу добавленных
+// и восстановленных бэкендов для алгоритмов, учитывающих вес
+type SlowStartConfig struct {
+	Window    Duration `json:"window"`     // Длительность разгона; 0 - без плавного старта
+	MinWeight float64  `json:"min_weight"` // Начальная доля веса
+	Curve     float64  `json:"curve"`      // Показатель степени кривой роста; 1 - линейный
+}
+
+// AccessConfig содержит глобальный список доступа и списки маршрутов
+type AccessConfig struct {
+	AccessListConfig
+	BypassRateLimit bool                `json:"bypass_rate_limit"` // Явно разрешенные адреса не ограничиваются rate limiting
+	ReloadInterval  Duration            `json:"reload_interval"`   // Период проверки изменения файлов
+	Routes          []AccessRouteConfig `json:"routes,omitempty"`
+}
+
+// AccessListConfig содержит адреса и подсети (IPv4 и IPv6) списка доступа.
+// Правило с самым длинным префиксом имеет приоритет
+type AccessListConfig struct {
+	Allow       []string `json:"allow,omitempty"`
+	Deny        []string `json:"deny,omitempty"`
+	AllowFile   string   `json:"allow_file"`   // Файл с адресами, по одному в строке
+	DenyFile    string   `json:"deny_file"`    // Файл с адресами, по одному в строке
+	DefaultDeny bool     `json:"default_deny"` // Запрещать адреса, не подходящие ни под одно правило
+}
+
+// AccessRouteConfig содержит список доступа маршрута
+type AccessRouteConfig struct {
+	Name    string   `json:"name"`
+	Path    string   `json:"path"`
+	Methods []string `json:"methods,omitempty"`
+	Host    string   `json:"host"`
+	AccessListConfig
+}
+
+// AdminConfig содержит настройки административного API
+type AdminConfig struct {
+	Enabled bool   `json:"enabled"`
+	Port    int    `json:"port"`
+	Token   string `json:"token" secret:"true"` // Токен доступа, передается в заголовке Authorization: Bearer
 }
 
 // ServerConfig содержит настройки HTTP-сервера
@@ -29,29 +141,152 @@ type BackendConfig struct {
 
 // RateLimitConfig содержит настройки ограничения частоты запросов
 type RateLimitConfig struct {
-	Enabled         bool    `json:"enabled"`
-	DefaultRate     float64 `json:"default_rate"`
-	DefaultCapacity int     `json:"default_capacity"`
+	Enabled         bool                `json:"enabled"`
+	Algorithm       string              `json:"algorithm"` // Алгоритм по умолчанию
+	DefaultRate     float64             `json:"default_rate"`
+	DefaultCapacity int                 `json:"default_capacity"`
+	Clients         []ClientLimitConfig `json:"clients,omitempty"` // Индивидуальные политики клиентов
+	ResponseFormat  string              `json:"response_format"`   // Формат тела ответа 429: text или json
+	Store           StoreConfig         `json:"store"`
+	ClientTTL       Duration            `json:"client_ttl"`  // Время простоя до вытеснения клиента
+	MaxClients      int                 `json:"max_clients"` // Максимум отслеживаемых клиентов: делится поровну между 64 шардами, не жесткий предел
+	Distributed     DistributedConfig   `json:"distributed"`
+	Concurrency     ConcurrencyConfig   `json:"concurrency"`
+	Routes          []RouteLimitConfig  `json:"routes,omitempty"` // Политики маршрутов, применяются вместе с общим лимитом
+	Quotas          []QuotaConfig       `json:"quotas,omitempty"` // Календарные квоты клиентов
+	Shadow          bool                `json:"shadow"`           // Теневой режим общей политики
+	ShadowWindow    Duration            `json:"shadow_window"`    // Окно статистики теневого режима
+	Ban             BanConfig           `json:"ban"`
+}
+
+// BanConfig содержит настройки временной блокировки клиентов,
+// которые продолжают отправлять запросы после отказов
+type BanConfig struct {
+	Enabled       bool     `json:"enabled"`
+	MaxRejections int      `json:"max_rejections"` // Отказов за окно до блокировки
+	Window        Duration `json:"window"`         // Окно подсчета отказов
+	Duration      Duration `json:"duration"`       // Длительность первой блокировки
+	MaxDuration   Duration `json:"max_duration"`   // Предел удвоения длительности
+	ForgetAfter   Duration `json:"forget_after"`   // Через сколько времени без блокировок эскалация сбрасывается
+}
+
+// QuotaConfig содержит квоту запросов клиента на сутки или месяц
+type QuotaConfig struct {
+	Name     string           `json:"name"`
+	Period   string           `json:"period"` // daily или monthly
+	Limit    int64            `json:"limit"`
+	Timezone string           `json:"timezone"`          // Часовой пояс границы периода, по умолчанию UTC
+	ResetAt  string           `json:"reset_at"`          // Время сброса в формате ЧЧ:ММ, по умолчанию 00:00
+	ResetDay int              `json:"reset_day"`         // День месяца сброса месячной квоты, по умолчанию 1
+	Clients  map[string]int64 `json:"clients,omitempty"` // Индивидуальные лимиты клиентов
+}
+
+// RouteLimitConfig содержит политику rate limiting для маршрута.
+// Без capacity политика не заводит своих бакетов, а только задает
+// стоимость запроса в общем бакете клиента
+type RouteLimitConfig struct {
+	Name      string   `json:"name"`
+	Path      string   `json:"path"`              // Префикс пути
+	Methods   []string `json:"methods,omitempty"` // Пусто - любой метод
+	Host      string   `json:"host"`              // Пусто - любой хост
+	Cost      int      `json:"cost"`              // Стоимость запроса в токенах, по умолчанию 1
+	Algorithm string   `json:"algorithm"`
+	Capacity  int      `json:"capacity"`
+	Rate      float64  `json:"rate"`
+	Shadow    bool     `json:"shadow"` // Теневой режим: отказы только логируются и учитываются
+}
+
+// ConcurrencyConfig содержит ограничение одновременных запросов одного клиента
+type ConcurrencyConfig struct {
+	MaxInFlight  int      `json:"max_in_flight"` // Максимум запросов в работе; 0 - без ограничения
+	QueueTimeout Duration `json:"queue_timeout"` // Ожидание свободного слота; 0 - отклонять сразу
+	Status       int      `json:"status"`        // HTTP-статус ответа при превышении лимита
+}
+
+// DistributedConfig содержит настройки общего для реплик хранилища лимитов (Redis)
+type DistributedConfig struct {
+	Enabled   bool     `json:"enabled"`
+	Address   string   `json:"address"`
+	Password  string   `json:"password" secret:"true"`
+	DB        int      `json:"db"`
+	KeyPrefix string   `json:"key_prefix"`
+	Timeout   Duration `json:"timeout"`  // Таймаут запроса к хранилищу
+	OnError   string   `json:"on_error"` // Поведение при недоступности: local, open или closed
+}
+
+// ClientLimitConfig содержит индивидуальную политику rate limiting клиента
+type ClientLimitConfig struct {
+	ID        string  `json:"id"`
+	Algorithm string  `json:"algorithm"`
+	Capacity  int     `json:"capacity"`
+	Rate      float64 `json:"rate"`
+}
+
+// StoreConfig содержит настройки постоянного хранилища состояний клиентов
+type StoreConfig struct {
+	Path             string   `json:"path"`              // Путь к файлу базы; пустой путь отключает хранилище
+	SnapshotInterval Duration `json:"snapshot_interval"` // Период сохранения уровня токенов
 }
 
 // HealthCheckConfig содержит настройки проверки доступности бэкендов
 type HealthCheckConfig struct {
-	Interval time.Duration `json:"interval"`
-	Timeout  time.Duration `json:"timeout"`
+	Interval Duration `json:"interval"`
+	Timeout  Duration `json:"timeout"`
+}
+
+// Source описывает источники конфигурации. Значения применяются слоями:
+// значения по умолчанию, файл, переменные окружения, флаги
+type Source struct {
+	Path   string
+	Format string   // json, yaml или toml; пусто - по расширению файла
+	Env    []string // Переменные окружения вида ИМЯ=значение, см. EnvPrefix
+	Flags  []string // Переопределения вида путь=значение, например server.port=9000
 }
 
-// LoadConfig загружает конфигурацию из JSON-файла
+// LoadConfig загружает конфигурацию из файла, формат определяется
+// по расширению
 func LoadConfig(path string) (*Config, error) {
-	file, err := os.Open(path)
+	return Source{Path: path}.Load()
+}
+
+// Load загружает конфигурацию, заполняет значения по умолчанию и проверяет ее.
+// Неизвестные поля и некорректные значения возвращаются как *ValidationError
+func (s Source) Load() (*Config, error) {
+	config, _, err := s.LoadWithOrigins()
+	return config, err
+}
+
+// LoadWithOrigins загружает конфигурацию и возвращает источник каждого значения
+func (s Source) LoadWithOrigins() (*Config, Origins, error) {
+	path, format := s.Path, s.Format
+	if format == "" {
+		var err error
+		if format, err = DetectFormat(path); err != nil {
+			return nil, nil, err
+		}
+	}
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if data, err = toJSON(data, format); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	raw, err := parse(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
 	}
-	defer file.Close()
 
-	var config Config
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
-		return nil, err
+	origins := make(Origins)
+	fileOrigins(raw, path, origins)
+	v := &validator{}
+	raw = s.applyOverrides(v, raw, origins)
+	secrets := make(map[string]string)
+	raw = s.resolveSecrets(v, "", raw, reflect.TypeOf(Config{}), secrets)
+
+	config := Config{secrets: secrets}
+	if err := decode(v, raw, &config); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, annotate(err, origins))
 	}
 
 	// Установка значений по умолчанию, если они не указаны
@@ -61,18 +296,148 @@ func LoadConfig(path string) (*Config, error) {
 	if config.BalancerType == "" {
 		config.BalancerType = "round-robin"
 	}
+	if config.DrainTimeout == 0 {
+		config.DrainTimeout = Duration(30 * time.Second)
+	}
+	if config.SlowStart.MinWeight == 0 {
+		config.SlowStart.MinWeight = 0.1
+	}
+	if config.SlowStart.Curve == 0 {
+		config.SlowStart.Curve = 1
+	}
+	if config.RateLimit.Algorithm == "" {
+		config.RateLimit.Algorithm = "token_bucket"
+	}
+	if config.RateLimit.ResponseFormat == "" {
+		config.RateLimit.ResponseFormat = "text"
+	}
 	if config.RateLimit.DefaultRate == 0 {
 		config.RateLimit.DefaultRate = 10
 	}
 	if config.RateLimit.DefaultCapacity == 0 {
 		config.RateLimit.DefaultCapacity = 100
 	}
+	if config.RateLimit.ClientTTL == 0 {
+		config.RateLimit.ClientTTL = Duration(10 * time.Minute)
+	}
+	if config.RateLimit.MaxClients == 0 {
+		config.RateLimit.MaxClients = 100000
+	}
+	if config.RateLimit.Distributed.Address == "" {
+		config.RateLimit.Distributed.Address = "localhost:6379"
+	}
+	if config.RateLimit.Distributed.KeyPrefix == "" {
+		config.RateLimit.Distributed.KeyPrefix = "lb:rl:"
+	}
+	if config.RateLimit.Distributed.Timeout == 0 {
+		config.RateLimit.Distributed.Timeout = Duration(100 * time.Millisecond)
+	}
+	if config.RateLimit.Distributed.OnError == "" {
+		config.RateLimit.Distributed.OnError = "local"
+	}
+	for i := range config.RateLimit.Quotas {
+		if config.RateLimit.Quotas[i].Timezone == "" {
+			config.RateLimit.Quotas[i].Timezone = "UTC"
+		}
+		if config.RateLimit.Quotas[i].ResetAt == "" {
+			config.RateLimit.Quotas[i].ResetAt = "00:00"
+		}
+		if config.RateLimit.Quotas[i].ResetDay == 0 {
+			config.RateLimit.Quotas[i].ResetDay = 1
+		}
+	}
+	for i := range config.Discovery.DNS {
+		dns := &config.Discovery.DNS[i]
+		if dns.Type == "" {
+			dns.Type = discovery.DNSTypeA
+		}
+		if dns.Scheme == "" {
+			dns.Scheme = "http"
+		}
+		if dns.MinInterval == 0 {
+			dns.MinInterval = Duration(time.Second)
+		}
+		if dns.MaxInterval == 0 {
+			dns.MaxInterval = Duration(5 * time.Minute)
+		}
+	}
+	for i := range config.Discovery.Files {
+		file := &config.Discovery.Files[i]
+		if file.Format == "" {
+			file.Format, _ = DetectFormat(file.Path)
+		}
+		if file.Interval == 0 {
+			file.Interval = Duration(5 * time.Second)
+		}
+	}
+	for i := range config.Discovery.Docker {
+		docker := &config.Discovery.Docker[i]
+		if docker.Socket == "" {
+			docker.Socket = "/var/run/docker.sock"
+		}
+		if docker.Scheme == "" {
+			docker.Scheme = "http"
+		}
+		if docker.RetryInterval == 0 {
+			docker.RetryInterval = Duration(5 * time.Second)
+		}
+	}
+	for i := range config.Discovery.Kubernetes {
+		kube := &config.Discovery.Kubernetes[i]
+		if kube.Scheme == "" {
+			kube.Scheme = "http"
+		}
+		if kube.ResyncInterval == 0 {
+			kube.ResyncInterval = Duration(5 * time.Minute)
+		}
+		if kube.RetryInterval == 0 {
+			kube.RetryInterval = Duration(5 * time.Second)
+		}
+	}
+	for i := range config.RateLimit.Routes {
+		if config.RateLimit.Routes[i].Cost == 0 {
+			config.RateLimit.Routes[i].Cost = 1
+		}
+	}
+	if config.RateLimit.ShadowWindow == 0 {
+		config.RateLimit.ShadowWindow = Duration(10 * time.Minute)
+	}
+	if config.RateLimit.Ban.MaxRejections == 0 {
+		config.RateLimit.Ban.MaxRejections = 100
+	}
+	if config.RateLimit.Ban.Window == 0 {
+		config.RateLimit.Ban.Window = Duration(time.Minute)
+	}
+	if config.RateLimit.Ban.Duration == 0 {
+		config.RateLimit.Ban.Duration = Duration(time.Minute)
+	}
+	if config.RateLimit.Ban.MaxDuration == 0 {
+		config.RateLimit.Ban.MaxDuration = Duration(24 * time.Hour)
+	}
+	if config.RateLimit.Ban.ForgetAfter == 0 {
+		config.RateLimit.Ban.ForgetAfter = Duration(24 * time.Hour)
+	}
+	if config.RateLimit.Concurrency.Status == 0 {
+		config.RateLimit.Concurrency.Status = 503
+	}
+	if config.RateLimit.Store.SnapshotInterval == 0 {
+		config.RateLimit.Store.SnapshotInterval = Duration(30 * time.Second)
+	}
+	if config.Access.ReloadInterval == 0 {
+		config.Access.ReloadInterval = Duration(5 * time.Second)
+	}
+	if config.Admin.Port == 0 {
+		config.Admin.Port = 9090
+	}
 	if config.HealthCheck.Interval == 0 {
-		config.HealthCheck.Interval = 10
+		config.HealthCheck.Interval = Duration(10 * time.Second)
 	}
 	if config.HealthCheck.Timeout == 0 {
-		config.HealthCheck.Timeout = 2
+		config.HealthCheck.Timeout = Duration(2 * time.Second)
 	}
 
-	return &config, nil
+	if err := config.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, annotate(redactErrors(err, &config), origins))
+	}
+	return &config, origins, nil
 }
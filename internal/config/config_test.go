@@ -0,0 +1,205 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// load записывает конфигурацию во временный файл и загружает ее
+func load(t *testing.T, content string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Не удалось записать конфигурацию: %v", err)
+	}
+	return LoadConfig(path)
+}
+
+// paths возвращает пути полей из ошибки проверки
+func paths(t *testing.T, err error) []string {
+	t.Helper()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Ожидалась ошибка проверки, получено %v", err)
+	}
+	var paths []string
+	for _, fe := range verr.Errors {
+		paths = append(paths, fe.Path)
+	}
+	return paths
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := load(t, `{"backends": [{"url": "http://localhost:8001"}]}`)
+	if err != nil {
+		t.Fatalf("Ошибка загрузки: %v", err)
+	}
+	if cfg.Server.Port != 8080 || cfg.BalancerType != "round-robin" || cfg.RateLimit.Algorithm != "token_bucket" {
+		t.Errorf("Не применены значения по умолчанию: %+v", cfg)
+	}
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	_, err := load(t, `{
+		"server": {"port": 70000},
+		"balancer_type": "least-connections",
+		"backends": [
+			{"url": "localhost:8001", "weight": -1},
+			{"url": "http://localhost:8002"},
+			{"url": "http://localhost:8002"}
+		],
+		"rate_limit": {
+			"routes": [{"name": "api", "path": "/api", "cost": 5, "capacity": 2}, {"name": "api"}],
+			"quotas": [{"name": "daily", "period": "daily", "limit": 10, "reset_at": "25:00"}]
+		},
+		"access": {"deny": ["10.0.0.0/33"]},
+		"admin": {"enabled": true}
+	}`)
+
+	want := []string{
+		"server.port",
+		"backends[0].url",
+		"backends[0].weight",
+		"backends[2].url",
+		"balancer_type",
+		"rate_limit.routes[0].cost",
+		"rate_limit.routes[1].name",
+		"rate_limit.quotas[0].reset_at",
+		"access.deny[0]",
+		"admin.token",
+	}
+	if got := paths(t, err); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Ошибки в полях %v, ожидалось %v\n%v", got, want, err)
+	}
+}
+
+func TestLoadConfigNoBackends(t *testing.T) {
+	_, err := load(t, `{"backends": []}`)
+	if got := paths(t, err); len(got) != 1 || got[0] != "backends" {
+		t.Errorf("Ожидалась ошибка пустого списка бэкендов, получено %v", err)
+	}
+}
+
+func TestLoadConfigDiscovery(t *testing.T) {
+	// С источником discovery список backends может быть пустым
+	cfg, err := load(t, `{"discovery": {"dns": [{"name": "api.service.consul", "port": 8080}]}}`)
+	if err != nil {
+		t.Fatalf("Ошибка загрузки: %v", err)
+	}
+	dns := cfg.Discovery.DNS[0]
+	if dns.Type != "a" || dns.Scheme != "http" || dns.MinInterval.Duration() != time.Second || dns.MaxInterval.Duration() != 5*time.Minute {
+		t.Errorf("Не применены значения по умолчанию: %+v", dns)
+	}
+
+	_, err = load(t, `{"discovery": {"dns": [
+		{"name": "api.test", "type": "srv", "port": 8080, "server": "127.0.0.1"},
+		{"name": "api.test", "type": "mx", "priority": -1, "min_interval": "10s", "max_interval": "5s"}
+	], "files": [{"path": "targets.txt"}, {"path": "targets.yml", "interval": -1}],
+	"docker": [{"pool": "api", "port": 70000}, {"pool": "api", "scheme": "tcp"}],
+	"kubernetes": [{"namespace": "shop"}, {"service": "api", "resync_interval": "-1s"}]}}`)
+	want := []string{
+		"discovery.dns[0].port",
+		"discovery.dns[0].server",
+		"discovery.dns[1].name",
+		"discovery.dns[1].type",
+		"discovery.dns[1].port",
+		"discovery.dns[1].priority",
+		"discovery.dns[1].max_interval",
+		"discovery.files[0].format",
+		"discovery.files[1].interval",
+		"discovery.docker[0].port",
+		"discovery.docker[1].pool",
+		"discovery.docker[1].scheme",
+		"discovery.kubernetes[0].service",
+		"discovery.kubernetes[1].resync_interval",
+	}
+	if got := paths(t, err); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Ошибки в полях %v, ожидалось %v\n%v", got, want, err)
+	}
+}
+
+func TestLoadConfigUnknownFields(t *testing.T) {
+	_, err := load(t, `{
+		"backends": [{"url": "http://localhost:8001", "wieght": 2}],
+		"rate_limit": {"enabled": true, "clients": [{"id": "a", "capacity": 1, "burst": 5}]},
+		"access": {"allow": ["10.0.0.1"], "routes": [{"name": "admin", "default_deny": true, "alow": []}]},
+		"helth_check": {}
+	}`)
+
+	got := paths(t, err)
+	want := map[string]bool{
+		"backends[0].wieght":          true,
+		"rate_limit.clients[0].burst": true,
+		"access.routes[0].alow":       true,
+		"helth_check":                 true,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Неизвестные поля %v, ожидалось %v", got, want)
+	}
+	for _, path := range got {
+		if !want[path] {
+			t.Errorf("Поле %s не должно считаться неизвестным", path)
+		}
+	}
+}
+
+func TestLoadConfigDecodeErrors(t *testing.T) {
+	_, err := load(t, `{"backends": [{"url": "http://localhost:8001", "weight": "heavy"}]}`)
+	if got := paths(t, err); len(got) != 1 || got[0] != "backends[0].weight" {
+		t.Errorf("Ожидалась ошибка типа поля backends[0].weight, получено %v", err)
+	}
+
+	_, err = load(t, "{\n  \"backends\": [\n    {\"url\": \"http://localhost:8001\",}\n  ]\n}")
+	if err == nil || !strings.Contains(err.Error(), "строке 3") {
+		t.Errorf("Ожидалась ошибка синтаксиса с номером строки, получено %v", err)
+	}
+}
+
+func TestLoadConfigDurations(t *testing.T) {
+	cfg, err := load(t, `{
+		"backends": [{"url": "http://localhost:8001"}],
+		"drain_timeout": "1m30s",
+		"health_check": {"interval": 5, "timeout": "500ms"},
+		"rate_limit": {
+			"client_ttl": 0.5,
+			"distributed": {"timeout": 0.25},
+			"concurrency": {"queue_timeout": "50ms"}
+		}
+	}`)
+	if err != nil {
+		t.Fatalf("Ошибка загрузки: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  Duration
+		want time.Duration
+	}{
+		{"drain_timeout", cfg.DrainTimeout, 90 * time.Second},
+		{"health_check.interval", cfg.HealthCheck.Interval, 5 * time.Second},
+		{"health_check.timeout", cfg.HealthCheck.Timeout, 500 * time.Millisecond},
+		{"rate_limit.client_ttl", cfg.RateLimit.ClientTTL, 500 * time.Millisecond},
+		{"rate_limit.distributed.timeout", cfg.RateLimit.Distributed.Timeout, 250 * time.Millisecond},
+		{"rate_limit.concurrency.queue_timeout", cfg.RateLimit.Concurrency.QueueTimeout, 50 * time.Millisecond},
+		{"rate_limit.store.snapshot_interval", cfg.RateLimit.Store.SnapshotInterval, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if tt.got.Duration() != tt.want {
+			t.Errorf("%s = %v, ожидалось %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	_, err = load(t, `{"backends": [{"url": "http://localhost:8001"}], "rate_limit": {"ban": {"window": "10 minutes"}}}`)
+	if got := paths(t, err); len(got) != 1 || got[0] != "rate_limit.ban.window" {
+		t.Errorf("Ожидалась ошибка длительности в rate_limit.ban.window, получено %v", err)
+	}
+
+	_, err = load(t, `{"backends": [{"url": "http://localhost:8001"}], "health_check": {"timeout": "-1s"}}`)
+	if got := paths(t, err); len(got) != 1 || got[0] != "health_check.timeout" {
+		t.Errorf("Ожидалась ошибка отрицательного таймаута, получено %v", err)
+	}
+}
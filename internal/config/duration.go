@@ -0,0 +1,68 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Duration - длительность в конфигурации: строка в формате Go
+// ("500ms", "2s", "1m30s") или число секунд, как в прежних версиях
+type Duration time.Duration
+
+// Seconds возвращает длительность из числа секунд
+func Seconds(n float64) Duration {
+	return Duration(n * float64(time.Second))
+}
+
+// Duration возвращает значение как time.Duration
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON записывает длительность строкой
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON разбирает строку длительности или число секунд
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := parseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+// parseDuration разбирает значение длительности из разобранного документа
+func parseDuration(value any) (Duration, error) {
+	switch value := value.(type) {
+	case float64:
+		return Seconds(value), nil
+	case json.Number:
+		n, err := value.Float64()
+		if err != nil {
+			return 0, err
+		}
+		return Seconds(n), nil
+	case string:
+		if d, err := time.ParseDuration(value); err == nil {
+			return Duration(d), nil
+		}
+		return 0, fmt.Errorf("ожидается длительность вида \"500ms\", \"2s\", \"1m\" или число секунд, получено %q", value)
+	default:
+		return 0, fmt.Errorf("ожидается длительность вида \"500ms\", \"2s\", \"1m\" или число секунд, получено %v", value)
+	}
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Форматы файлов конфигурации
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// Formats - поддерживаемые форматы конфигурации
+var Formats = []string{FormatJSON, FormatYAML, FormatTOML}
+
+// DetectFormat определяет формат конфигурации по расширению файла
+func DetectFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".toml":
+		return FormatTOML, nil
+	default:
+		return "", fmt.Errorf("не удалось определить формат конфигурации по расширению файла %s, "+
+			"укажите его явно: %s", path, strings.Join(Formats, ", "))
+	}
+}
+
+// toJSON переводит документ YAML или TOML в JSON. Конфигурация во всех
+// форматах разбирается по одним и тем же правилам: имена полей, значения
+// по умолчанию, длительности и проверка совпадают
+func toJSON(data []byte, format string) ([]byte, error) {
+	var raw any
+	switch format {
+	case FormatJSON:
+		return data, nil
+	case FormatYAML:
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, err
+		}
+	case FormatTOML:
+		var doc map[string]any
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		raw = doc
+	default:
+		return nil, fmt.Errorf("неизвестный формат конфигурации %q, ожидается одно из: %s",
+			format, strings.Join(Formats, ", "))
+	}
+
+	data, err := json.Marshal(stringKeys(raw))
+	if err != nil {
+		return nil, fmt.Errorf("некорректный документ %s: %w", format, err)
+	}
+	return data, nil
+}
+
+// stringKeys приводит ключи словарей YAML к строкам: JSON допускает только их
+func stringKeys(value any) any {
+	switch value := value.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(value))
+		for k, v := range value {
+			m[fmt.Sprint(k)] = stringKeys(v)
+		}
+		return m
+	case map[string]any:
+		for k, v := range value {
+			value[k] = stringKeys(v)
+		}
+		return value
+	case []any:
+		for i, v := range value {
+			value[i] = stringKeys(v)
+		}
+		return value
+	case []map[string]any:
+		// Массивы таблиц TOML
+		items := make([]any, len(value))
+		for i, v := range value {
+			items[i] = stringKeys(v)
+		}
+		return items
+	default:
+		return value
+	}
+}
+
+// Marshal записывает конфигурацию в заданном формате. Поля называются
+// так же, как в JSON, длительности записываются строками, секретные
+// значения скрываются
+func Marshal(cfg *Config, format string) ([]byte, error) {
+	cfg, err := cfg.Redacted()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	switch format {
+	case FormatJSON:
+		return append(data, '\n'), nil
+	case FormatYAML:
+		node, err := yamlNode(decoder)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(node); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), encoder.Close()
+	case FormatTOML:
+		var raw any
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(tomlValue(raw)); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("неизвестный формат конфигурации %q, ожидается одно из: %s",
+			format, strings.Join(Formats, ", "))
+	}
+}
+
+// yamlNode строит документ YAML по потоку токенов JSON, сохраняя порядок полей
+func yamlNode(decoder *json.Decoder) (*yaml.Node, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		if token == '{' {
+			node.Kind = yaml.MappingNode
+		}
+		for decoder.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key.(string)})
+			}
+			item, err := yamlNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, item)
+		}
+		// Закрывающая скобка
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: token}, nil
+	case json.Number:
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: token.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: strconv.FormatBool(token)}, nil
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+}
+
+// tomlValue готовит разобранный JSON к записи в TOML: числа получают
+// целый или дробный тип, пустые значения пропускаются - в TOML нет null
+func tomlValue(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(value))
+		for k, v := range value {
+			if v != nil {
+				m[k] = tomlValue(v)
+			}
+		}
+		return m
+	case []any:
+		items := make([]any, len(value))
+		for i, v := range value {
+			items[i] = tomlValue(v)
+		}
+		return items
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return n
+		}
+		f, _ := value.Float64()
+		return f
+	default:
+		return value
+	}
+}
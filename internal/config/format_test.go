@@ -0,0 +1,154 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Одна и та же конфигурация в поддерживаемых форматах
+var sameConfig = map[string]string{
+	"config.json": `{
+		"balancer_type": "weighted-round-robin",
+		"backends": [{"url": "http://localhost:8001", "weight": 3}, {"url": "http://localhost:8002"}],
+		"health_check": {"interval": "5s", "timeout": 1},
+		"rate_limit": {
+			"enabled": true,
+			"default_rate": 2.5,
+			"routes": [{"name": "login", "path": "/login", "methods": ["POST"], "capacity": 5, "rate": 0.1}],
+			"quotas": [{"name": "daily", "period": "daily", "limit": 1000, "clients": {"10.0.0.1": 10}}]
+		},
+		"access": {"deny": ["10.0.0.0/8"]}
+	}`,
+	"config.yaml": `
+balancer_type: weighted-round-robin
+backends:
+  - url: http://localhost:8001
+    weight: 3
+  - url: http://localhost:8002
+health_check:
+  interval: 5s
+  timeout: 1
+rate_limit:
+  enabled: true
+  default_rate: 2.5
+  routes:
+    - {name: login, path: /login, methods: [POST], capacity: 5, rate: 0.1}
+  quotas:
+    - name: daily
+      period: daily
+      limit: 1000
+      clients:
+        10.0.0.1: 10
+access:
+  deny: [10.0.0.0/8]
+`,
+	"config.toml": `
+balancer_type = "weighted-round-robin"
+
+[[backends]]
+url = "http://localhost:8001"
+weight = 3
+
+[[backends]]
+url = "http://localhost:8002"
+
+[health_check]
+interval = "5s"
+timeout = 1
+
+[rate_limit]
+enabled = true
+default_rate = 2.5
+
+[[rate_limit.routes]]
+name = "login"
+path = "/login"
+methods = ["POST"]
+capacity = 5
+rate = 0.1
+
+[[rate_limit.quotas]]
+name = "daily"
+period = "daily"
+limit = 1000
+clients = {"10.0.0.1" = 10}
+
+[access]
+deny = ["10.0.0.0/8"]
+`,
+}
+
+// writeFile записывает файл во временный каталог теста
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Не удалось записать конфигурацию: %v", err)
+	}
+	return path
+}
+
+func TestFormatsHaveSameSemantics(t *testing.T) {
+	want, err := LoadConfig(writeFile(t, "config.json", sameConfig["config.json"]))
+	if err != nil {
+		t.Fatalf("Ошибка загрузки JSON: %v", err)
+	}
+	for _, name := range []string{"config.yaml", "config.toml"} {
+		got, err := LoadConfig(writeFile(t, name, sameConfig[name]))
+		if err != nil {
+			t.Errorf("Ошибка загрузки %s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s разобран иначе, чем JSON:\n%+v\n%+v", name, got, want)
+		}
+	}
+}
+
+func TestFormatValidation(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+backends:
+  - url: localhost:8001
+    wieght: 2
+health_check:
+  interval: soon
+`)
+	_, err := LoadConfig(path)
+	got := paths(t, err)
+	if len(got) != 2 || got[0] != "backends[0].wieght" || got[1] != "health_check.interval" {
+		t.Errorf("Ошибки в полях %v\n%v", got, err)
+	}
+
+	// Явно заданный формат имеет приоритет над расширением
+	path = writeFile(t, "lb.conf", "backends = [{url = \"http://localhost:8001\"}]\n")
+	if _, err := LoadConfig(path); err == nil {
+		t.Errorf("Ожидалась ошибка определения формата по расширению .conf")
+	}
+	if _, err := (Source{Path: path, Format: FormatTOML}).Load(); err != nil {
+		t.Errorf("Ошибка загрузки с явным форматом: %v", err)
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	want, err := LoadConfig(writeFile(t, "config.json", sameConfig["config.json"]))
+	if err != nil {
+		t.Fatalf("Ошибка загрузки: %v", err)
+	}
+	for _, format := range Formats {
+		data, err := Marshal(want, format)
+		if err != nil {
+			t.Errorf("Ошибка записи в %s: %v", format, err)
+			continue
+		}
+		got, err := LoadConfig(writeFile(t, "config."+format, string(data)))
+		if err != nil {
+			t.Errorf("Записанная конфигурация %s не загружается: %v\n%s", format, err, data)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Конфигурация изменилась после записи в %s:\n%s", format, data)
+		}
+	}
+}
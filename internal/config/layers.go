@@ -0,0 +1,476 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix - префикс переменных окружения, переопределяющих конфигурацию
+const EnvPrefix = "LB_"
+
+// Слои конфигурации в порядке применения: каждый следующий
+// переопределяет значения предыдущих
+const (
+	LayerDefault = "default"
+	LayerFile    = "file"
+	LayerEnv     = "env"
+	LayerFlag    = "flag"
+)
+
+// Origin - источник значения поля конфигурации
+type Origin struct {
+	Layer string
+	Name  string // Путь к файлу, имя переменной окружения или флаг с путем к полю
+}
+
+func (o Origin) String() string {
+	if o.Name == "" {
+		return o.Layer
+	}
+	return o.Layer + " " + o.Name
+}
+
+// Origins - источники значений по путям полей. Значение, заданное целиком
+// (например, список бэкендов из переменной LB_BACKENDS), является
+// источником всех вложенных полей
+type Origins map[string]Origin
+
+// Of возвращает источник значения поля
+func (o Origins) Of(path string) Origin {
+	for p := path; p != ""; p = parentPath(p) {
+		if origin, ok := o[p]; ok {
+			return origin
+		}
+	}
+	return Origin{Layer: LayerDefault}
+}
+
+// set записывает источник поля, заменяя источники вложенных полей
+func (o Origins) set(path string, origin Origin) {
+	for p := range o {
+		if strings.HasPrefix(p, path+".") || strings.HasPrefix(p, path+"[") {
+			delete(o, p)
+		}
+	}
+	o[path] = origin
+}
+
+// Report возвращает значения всех полей конфигурации с их источниками,
+// по одному полю в строке, в порядке полей конфигурации. Секретные
+// значения скрываются
+func (o Origins) Report(cfg *Config) ([]byte, error) {
+	cfg, err := cfg.Redacted()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	node, err := yamlNode(decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	var walk func(path string, node *yaml.Node)
+	walk = func(path string, node *yaml.Node) {
+		switch {
+		case node.Kind == yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				walk(field(path, node.Content[i].Value), node.Content[i+1])
+			}
+		case node.Kind == yaml.SequenceNode && !scalarSequence(node):
+			for i, item := range node.Content {
+				walk(index(path, i), item)
+			}
+		default:
+			fmt.Fprintf(&buf, "%s = %s  # %s\n", path, nodeValue(node), o.Of(path))
+		}
+	}
+	walk("", node)
+	return buf.Bytes(), nil
+}
+
+// scalarSequence сообщает, что список состоит из простых значений
+// и выводится одной строкой
+func scalarSequence(node *yaml.Node) bool {
+	for _, item := range node.Content {
+		if item.Kind != yaml.ScalarNode {
+			return false
+		}
+	}
+	return true
+}
+
+// nodeValue записывает простое значение или список простых значений
+func nodeValue(node *yaml.Node) string {
+	if node.Kind == yaml.SequenceNode {
+		items := make([]string, len(node.Content))
+		for i, item := range node.Content {
+			items[i] = nodeValue(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	if node.Tag == "!!str" {
+		return strconv.Quote(node.Value)
+	}
+	return node.Value
+}
+
+// parentPath возвращает путь к родительскому полю; пусто - корень
+func parentPath(path string) string {
+	if i := strings.LastIndexAny(path, ".["); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
+
+// fileOrigins отмечает источником все значения, заданные в файле
+func fileOrigins(raw any, path string, origins Origins) {
+	var walk func(p string, value any)
+	walk = func(p string, value any) {
+		if _, _, ok, _ := reference(value); ok {
+			origins[p] = Origin{Layer: LayerFile, Name: path}
+			return
+		}
+		switch value := value.(type) {
+		case map[string]any:
+			for k, v := range value {
+				walk(field(p, k), v)
+			}
+		case []any:
+			if !scalarList(value) {
+				for i, v := range value {
+					walk(index(p, i), v)
+				}
+				return
+			}
+			origins[p] = Origin{Layer: LayerFile, Name: path}
+		default:
+			origins[p] = Origin{Layer: LayerFile, Name: path}
+		}
+	}
+	walk("", raw)
+}
+
+// scalarList сообщает, что список не содержит словарей и списков
+func scalarList(list []any) bool {
+	for _, item := range list {
+		switch item.(type) {
+		case map[string]any, []any:
+			return false
+		}
+	}
+	return true
+}
+
+// override - значение поля из переменной окружения или флага
+type override struct {
+	path   []string // Имена полей и номера элементов списков
+	value  string
+	origin Origin
+}
+
+// overrides разбирает переменные окружения и флаги. Переменные без префикса
+// LB_ и с именами, не соответствующими полям, пропускаются: окружение
+// контейнера может содержать посторонние переменные с тем же префиксом
+func (s Source) overrides(v *validator) []override {
+	configType := reflect.TypeOf(Config{})
+
+	var result []override
+	env := append([]string(nil), s.Env...)
+	sort.Strings(env)
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		rest, ok := strings.CutPrefix(name, EnvPrefix)
+		if !ok || rest == "" {
+			continue
+		}
+		if path, ok := envPath(configType, rest); ok {
+			result = append(result, override{path: path, value: value, origin: Origin{Layer: LayerEnv, Name: name}})
+		}
+	}
+	// Элементы списков добавляются по порядку: BACKENDS_2 раньше BACKENDS_10
+	sort.SliceStable(result, func(i, j int) bool { return pathLess(result[i].path, result[j].path) })
+
+	for _, flag := range s.Flags {
+		name, value, ok := strings.Cut(flag, "=")
+		if !ok {
+			v.errorf("", "флаг -set %s: ожидается путь=значение", flag)
+			continue
+		}
+		path, err := flagPath(configType, name)
+		if err != nil {
+			v.errorf(name, "флаг -set: %v", err)
+			continue
+		}
+		// Значение не входит в источник: оно может быть секретом
+		result = append(result, override{path: path, value: value, origin: Origin{Layer: LayerFlag, Name: "-set " + name}})
+	}
+	return result
+}
+
+// applyOverrides записывает переопределенные значения в разобранный документ
+func (s Source) applyOverrides(v *validator, raw any, origins Origins) any {
+	configType := reflect.TypeOf(Config{})
+	for _, o := range s.overrides(v) {
+		path := joinPath(o.path)
+		value, err := overrideValue(typeAt(configType, o.path), o.value)
+		if err != nil {
+			v.errorf(path, "%s: %v", o.origin.Name, err)
+			continue
+		}
+		if raw, err = setPath(raw, o.path, value); err != nil {
+			v.errorf(path, "%s: %v", o.origin.Name, err)
+			continue
+		}
+		origins.set(path, o.origin)
+	}
+	return raw
+}
+
+// envPath переводит имя переменной окружения без префикса в путь к полю:
+// имена полей в верхнем регистре разделяются подчеркиванием, элементы
+// списков задаются номером - RATE_LIMIT_ENABLED, BACKENDS_0_URL
+func envPath(t reflect.Type, name string) ([]string, bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		fields := jsonFields(t)
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		// Более длинные имена первыми: RATE_LIMIT раньше RATE
+		sort.Slice(keys, func(i, j int) bool { return len(keys[i]) > len(keys[j]) })
+		for _, key := range keys {
+			upper := strings.ToUpper(key)
+			if name == upper {
+				return []string{key}, true
+			}
+			if rest, ok := strings.CutPrefix(name, upper+"_"); ok {
+				if sub, ok := envPath(fields[key], rest); ok {
+					return append([]string{key}, sub...), true
+				}
+			}
+		}
+	case reflect.Slice:
+		i, rest, nested := strings.Cut(name, "_")
+		if n, err := strconv.Atoi(i); err == nil && n >= 0 {
+			if !nested {
+				return []string{i}, true
+			}
+			if sub, ok := envPath(t.Elem(), rest); ok {
+				return append([]string{i}, sub...), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// flagPath разбирает путь к полю вида rate_limit.routes[0].cost
+func flagPath(t reflect.Type, name string) ([]string, error) {
+	var path []string
+	for _, part := range strings.Split(name, ".") {
+		key, rest, _ := strings.Cut(part, "[")
+		path = append(path, key)
+		for rest != "" {
+			i, tail, ok := strings.Cut(rest, "]")
+			if n, err := strconv.Atoi(i); !ok || err != nil || n < 0 {
+				return nil, fmt.Errorf("некорректный номер элемента в пути %q", name)
+			}
+			path = append(path, i)
+			rest = strings.TrimPrefix(tail, "[")
+		}
+	}
+	if typeAt(t, path) == nil {
+		return nil, fmt.Errorf("неизвестное поле")
+	}
+	return path, nil
+}
+
+// typeAt возвращает тип поля по пути или nil, если поля нет
+func typeAt(t reflect.Type, path []string) reflect.Type {
+	for _, seg := range path {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			ft, ok := jsonFields(t)[seg]
+			if !ok {
+				return nil
+			}
+			t = ft
+		case reflect.Slice:
+			if _, err := strconv.Atoi(seg); err != nil {
+				return nil
+			}
+			t = t.Elem()
+		case reflect.Map:
+			t = t.Elem()
+		default:
+			return nil
+		}
+	}
+	return t
+}
+
+// joinPath собирает путь к полю в формат backends[0].url
+func joinPath(path []string) string {
+	var p string
+	for _, seg := range path {
+		if i, err := strconv.Atoi(seg); err == nil {
+			p = index(p, i)
+			continue
+		}
+		p = field(p, seg)
+	}
+	return p
+}
+
+// overrideValue переводит строковое значение в значение документа по типу
+// поля. Списки простых значений задаются через запятую или массивом JSON,
+// списки структур, словари и структуры - только в JSON
+func overrideValue(t reflect.Type, s string) (any, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == durationType {
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return json.Number(s), nil
+		}
+		return s, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return s, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("ожидается true или false, получено %q", s)
+		}
+		return b, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("ожидается целое число, получено %q", s)
+		}
+		return json.Number(s), nil
+	case reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("ожидается число, получено %q", s)
+		}
+		return json.Number(s), nil
+	case reflect.Slice:
+		if !strings.HasPrefix(strings.TrimSpace(s), "[") && scalarKind(t.Elem()) {
+			items := []any{}
+			for _, item := range strings.Split(s, ",") {
+				if item = strings.TrimSpace(item); item == "" {
+					continue
+				}
+				value, err := overrideValue(t.Elem(), item)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, value)
+			}
+			return items, nil
+		}
+	}
+
+	var value any
+	decoder := json.NewDecoder(strings.NewReader(s))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("ожидается значение в формате JSON: %v", err)
+	}
+	return value, nil
+}
+
+// scalarKind сообщает, что значение типа задается строкой
+func scalarKind(t reflect.Type) bool {
+	if t == durationType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array, reflect.Interface:
+		return false
+	}
+	return true
+}
+
+// setPath записывает значение в разобранный документ, создавая
+// недостающие словари. Элемент добавляется только в конец списка:
+// номер за его концом - ошибка
+func setPath(node any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	if i, err := strconv.Atoi(path[0]); err == nil {
+		list, _ := node.([]any)
+		if i > len(list) {
+			return node, fmt.Errorf("номер элемента %d больше длины списка %d", i, len(list))
+		}
+		if i == len(list) {
+			list = append(list, map[string]any{})
+		}
+		if list[i], err = setPath(list[i], path[1:], value); err != nil {
+			return node, err
+		}
+		return list, nil
+	}
+	m, ok := node.(map[string]any)
+	if !ok {
+		m = make(map[string]any)
+	}
+	child, err := setPath(m[path[0]], path[1:], value)
+	if err != nil {
+		return node, err
+	}
+	m[path[0]] = child
+	return m, nil
+}
+
+// pathLess сравнивает пути к полям; номера элементов сравниваются как числа
+func pathLess(a, b []string) bool {
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if a[k] == b[k] {
+			continue
+		}
+		i, errA := strconv.Atoi(a[k])
+		j, errB := strconv.Atoi(b[k])
+		if errA == nil && errB == nil {
+			return i < j
+		}
+		return a[k] < b[k]
+	}
+	return len(a) < len(b)
+}
+
+// annotate дополняет ошибки проверки полей, заданных переменными окружения
+// или флагами, их источником
+func annotate(err error, origins Origins) error {
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		return err
+	}
+	for i, fe := range verr.Errors {
+		if origin := origins.Of(fe.Path); origin.Layer == LayerEnv || origin.Layer == LayerFlag {
+			verr.Errors[i].Message += " (" + origin.String() + ")"
+		}
+	}
+	return verr
+}
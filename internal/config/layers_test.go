@@ -0,0 +1,152 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLayersPrecedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+server:
+  port: 8081
+backends:
+  - url: http://localhost:8001
+  - url: http://localhost:8002
+health_check:
+  interval: 5s
+`)
+	cfg, origins, err := Source{
+		Path: path,
+		Env: []string{
+			"LB_SERVER_PORT=8082",
+			"LB_RATE_LIMIT_ENABLED=true",
+			"LB_RATE_LIMIT_DEFAULT_RATE=2.5",
+			"LB_BACKENDS_1_WEIGHT=4",
+			"LB_BACKENDS_2_URL=http://localhost:8003",
+			"LB_ACCESS_DENY=10.0.0.0/8, 192.168.0.1",
+			"LB_PORT=tcp://10.96.0.1:80", // Переменная сервиса Kubernetes
+			"PATH=/usr/bin",
+		},
+		Flags: []string{"server.port=8083", "rate_limit.routes[0].name=login", "rate_limit.routes[0].path=/login"},
+	}.LoadWithOrigins()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки: %v", err)
+	}
+
+	if cfg.Server.Port != 8083 {
+		t.Errorf("Флаг должен переопределять окружение: порт %d", cfg.Server.Port)
+	}
+	if !cfg.RateLimit.Enabled || cfg.RateLimit.DefaultRate != 2.5 {
+		t.Errorf("Не применены переменные окружения rate_limit: %+v", cfg.RateLimit)
+	}
+	wantBackends := []BackendConfig{
+		{URL: "http://localhost:8001"},
+		{URL: "http://localhost:8002", Weight: 4},
+		{URL: "http://localhost:8003"},
+	}
+	if !reflect.DeepEqual(cfg.Backends, wantBackends) {
+		t.Errorf("Бэкенды %+v, ожидалось %+v", cfg.Backends, wantBackends)
+	}
+	if !reflect.DeepEqual(cfg.Access.Deny, []string{"10.0.0.0/8", "192.168.0.1"}) {
+		t.Errorf("Список через запятую разобран неверно: %q", cfg.Access.Deny)
+	}
+	if len(cfg.RateLimit.Routes) != 1 || cfg.RateLimit.Routes[0].Path != "/login" {
+		t.Errorf("Маршрут из флагов не добавлен: %+v", cfg.RateLimit.Routes)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"server.port", "flag -set server.port"},
+		{"backends[0].url", "file " + path},
+		{"backends[1].weight", "env LB_BACKENDS_1_WEIGHT"},
+		{"health_check.interval", "file " + path},
+		{"health_check.timeout", "default"},
+		{"access.deny", "env LB_ACCESS_DENY"},
+	}
+	for _, tt := range tests {
+		if got := origins.Of(tt.path).String(); got != tt.want {
+			t.Errorf("Источник %s: %q, ожидалось %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLayersWholeValues(t *testing.T) {
+	path := writeFile(t, "config.json", `{"backends": [{"url": "http://localhost:8001", "weight": 2}]}`)
+	cfg, origins, err := Source{
+		Path: path,
+		Env: []string{
+			`LB_BACKENDS=[{"url": "http://localhost:9001"}, {"url": "http://localhost:9002", "weight": 3}]`,
+			`LB_RATE_LIMIT_QUOTAS=[{"name": "daily", "period": "daily", "limit": 100}]`,
+			"LB_HEALTH_CHECK_TIMEOUT=1.5",
+		},
+	}.LoadWithOrigins()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки: %v", err)
+	}
+
+	if len(cfg.Backends) != 2 || cfg.Backends[1].Weight != 3 {
+		t.Errorf("Список бэкендов не заменен: %+v", cfg.Backends)
+	}
+	if got := origins.Of("backends[0].weight").String(); got != "env LB_BACKENDS" {
+		t.Errorf("Источник значения из замененного списка: %q", got)
+	}
+	if len(cfg.RateLimit.Quotas) != 1 || cfg.RateLimit.Quotas[0].Limit != 100 {
+		t.Errorf("Квоты не заданы: %+v", cfg.RateLimit.Quotas)
+	}
+	if cfg.HealthCheck.Timeout.Duration() != 1500*time.Millisecond {
+		t.Errorf("Число в переменной окружения должно означать секунды: %v", cfg.HealthCheck.Timeout)
+	}
+
+	report, err := origins.Report(cfg)
+	if err != nil {
+		t.Fatalf("Ошибка отчета: %v", err)
+	}
+	for _, line := range []string{
+		`backends[1].url = "http://localhost:9002"  # env LB_BACKENDS`,
+		`health_check.timeout = "1.5s"  # env LB_HEALTH_CHECK_TIMEOUT`,
+		`balancer_type = "round-robin"  # default`,
+	} {
+		if !strings.Contains(string(report), line+"\n") {
+			t.Errorf("Отчет не содержит строку %q:\n%s", line, report)
+		}
+	}
+}
+
+func TestLayersErrors(t *testing.T) {
+	path := writeFile(t, "config.json", `{"backends": [{"url": "http://localhost:8001"}]}`)
+	_, err := Source{
+		Path:  path,
+		Env:   []string{"LB_SERVER_PORT=http", "LB_ADMIN_ENABLED=yes please"},
+		Flags: []string{"server.prot=1", "backends[x].url=http://localhost:8002", "balancer_type"},
+	}.Load()
+	got := paths(t, err)
+	want := []string{"server.prot", "backends[x].url", "", "admin.enabled", "server.port"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Ошибки в полях %q, ожидалось %q\n%v", got, want, err)
+	}
+
+	// Ошибка проверки значения указывает его источник
+	_, err = Source{Path: path, Env: []string{"LB_BACKENDS_0_WEIGHT=-1"}}.Load()
+	if err == nil || !strings.Contains(err.Error(), "backends[0].weight: не может быть отрицательным, получено -1 (env LB_BACKENDS_0_WEIGHT)") {
+		t.Errorf("Ожидалась ошибка с источником значения, получено %v", err)
+	}
+
+	// Элемент добавляется только в конец списка
+	_, err = Source{Path: path, Flags: []string{"backends[999999999].url=http://localhost:8002"}}.Load()
+	if err == nil || !strings.Contains(err.Error(), "backends[999999999].url: -set backends[999999999].url: номер элемента 999999999 больше длины списка 1") {
+		t.Errorf("Ожидалась ошибка номера элемента, получено %v", err)
+	}
+	var env []string
+	for i := 1; i <= 10; i++ {
+		env = append(env, fmt.Sprintf("LB_BACKENDS_%d_URL=http://localhost:%d", i, 8001+i))
+	}
+	cfg, err := Source{Path: path, Env: env}.Load()
+	if err != nil || len(cfg.Backends) != 11 || cfg.Backends[10].URL != "http://localhost:8011" {
+		t.Errorf("Элементы из переменных окружения должны добавляться по номерам: %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Ссылки на значения вне файла конфигурации. Допускаются в любом строковом
+// поле: {"$file": "/run/secrets/token"} или {"$env": "ADMIN_TOKEN"}
+const (
+	refFile = "$file"
+	refEnv  = "$env"
+)
+
+// redacted заменяет секретные значения при выводе конфигурации и в ошибках
+const redacted = "[скрыто]"
+
+// reference разбирает ссылку на значение. Словарь с ключом $file или $env
+// считается ссылкой, и другие ключи в нем не допускаются
+func reference(value any) (kind, name string, ok bool, err error) {
+	m, isMap := value.(map[string]any)
+	if !isMap {
+		return "", "", false, nil
+	}
+	_, file := m[refFile]
+	_, env := m[refEnv]
+	if !file && !env {
+		return "", "", false, nil
+	}
+	if len(m) != 1 {
+		return "", "", true, fmt.Errorf("ссылка должна содержать только один ключ: %s или %s", refFile, refEnv)
+	}
+	for k, v := range m {
+		kind = k
+		name, _ = v.(string)
+	}
+	if name == "" {
+		return "", "", true, fmt.Errorf("ссылка %s должна быть непустой строкой", kind)
+	}
+	return kind, name, true, nil
+}
+
+// resolveSecrets заменяет ссылки в строковых полях документа значениями
+// из файлов и переменных окружения. Пути полей, полученных по ссылкам,
+// записываются в secrets вместе с описанием ссылки
+func (s Source) resolveSecrets(v *validator, path string, value any, t reflect.Type, secrets map[string]string) any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if kind, name, ok, err := reference(value); ok {
+		switch {
+		case err != nil:
+			v.check(path, err)
+		case t.Kind() != reflect.String:
+			v.errorf(path, "ссылки %s и %s допускаются только в строковых полях", refFile, refEnv)
+		default:
+			resolved, err := s.secret(kind, name)
+			if err != nil {
+				v.check(path, err)
+				return value
+			}
+			secrets[path] = kind + " " + name
+			return resolved
+		}
+		return value
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := jsonFields(t)
+			for _, key := range keys {
+				// Неизвестные поля сообщает checkFields
+				if ft, ok := fields[key]; ok {
+					value[key] = s.resolveSecrets(v, field(path, key), value[key], ft, secrets)
+				}
+			}
+		case reflect.Map:
+			for _, key := range keys {
+				value[key] = s.resolveSecrets(v, field(path, key), value[key], t.Elem(), secrets)
+			}
+		}
+	case []any:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, item := range value {
+				value[i] = s.resolveSecrets(v, index(path, i), item, t.Elem(), secrets)
+			}
+		}
+	}
+	return value
+}
+
+// secret читает значение по ссылке. Завершающий перевод строки в файле
+// отбрасывается: так записывают секреты Docker и Kubernetes
+func (s Source) secret(kind, name string) (string, error) {
+	if kind == refFile {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	if value, ok := s.lookupEnv(name); ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("переменная окружения %s не задана", name)
+}
+
+// lookupEnv ищет переменную окружения среди Source.Env, а если они
+// не заданы - в окружении процесса
+func (s Source) lookupEnv(name string) (string, bool) {
+	if s.Env == nil {
+		return os.LookupEnv(name)
+	}
+	value, found := "", false
+	for _, kv := range s.Env {
+		if k, v, ok := strings.Cut(kv, "="); ok && k == name {
+			// Как и в окружении процесса, действует последнее значение
+			value, found = v, true
+		}
+	}
+	return value, found
+}
+
+// walkSecrets вызывает fn для непустых секретных значений конфигурации:
+// полей с тегом secret:"true" и полей, полученных по ссылкам
+func walkSecrets(v reflect.Value, path string, tagged bool, refs map[string]string, fn func(value reflect.Value, ref string)) {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			p := path
+			if !f.Anonymous || name != "" {
+				if name == "" {
+					name = f.Name
+				}
+				p = field(path, name)
+			}
+			walkSecrets(v.Field(i), p, f.Tag.Get("secret") == "true", refs, fn)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walkSecrets(v.Index(i), index(path, i), false, refs, fn)
+		}
+	case reflect.String:
+		if v.String() == "" {
+			return
+		}
+		if ref, ok := refs[path]; ok {
+			fn(v, ref)
+		} else if tagged {
+			fn(v, "")
+		}
+	}
+}
+
+// Redacted возвращает копию конфигурации для вывода, в которой секретные
+// значения заменены пометкой; для значений по ссылке указывается ссылка
+func (c *Config) Redacted() (*Config, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var copy Config
+	if err := json.Unmarshal(data, &copy); err != nil {
+		return nil, err
+	}
+	walkSecrets(reflect.ValueOf(&copy).Elem(), "", false, c.secrets, func(value reflect.Value, ref string) {
+		if ref == "" {
+			value.SetString(redacted)
+			return
+		}
+		value.SetString("[скрыто: " + ref + "]")
+	})
+	return &copy, nil
+}
+
+// redactErrors убирает секретные значения из сообщений об ошибках проверки
+func redactErrors(err error, c *Config) error {
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		return err
+	}
+	var values []string
+	walkSecrets(reflect.ValueOf(c).Elem(), "", false, c.secrets, func(value reflect.Value, _ string) {
+		values = append(values, value.String())
+	})
+	for i := range verr.Errors {
+		for _, value := range values {
+			verr.Errors[i].Message = strings.ReplaceAll(verr.Errors[i].Message, value, redacted)
+		}
+	}
+	return verr
+}
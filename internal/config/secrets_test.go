@@ -0,0 +1,89 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecretReferences(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "admin_token")
+	if err := os.WriteFile(tokenFile, []byte("s3cr3t-token\n"), 0600); err != nil {
+		t.Fatalf("Не удалось записать секрет: %v", err)
+	}
+	path := writeFile(t, "config.yaml", `
+backends:
+  - url: {$env: BACKEND_URL}
+admin:
+  enabled: true
+  token: {$file: `+tokenFile+`}
+rate_limit:
+  distributed:
+    password: inline-password
+`)
+	src := Source{Path: path, Env: []string{"BACKEND_URL=http://localhost:8001"}}
+	cfg, origins, err := src.LoadWithOrigins()
+	if err != nil {
+		t.Fatalf("Ошибка загрузки: %v", err)
+	}
+	if cfg.Admin.Token != "s3cr3t-token" || cfg.Backends[0].URL != "http://localhost:8001" {
+		t.Errorf("Ссылки не разрешены: токен %q, URL %q", cfg.Admin.Token, cfg.Backends[0].URL)
+	}
+
+	report, err := origins.Report(cfg)
+	if err != nil {
+		t.Fatalf("Ошибка отчета: %v", err)
+	}
+	for _, format := range Formats {
+		data, err := Marshal(cfg, format)
+		if err != nil {
+			t.Fatalf("Ошибка записи в %s: %v", format, err)
+		}
+		for _, out := range [][]byte{data, report} {
+			for _, secret := range []string{"s3cr3t-token", "inline-password", "localhost:8001"} {
+				if strings.Contains(string(out), secret) {
+					t.Errorf("Вывод содержит секрет %q:\n%s", secret, out)
+				}
+			}
+		}
+	}
+	for _, line := range []string{
+		`admin.token = "[скрыто: $file ` + tokenFile + `]"`,
+		`backends[0].url = "[скрыто: $env BACKEND_URL]"`,
+		`rate_limit.distributed.password = "[скрыто]"`,
+	} {
+		if !strings.Contains(string(report), line+"  # file "+path+"\n") {
+			t.Errorf("Отчет не содержит строку %q:\n%s", line, report)
+		}
+	}
+
+	// Ссылки разрешаются заново при каждой загрузке
+	if err := os.WriteFile(tokenFile, []byte("rotated"), 0600); err != nil {
+		t.Fatalf("Не удалось записать секрет: %v", err)
+	}
+	if cfg, err = src.Load(); err != nil || cfg.Admin.Token != "rotated" {
+		t.Errorf("Новое значение секрета не прочитано: %v", err)
+	}
+}
+
+func TestSecretErrors(t *testing.T) {
+	path := writeFile(t, "config.json", `{
+		"backends": [{"url": {"$env": "BACKEND_URL"}}, {"url": {"$file": "/nonexistent/secret"}}],
+		"server": {"port": {"$env": "PORT"}},
+		"admin": {"token": {"$env": "TOKEN", "$file": "/run/secrets/token"}}
+	}`)
+	_, err := Source{Path: path, Env: []string{"PORT=8080"}}.Load()
+	got := paths(t, err)
+	want := []string{"admin.token", "backends[0].url", "backends[1].url", "server.port"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Ошибки в полях %q, ожидалось %q\n%v", got, want, err)
+	}
+
+	// Некорректное значение по ссылке не попадает в сообщение об ошибке
+	path = writeFile(t, "config.json", `{"backends": [{"url": {"$env": "BACKEND_URL"}}]}`)
+	_, err = Source{Path: path, Env: []string{"BACKEND_URL=user:password@localhost"}}.Load()
+	if err == nil || strings.Contains(err.Error(), "password") || !strings.Contains(err.Error(), redacted) {
+		t.Errorf("Ожидалась ошибка со скрытым значением, получено %v", err)
+	}
+}
@@ -0,0 +1,551 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/acl"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/balancer"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/discovery"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/ratelimit"
+)
+
+// Поддерживаемые алгоритмы балансировки
+var balancerTypes = []string{"round-robin", "weighted-round-robin", "random"}
+
+// FieldError - ошибка значения поля конфигурации
+type FieldError struct {
+	Path    string // Путь к полю, например backends[0].url; пусто - корень
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError содержит все найденные ошибки конфигурации
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("некорректная конфигурация:")
+	for _, err := range e.Errors {
+		b.WriteString("\n  ")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+// validator накапливает ошибки, чтобы сообщить обо всех сразу
+type validator struct {
+	errs []FieldError
+}
+
+// errorf добавляет ошибку поля
+func (v *validator) errorf(path, format string, args ...any) {
+	v.errs = append(v.errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// check добавляет ошибку поля, если err не nil
+func (v *validator) check(path string, err error) {
+	if err != nil {
+		v.errs = append(v.errs, FieldError{Path: path, Message: err.Error()})
+	}
+}
+
+// oneOf проверяет, что значение поля входит в список допустимых
+func (v *validator) oneOf(path, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.errorf(path, "недопустимое значение %q, ожидается одно из: %s", value, strings.Join(allowed, ", "))
+}
+
+// positive проверяет, что число больше нуля
+func (v *validator) positive(path string, value int64) {
+	if value <= 0 {
+		v.errorf(path, "должно быть положительным, получено %d", value)
+	}
+}
+
+// nonNegative проверяет, что число не меньше нуля
+func (v *validator) nonNegative(path string, value int64) {
+	if value < 0 {
+		v.errorf(path, "не может быть отрицательным, получено %d", value)
+	}
+}
+
+// positiveDuration проверяет, что длительность больше нуля
+func (v *validator) positiveDuration(path string, value Duration) {
+	if value <= 0 {
+		v.errorf(path, "должно быть положительным, получено %v", value)
+	}
+}
+
+// nonNegativeDuration проверяет, что длительность не меньше нуля
+func (v *validator) nonNegativeDuration(path string, value Duration) {
+	if value < 0 {
+		v.errorf(path, "не может быть отрицательным, получено %v", value)
+	}
+}
+
+// port проверяет номер TCP-порта
+func (v *validator) port(path string, port int) {
+	if port < 1 || port > 65535 {
+		v.errorf(path, "порт должен быть от 1 до 65535, получено %d", port)
+	}
+}
+
+// unique проверяет, что имя задано и не повторяется
+func (v *validator) unique(path, name string, seen map[string]bool) {
+	switch {
+	case name == "":
+		v.errorf(path, "обязательное поле")
+	case seen[name]:
+		v.errorf(path, "значение %q уже используется", name)
+	}
+	seen[name] = true
+}
+
+// err возвращает накопленные ошибки или nil
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errs}
+}
+
+// index добавляет к пути номер элемента массива
+func index(path string, i int) string {
+	return path + "[" + strconv.Itoa(i) + "]"
+}
+
+// field добавляет к пути имя поля
+func field(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// Validate проверяет конфигурацию со значениями по умолчанию
+// и возвращает *ValidationError со всеми найденными ошибками
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.port("server.port", c.Server.Port)
+
+	if len(c.Backends) == 0 && c.Discovery.empty() {
+		v.errorf("backends", "необходимо задать хотя бы один бэкенд или источник discovery")
+	}
+	urls := make(map[string]bool)
+	for i, b := range c.Backends {
+		path := index("backends", i)
+		v.check(field(path, "url"), validateURL(b.URL))
+		if urls[b.URL] {
+			v.errorf(field(path, "url"), "бэкенд %s уже задан", b.URL)
+		}
+		urls[b.URL] = true
+		v.nonNegative(field(path, "weight"), int64(b.Weight))
+		v.nonNegative(field(path, "max_connections"), int64(b.MaxConns))
+	}
+	c.Discovery.validate(v, "discovery")
+	v.oneOf("balancer_type", c.BalancerType, balancerTypes...)
+	v.nonNegativeDuration("drain_timeout", c.DrainTimeout)
+	v.check("slow_start", balancer.SlowStart{
+		Window:    c.SlowStart.Window.Duration(),
+		MinFactor: c.SlowStart.MinWeight,
+		Curve:     c.SlowStart.Curve,
+	}.Validate())
+
+	c.RateLimit.validate(v, "rate_limit")
+	c.Access.validate(v, "access")
+
+	v.port("admin.port", c.Admin.Port)
+	if c.Admin.Enabled {
+		if c.Admin.Token == "" {
+			v.errorf("admin.token", "для admin API необходимо задать токен доступа")
+		}
+		if c.Admin.Port == c.Server.Port {
+			v.errorf("admin.port", "совпадает с портом сервера %d", c.Server.Port)
+		}
+	}
+
+	v.positiveDuration("health_check.interval", c.HealthCheck.Interval)
+	v.positiveDuration("health_check.timeout", c.HealthCheck.Timeout)
+
+	return v.err()
+}
+
+// validate проверяет источники обнаружения бэкендов
+func (c *DiscoveryConfig) validate(v *validator, path string) {
+	names := make(map[string]bool)
+	for i, dns := range c.DNS {
+		dnsPath := index(field(path, "dns"), i)
+		v.unique(field(dnsPath, "name"), dns.Name, names)
+		v.oneOf(field(dnsPath, "type"), dns.Type, discovery.DNSTypeA, discovery.DNSTypeSRV)
+		if dns.Type == discovery.DNSTypeSRV {
+			if dns.Port != 0 {
+				v.errorf(field(dnsPath, "port"), "для записей SRV порт задается записями")
+			}
+		} else {
+			v.port(field(dnsPath, "port"), dns.Port)
+		}
+		v.oneOf(field(dnsPath, "scheme"), dns.Scheme, "http", "https")
+		v.nonNegative(field(dnsPath, "weight"), int64(dns.Weight))
+		v.nonNegative(field(dnsPath, "priority"), int64(dns.Priority))
+		if dns.Server != "" {
+			if _, _, err := net.SplitHostPort(dns.Server); err != nil {
+				v.errorf(field(dnsPath, "server"), "ожидается адрес вида host:port, получено %q", dns.Server)
+			}
+		}
+		v.positiveDuration(field(dnsPath, "min_interval"), dns.MinInterval)
+		if dns.MaxInterval < dns.MinInterval {
+			v.errorf(field(dnsPath, "max_interval"), "не может быть меньше min_interval %v", dns.MinInterval)
+		}
+	}
+
+	paths := make(map[string]bool)
+	for i, file := range c.Files {
+		filePath := index(field(path, "files"), i)
+		v.unique(field(filePath, "path"), file.Path, paths)
+		v.oneOf(field(filePath, "format"), file.Format, discovery.FileFormatJSON, discovery.FileFormatYAML)
+		v.positiveDuration(field(filePath, "interval"), file.Interval)
+	}
+
+	pools := make(map[string]bool)
+	for i, docker := range c.Docker {
+		dockerPath := index(field(path, "docker"), i)
+		v.unique(field(dockerPath, "pool"), docker.Pool, pools)
+		if docker.Port != 0 {
+			v.port(field(dockerPath, "port"), docker.Port)
+		}
+		v.oneOf(field(dockerPath, "scheme"), docker.Scheme, "http", "https")
+		v.nonNegative(field(dockerPath, "weight"), int64(docker.Weight))
+		v.nonNegative(field(dockerPath, "priority"), int64(docker.Priority))
+		v.positiveDuration(field(dockerPath, "retry_interval"), docker.RetryInterval)
+	}
+
+	services := make(map[string]bool)
+	for i, kube := range c.Kubernetes {
+		kubePath := index(field(path, "kubernetes"), i)
+		if kube.Service == "" {
+			v.errorf(field(kubePath, "service"), "обязательное поле")
+		} else {
+			v.unique(field(kubePath, "service"), kube.Namespace+"/"+kube.Service, services)
+		}
+		v.oneOf(field(kubePath, "scheme"), kube.Scheme, "http", "https")
+		v.nonNegative(field(kubePath, "weight"), int64(kube.Weight))
+		v.nonNegative(field(kubePath, "priority"), int64(kube.Priority))
+		v.positiveDuration(field(kubePath, "resync_interval"), kube.ResyncInterval)
+		v.positiveDuration(field(kubePath, "retry_interval"), kube.RetryInterval)
+	}
+}
+
+// empty сообщает, что не задан ни один источник обнаружения
+func (c *DiscoveryConfig) empty() bool {
+	return len(c.DNS) == 0 && len(c.Files) == 0 && len(c.Docker) == 0 && len(c.Kubernetes) == 0
+}
+
+// validate проверяет настройки rate limiting
+func (c *RateLimitConfig) validate(v *validator, path string) {
+	v.check(path, ratelimit.Policy{
+		Algorithm: c.Algorithm,
+		Capacity:  c.DefaultCapacity,
+		Rate:      c.DefaultRate,
+	}.Validate())
+	v.oneOf(field(path, "response_format"), c.ResponseFormat, "text", "json")
+	v.positiveDuration(field(path, "client_ttl"), c.ClientTTL)
+	v.positive(field(path, "max_clients"), int64(c.MaxClients))
+	v.positiveDuration(field(path, "shadow_window"), c.ShadowWindow)
+	v.positiveDuration(field(path, "store.snapshot_interval"), c.Store.SnapshotInterval)
+
+	ids := make(map[string]bool)
+	for i, client := range c.Clients {
+		clientPath := index(field(path, "clients"), i)
+		v.unique(field(clientPath, "id"), client.ID, ids)
+		v.check(clientPath, ratelimit.Policy{
+			Algorithm: client.Algorithm,
+			Capacity:  client.Capacity,
+			Rate:      client.Rate,
+		}.Validate())
+	}
+
+	dpath := field(path, "distributed")
+	v.oneOf(field(dpath, "on_error"), c.Distributed.OnError,
+		ratelimit.FailLocal, ratelimit.FailOpen, ratelimit.FailClosed)
+	v.positiveDuration(field(dpath, "timeout"), c.Distributed.Timeout)
+	v.nonNegative(field(dpath, "db"), int64(c.Distributed.DB))
+
+	cpath := field(path, "concurrency")
+	v.nonNegative(field(cpath, "max_in_flight"), int64(c.Concurrency.MaxInFlight))
+	v.nonNegativeDuration(field(cpath, "queue_timeout"), c.Concurrency.QueueTimeout)
+	if status := c.Concurrency.Status; status < 100 || status > 599 {
+		v.errorf(field(cpath, "status"), "некорректный HTTP-статус %d", status)
+	}
+
+	names := make(map[string]bool)
+	for i, route := range c.Routes {
+		routePath := index(field(path, "routes"), i)
+		v.unique(field(routePath, "name"), route.Name, names)
+		validateRoutePath(v, field(routePath, "path"), route.Path)
+		v.positive(field(routePath, "cost"), int64(route.Cost))
+		v.nonNegative(field(routePath, "capacity"), int64(route.Capacity))
+		if route.Capacity > 0 {
+			if route.Cost > route.Capacity {
+				v.errorf(field(routePath, "cost"), "стоимость запроса %d превышает емкость %d", route.Cost, route.Capacity)
+			}
+			v.check(routePath, ratelimit.Policy{
+				Algorithm: route.Algorithm,
+				Capacity:  route.Capacity,
+				Rate:      route.Rate,
+			}.Validate())
+		}
+	}
+
+	quotas := make(map[string]bool)
+	for i, quota := range c.Quotas {
+		quotaPath := index(field(path, "quotas"), i)
+		v.unique(field(quotaPath, "name"), quota.Name, quotas)
+		location, err := time.LoadLocation(quota.Timezone)
+		if err != nil {
+			v.errorf(field(quotaPath, "timezone"), "неизвестный часовой пояс %q", quota.Timezone)
+		}
+		resetAt, err := time.Parse("15:04", quota.ResetAt)
+		if err != nil {
+			v.errorf(field(quotaPath, "reset_at"), "ожидается время в формате ЧЧ:ММ, получено %q", quota.ResetAt)
+		}
+		if quota.Name != "" {
+			v.check(quotaPath, ratelimit.QuotaPolicy{
+				Name:     quota.Name,
+				Period:   quota.Period,
+				Limit:    quota.Limit,
+				Location: location,
+				ResetAt:  time.Duration(resetAt.Hour())*time.Hour + time.Duration(resetAt.Minute())*time.Minute,
+				ResetDay: quota.ResetDay,
+			}.Validate())
+		}
+		for id, limit := range quota.Clients {
+			v.nonNegative(field(field(quotaPath, "clients"), id), limit)
+		}
+	}
+
+	v.check(field(path, "ban"), ratelimit.BanPolicy{
+		MaxRejections: c.Ban.MaxRejections,
+		Window:        c.Ban.Window.Duration(),
+		Duration:      c.Ban.Duration.Duration(),
+		MaxDuration:   c.Ban.MaxDuration.Duration(),
+		ForgetAfter:   c.Ban.ForgetAfter.Duration(),
+	}.Validate())
+}
+
+// validate проверяет списки доступа
+func (c *AccessConfig) validate(v *validator, path string) {
+	c.AccessListConfig.validate(v, path)
+	v.positiveDuration(field(path, "reload_interval"), c.ReloadInterval)
+
+	names := make(map[string]bool)
+	for i, route := range c.Routes {
+		routePath := index(field(path, "routes"), i)
+		v.unique(field(routePath, "name"), route.Name, names)
+		validateRoutePath(v, field(routePath, "path"), route.Path)
+		route.AccessListConfig.validate(v, routePath)
+	}
+}
+
+// validate проверяет адреса и подсети списка доступа
+func (c *AccessListConfig) validate(v *validator, path string) {
+	for i, s := range c.Allow {
+		if _, err := acl.ParsePrefix(s); err != nil {
+			v.check(index(field(path, "allow"), i), err)
+		}
+	}
+	for i, s := range c.Deny {
+		if _, err := acl.ParsePrefix(s); err != nil {
+			v.check(index(field(path, "deny"), i), err)
+		}
+	}
+}
+
+// validateURL проверяет, что URL бэкенда абсолютный и использует HTTP
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("некорректный URL бэкенда %q", raw)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("URL бэкенда должен быть вида http://host:port, получено %q", raw)
+	}
+	return nil
+}
+
+// validateRoutePath проверяет префикс пути маршрута; пустой путь - любой
+func validateRoutePath(v *validator, path, value string) {
+	if value != "" && !strings.HasPrefix(value, "/") {
+		v.errorf(path, "путь маршрута должен начинаться с /, получено %q", value)
+	}
+}
+
+// decode переносит разобранный документ в конфигурацию. Сначала документ проверяется
+// на неизвестные поля и некорректные длительности, чтобы сообщить
+// обо всех ошибках сразу с путями к ним
+func decode(v *validator, raw any, config *Config) error {
+	checkFields(v, "", raw, reflect.TypeOf(config).Elem())
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			v.errorf(fieldPath(typeErr.Field), "ожидается %s, получено %s", typeErr.Type, typeErr.Value)
+			return v.err()
+		}
+		return err
+	}
+	return nil
+}
+
+// parse разбирает документ JSON; пустой документ - пустая конфигурация
+func parse(data []byte) (any, error) {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, syntaxError(data, err)
+	}
+	if raw == nil {
+		raw = map[string]any{}
+	}
+	return raw, nil
+}
+
+// fieldPath переводит путь к полю из ошибки encoding/json (backends.0.weight)
+// в формат путей конфигурации (backends[0].weight)
+func fieldPath(jsonPath string) string {
+	var path string
+	for _, part := range strings.Split(jsonPath, ".") {
+		if i, err := strconv.Atoi(part); err == nil && path != "" {
+			path = index(path, i)
+			continue
+		}
+		path = field(path, part)
+	}
+	return path
+}
+
+// syntaxError дополняет ошибку разбора JSON номером строки и столбца
+func syntaxError(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return err
+	}
+	before := data[:min(int(syntaxErr.Offset), len(data))]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return fmt.Errorf("ошибка синтаксиса JSON в строке %d, столбце %d: %w", line, column, err)
+}
+
+// checkFields находит в разобранном документе поля, которых нет в типе t,
+// и длительности, которые не удается разобрать. Имена сопоставляются
+// так же, как в encoding/json: сначала точно, затем без учета регистра
+func checkFields(v *validator, path string, value any, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == durationType {
+		if _, err := parseDuration(value); err != nil {
+			v.check(path, err)
+		}
+		return
+	}
+	switch value := value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := jsonFields(t)
+			for _, key := range keys {
+				item := value[key]
+				fieldType, ok := fields[key]
+				if !ok {
+					for name, ft := range fields {
+						if strings.EqualFold(name, key) {
+							fieldType, ok = ft, true
+							break
+						}
+					}
+				}
+				if !ok {
+					v.errorf(field(path, key), "неизвестное поле")
+					continue
+				}
+				checkFields(v, field(path, key), item, fieldType)
+			}
+		case reflect.Map:
+			for _, key := range keys {
+				checkFields(v, field(path, key), value[key], t.Elem())
+			}
+		}
+	case []any:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, item := range value {
+				checkFields(v, index(path, i), item, t.Elem())
+			}
+		}
+	}
+}
+
+// jsonFields возвращает типы полей структуры по именам в JSON,
+// включая поля встроенных структур
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for embedded, ft := range jsonFields(f.Type) {
+				if _, ok := fields[embedded]; !ok {
+					fields[embedded] = ft
+				}
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
@@ -0,0 +1,41 @@
+// Package discovery находит бэкенды во внешних источниках: DNS, файлах,
+// Docker и Kubernetes. Найденные бэкенды добавляются в пул балансировщика
+// и выводятся из него, когда источник перестает их сообщать
+package discovery
+
+import (
+	"context"
+	"sort"
+)
+
+// Target - бэкенд, найденный источником
+type Target struct {
+	URL      string
+	Weight   int
+	Priority int               // Уровень приоритета, см. backend.Backend.Priority
+	Labels   map[string]string // Метки бэкенда из источника
+	// Бэкенд не готов принимать запросы: остается в пуле,
+	// но не получает запросов до готовности
+	NotReady bool
+	// Бэкенд завершает работу и выводится из пула
+	// с ожиданием начатых запросов
+	Terminating bool
+}
+
+// Provider - источник бэкендов
+type Provider interface {
+	// Name возвращает имя источника для логов; у источников одной
+	// конфигурации имена различаются
+	Name() string
+	// Run отслеживает источник до отмены ctx и передает в update полный
+	// список найденных бэкендов при каждом обновлении. Если источник
+	// недоступен, update не вызывается: бэкенды остаются в пуле
+	Run(ctx context.Context, update func([]Target))
+}
+
+// sortTargets упорядочивает бэкенды по URL, чтобы списки
+// из одного источника можно было сравнивать
+func sortTargets(targets []Target) []Target {
+	sort.Slice(targets, func(i, j int) bool { return targets[i].URL < targets[j].URL })
+	return targets
+}
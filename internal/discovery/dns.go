@@ -0,0 +1,344 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Типы DNS-записей для обнаружения бэкендов
+const (
+	DNSTypeA   = "a"   // Записи A и AAAA имени хоста
+	DNSTypeSRV = "srv" // Записи SRV: адрес, порт, вес и приоритет каждого бэкенда
+)
+
+// dnsTimeout - таймаут одного запроса к DNS-серверу
+const dnsTimeout = 2 * time.Second
+
+// DNSConfig описывает обнаружение бэкендов по DNS
+type DNSConfig struct {
+	Name     string // Имя хоста или SRV-записи, например _http._tcp.api.service.consul
+	Type     string // DNSTypeA или DNSTypeSRV
+	Port     int    // Порт бэкендов для записей A и AAAA
+	Scheme   string // http или https
+	Weight   int    // Вес бэкендов для записей A и AAAA
+	Priority int    // Уровень приоритета бэкендов для записей A и AAAA
+	Server   string // Адрес DNS-сервера host:port; пусто - первый из /etc/resolv.conf
+	// Записи перечитываются по истечении их TTL, но не чаще MinInterval
+	// и не реже MaxInterval; при ошибке запрос повторяется через MinInterval
+	MinInterval time.Duration
+	MaxInterval time.Duration
+}
+
+// DNS находит бэкенды по записям A/AAAA или SRV
+type DNS struct {
+	cfg    DNSConfig
+	logger *logger.Logger
+}
+
+// NewDNS создает источник бэкендов по DNS
+func NewDNS(cfg DNSConfig, log *logger.Logger) *DNS {
+	if cfg.Server == "" {
+		cfg.Server = systemNameserver()
+	}
+	if cfg.Scheme == "" {
+		cfg.Scheme = "http"
+	}
+	if cfg.MinInterval <= 0 {
+		cfg.MinInterval = time.Second
+	}
+	if cfg.MaxInterval < cfg.MinInterval {
+		cfg.MaxInterval = cfg.MinInterval
+	}
+	return &DNS{cfg: cfg, logger: log}
+}
+
+// Name возвращает имя источника
+func (d *DNS) Name() string {
+	return "dns " + d.cfg.Type + " " + d.cfg.Name
+}
+
+// Run перечитывает записи с периодом, определяемым их TTL
+func (d *DNS) Run(ctx context.Context, update func([]Target)) {
+	for {
+		wait := d.cfg.MinInterval
+		targets, ttl, err := d.Resolve(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			d.logger.Warn(fmt.Sprintf("Ошибка обнаружения бэкендов %s: %v", d.Name(), err))
+		default:
+			update(targets)
+			wait = min(max(ttl, d.cfg.MinInterval), d.cfg.MaxInterval)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Resolve запрашивает записи и возвращает найденные бэкенды
+// и наименьший TTL использованных записей. Ответ без адресов и
+// несуществующее имя возвращаются как ошибка: кратковременный сбой
+// DNS не должен выводить из пула все бэкенды
+func (d *DNS) Resolve(ctx context.Context) ([]Target, time.Duration, error) {
+	name, err := dnsmessage.NewName(fqdn(d.cfg.Name))
+	if err != nil {
+		return nil, 0, fmt.Errorf("некорректное имя %q: %w", d.cfg.Name, err)
+	}
+
+	var ttl minTTL
+	found := make(map[string]Target)
+	switch d.cfg.Type {
+	case DNSTypeA:
+		addrs, err := d.lookupAddrs(ctx, name, nil, &ttl)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, addr := range addrs {
+			url := d.url(addr, d.cfg.Port)
+			found[url] = Target{URL: url, Weight: d.cfg.Weight, Priority: d.cfg.Priority}
+		}
+	case DNSTypeSRV:
+		msg, err := d.exchange(ctx, name, dnsmessage.TypeSRV)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, rr := range msg.Answers {
+			srv, ok := rr.Body.(*dnsmessage.SRVResource)
+			// Цель "." означает, что сервис недоступен
+			if !ok || srv.Target.String() == "." {
+				continue
+			}
+			// Ошибка одной цели не мешает обновлять остальные
+			addrs, err := d.lookupAddrs(ctx, srv.Target, msg.Additionals, &ttl)
+			if err != nil {
+				d.logger.Warn(fmt.Sprintf("Источник %s: цель %s пропущена: %v", d.Name(), srv.Target, err))
+				continue
+			}
+			ttl.add(rr.Header.TTL)
+			for _, addr := range addrs {
+				target := Target{URL: d.url(addr, int(srv.Port)), Weight: int(srv.Weight), Priority: int(srv.Priority)}
+				// Адрес из нескольких записей получает наивысший приоритет
+				if prev, ok := found[target.URL]; !ok || target.Priority < prev.Priority {
+					found[target.URL] = target
+				}
+			}
+		}
+	default:
+		return nil, 0, fmt.Errorf("неизвестный тип записей %q", d.cfg.Type)
+	}
+
+	if len(found) == 0 {
+		return nil, 0, fmt.Errorf("для %s не найдено ни одного адреса", d.cfg.Name)
+	}
+	targets := make([]Target, 0, len(found))
+	for _, target := range found {
+		targets = append(targets, target)
+	}
+	return sortTargets(targets), ttl.duration(), nil
+}
+
+// lookupAddrs возвращает адреса имени из дополнительных записей ответа
+// SRV, а если их там нет - запрашивает записи A и AAAA. Ошибка одного
+// из запросов не учитывается, если другой вернул адреса: сервер может
+// отклонять запросы AAAA для имени только с IPv4
+func (d *DNS) lookupAddrs(ctx context.Context, name dnsmessage.Name, additionals []dnsmessage.Resource, ttl *minTTL) ([]netip.Addr, error) {
+	if addrs := addresses(name, additionals, ttl); len(addrs) > 0 {
+		return addrs, nil
+	}
+
+	var addrs []netip.Addr
+	var lookupErr error
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		msg, err := d.exchange(ctx, name, qtype)
+		if err != nil {
+			lookupErr = err
+			continue
+		}
+		// Ответ может начинаться с цепочки CNAME: адреса относятся к последнему имени
+		addrs = append(addrs, addresses(name, msg.Answers, ttl)...)
+	}
+	if len(addrs) == 0 && lookupErr != nil {
+		return nil, lookupErr
+	}
+	return addrs, nil
+}
+
+// addresses выбирает из записей адреса имени с учетом цепочки CNAME
+func addresses(name dnsmessage.Name, records []dnsmessage.Resource, ttl *minTTL) []netip.Addr {
+	names := map[string]bool{strings.ToLower(name.String()): true}
+	for _, rr := range records {
+		if cname, ok := rr.Body.(*dnsmessage.CNAMEResource); ok && names[strings.ToLower(rr.Header.Name.String())] {
+			names[strings.ToLower(cname.CNAME.String())] = true
+			ttl.add(rr.Header.TTL)
+		}
+	}
+
+	var addrs []netip.Addr
+	for _, rr := range records {
+		if !names[strings.ToLower(rr.Header.Name.String())] {
+			continue
+		}
+		switch body := rr.Body.(type) {
+		case *dnsmessage.AResource:
+			addrs = append(addrs, netip.AddrFrom4(body.A))
+		case *dnsmessage.AAAAResource:
+			addrs = append(addrs, netip.AddrFrom16(body.AAAA))
+		default:
+			continue
+		}
+		ttl.add(rr.Header.TTL)
+	}
+	return addrs
+}
+
+// url составляет URL бэкенда по адресу и порту
+func (d *DNS) url(addr netip.Addr, port int) string {
+	return d.cfg.Scheme + "://" + netip.AddrPortFrom(addr, uint16(port)).String()
+}
+
+// exchange выполняет запрос по UDP, а если ответ не поместился - по TCP.
+// Несуществующее имя (NXDOMAIN) возвращается как ошибка
+func (d *DNS) exchange(ctx context.Context, name dnsmessage.Name, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	id := uint16(rand.Uint32())
+	query, err := (&dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := d.roundTrip(ctx, "udp", query, id)
+	if err == nil && msg.Truncated {
+		msg, err = d.roundTrip(ctx, "tcp", query, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("запрос %s %s к %s: %w", qtype, name, d.cfg.Server, err)
+	}
+	switch msg.RCode {
+	case dnsmessage.RCodeSuccess:
+		return msg, nil
+	case dnsmessage.RCodeNameError:
+		return nil, fmt.Errorf("запрос %s %s к %s: имя не существует", qtype, name, d.cfg.Server)
+	default:
+		return nil, fmt.Errorf("запрос %s %s к %s: код ответа %s", qtype, name, d.cfg.Server, msg.RCode)
+	}
+}
+
+// roundTrip отправляет запрос и читает ответ с тем же идентификатором
+func (d *DNS) roundTrip(ctx context.Context, network string, query []byte, id uint16) (*dnsmessage.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, dnsTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, d.cfg.Server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+	// Отмена ctx прерывает ожидание ответа
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if network == "tcp" {
+		// По TCP сообщению предшествует его длина
+		query = append(binary.BigEndian.AppendUint16(nil, uint16(len(query))), query...)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, math.MaxUint16)
+	for {
+		var n int
+		if network == "tcp" {
+			var size [2]byte
+			if _, err := io.ReadFull(conn, size[:]); err != nil {
+				return nil, err
+			}
+			n = int(binary.BigEndian.Uint16(size[:]))
+			if _, err := io.ReadFull(conn, buf[:n]); err != nil {
+				return nil, err
+			}
+		} else if n, err = conn.Read(buf); err != nil {
+			return nil, err
+		}
+
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf[:n]); err != nil {
+			return nil, err
+		}
+		// Ответы на чужие запросы пропускаются
+		if msg.ID == id && msg.Response {
+			return &msg, nil
+		}
+		if network == "tcp" {
+			return nil, errors.New("ответ не соответствует запросу")
+		}
+	}
+}
+
+// fqdn добавляет к имени завершающую точку
+func fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// systemNameserver возвращает первый DNS-сервер из /etc/resolv.conf
+func systemNameserver() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				return net.JoinHostPort(fields[1], "53")
+			}
+		}
+	}
+	return "127.0.0.1:53"
+}
+
+// minTTL отслеживает наименьший TTL использованных записей
+type minTTL struct {
+	seconds uint32
+	set     bool
+}
+
+// add учитывает TTL записи
+func (t *minTTL) add(seconds uint32) {
+	if !t.set || seconds < t.seconds {
+		t.seconds, t.set = seconds, true
+	}
+}
+
+// duration возвращает наименьший TTL; 0 - записей не было
+func (t *minTTL) duration() time.Duration {
+	return time.Duration(t.seconds) * time.Second
+}
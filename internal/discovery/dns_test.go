@@ -0,0 +1,335 @@
+package discovery
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeDNS - DNS-сервер для тестов, отвечающий по UDP и TCP на одном порту
+type fakeDNS struct {
+	addr     string
+	mu       sync.Mutex
+	records  []dnsmessage.Resource
+	truncate bool // Ответы по UDP обрезаются, полный ответ - только по TCP
+	// Типы запросов, на которые сервер отвечает REFUSED
+	refused map[dnsmessage.Type]bool
+}
+
+// newFakeDNS запускает DNS-сервер на свободном порту
+func newFakeDNS(t *testing.T, records ...dnsmessage.Resource) *fakeDNS {
+	t.Helper()
+	s := &fakeDNS{records: records}
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Не удалось запустить DNS-сервер: %v", err)
+	}
+	s.addr = udp.LocalAddr().String()
+	tcp, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		udp.Close()
+		t.Fatalf("Не удалось запустить DNS-сервер по TCP: %v", err)
+	}
+	t.Cleanup(func() {
+		udp.Close()
+		tcp.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := s.answer(buf[:n], true); resp != nil {
+				_, _ = udp.WriteTo(resp, addr)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var size [2]byte
+				if _, err := io.ReadFull(conn, size[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(size[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				if resp := s.answer(query, false); resp != nil {
+					_, _ = conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+				}
+			}()
+		}
+	}()
+	return s
+}
+
+// set заменяет записи сервера
+func (s *fakeDNS) set(records ...dnsmessage.Resource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = records
+}
+
+// answer составляет ответ: записи запрошенного типа с учетом CNAME,
+// для SRV - адреса целей в дополнительных записях
+func (s *fakeDNS) answer(query []byte, udp bool) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil || len(msg.Questions) != 1 {
+		return nil
+	}
+	q := msg.Questions[0]
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: msg.ID, Response: true, Authoritative: true},
+		Questions: msg.Questions,
+	}
+	if s.refused[q.Type] {
+		resp.RCode = dnsmessage.RCodeRefused
+	} else if udp && s.truncate {
+		resp.Truncated = true
+	} else {
+		resp.Answers = s.lookup(q.Name.String(), q.Type)
+		if q.Type == dnsmessage.TypeSRV {
+			for _, rr := range resp.Answers {
+				target := rr.Body.(*dnsmessage.SRVResource).Target.String()
+				resp.Additionals = append(resp.Additionals, s.lookup(target, dnsmessage.TypeA)...)
+			}
+		}
+		if len(resp.Answers) == 0 && len(s.lookup(q.Name.String(), 0)) == 0 {
+			resp.RCode = dnsmessage.RCodeNameError
+		}
+	}
+	data, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// lookup возвращает записи имени заданного типа, следуя CNAME;
+// нулевой тип - записи любого типа
+func (s *fakeDNS) lookup(name string, qtype dnsmessage.Type) []dnsmessage.Resource {
+	var result []dnsmessage.Resource
+	for _, rr := range s.records {
+		if !strings.EqualFold(rr.Header.Name.String(), name) {
+			continue
+		}
+		if cname, ok := rr.Body.(*dnsmessage.CNAMEResource); ok && qtype != 0 {
+			result = append(result, rr)
+			result = append(result, s.lookup(cname.CNAME.String(), qtype)...)
+			continue
+		}
+		if qtype == 0 || rr.Header.Type == qtype {
+			result = append(result, rr)
+		}
+	}
+	return result
+}
+
+// record создает запись DNS
+func record(name string, ttl uint32, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	header := dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Class: dnsmessage.ClassINET, TTL: ttl}
+	switch body.(type) {
+	case *dnsmessage.AResource:
+		header.Type = dnsmessage.TypeA
+	case *dnsmessage.AAAAResource:
+		header.Type = dnsmessage.TypeAAAA
+	case *dnsmessage.CNAMEResource:
+		header.Type = dnsmessage.TypeCNAME
+	case *dnsmessage.SRVResource:
+		header.Type = dnsmessage.TypeSRV
+	}
+	return dnsmessage.Resource{Header: header, Body: body}
+}
+
+func a(ip string) *dnsmessage.AResource {
+	return &dnsmessage.AResource{A: netip.MustParseAddr(ip).As4()}
+}
+
+func aaaa(ip string) *dnsmessage.AAAAResource {
+	return &dnsmessage.AAAAResource{AAAA: netip.MustParseAddr(ip).As16()}
+}
+
+func srv(priority, weight, port uint16, target string) *dnsmessage.SRVResource {
+	return &dnsmessage.SRVResource{Priority: priority, Weight: weight, Port: port, Target: dnsmessage.MustNewName(target)}
+}
+
+func TestDNSRecordsA(t *testing.T) {
+	server := newFakeDNS(t,
+		record("www.test.", 60, &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("api.test.")}),
+		record("api.test.", 30, a("10.0.0.1")),
+		record("api.test.", 10, aaaa("fd00::1")),
+		record("other.test.", 5, a("10.0.0.9")),
+		record("empty.test.", 5, &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("missing.test.")}),
+	)
+	dns := NewDNS(DNSConfig{Name: "www.test", Type: DNSTypeA, Port: 8080, Weight: 2, Priority: 1, Server: server.addr}, logger.New("error"))
+
+	targets, ttl, err := dns.Resolve(context.Background())
+	if err != nil {
+		t.Fatalf("Ошибка запроса: %v", err)
+	}
+	want := []Target{
+		{URL: "http://10.0.0.1:8080", Weight: 2, Priority: 1},
+		{URL: "http://[fd00::1]:8080", Weight: 2, Priority: 1},
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("Бэкенды %+v, ожидалось %+v", targets, want)
+	}
+	if ttl != 10*time.Second {
+		t.Errorf("TTL %v, ожидался наименьший из записей 10s", ttl)
+	}
+
+	// Несуществующее имя и имя без адресов - ошибка, а не пустой список
+	for _, name := range []string{"missing.test", "empty.test"} {
+		dns = NewDNS(DNSConfig{Name: name, Type: DNSTypeA, Port: 8080, Server: server.addr}, logger.New("error"))
+		if targets, _, err := dns.Resolve(context.Background()); err == nil {
+			t.Errorf("Для %s ожидалась ошибка, получено %+v", name, targets)
+		}
+	}
+}
+
+func TestDNSRecordsSRV(t *testing.T) {
+	server := newFakeDNS(t,
+		record("_http._tcp.api.test.", 20, srv(10, 5, 8001, "a.test.")),
+		record("_http._tcp.api.test.", 20, srv(20, 1, 8002, "b.test.")),
+		record("_http._tcp.api.test.", 20, srv(30, 1, 8003, ".")),
+		record("a.test.", 15, a("10.0.0.1")),
+		// Адреса b.test есть только в ответе на отдельный запрос AAAA
+		record("b.test.", 40, aaaa("fd00::2")),
+	)
+	dns := NewDNS(DNSConfig{Name: "_http._tcp.api.test.", Type: DNSTypeSRV, Scheme: "https", Server: server.addr}, logger.New("error"))
+
+	check := func() {
+		t.Helper()
+		targets, ttl, err := dns.Resolve(context.Background())
+		if err != nil {
+			t.Fatalf("Ошибка запроса: %v", err)
+		}
+		want := []Target{
+			{URL: "https://10.0.0.1:8001", Weight: 5, Priority: 10},
+			{URL: "https://[fd00::2]:8002", Weight: 1, Priority: 20},
+		}
+		if !reflect.DeepEqual(targets, want) {
+			t.Errorf("Бэкенды %+v, ожидалось %+v", targets, want)
+		}
+		if ttl != 15*time.Second {
+			t.Errorf("TTL %v, ожидалось 15s", ttl)
+		}
+	}
+	check()
+
+	// Ответ, не поместившийся в UDP, запрашивается по TCP
+	server.mu.Lock()
+	server.truncate = true
+	server.mu.Unlock()
+	check()
+}
+
+func TestDNSRecordsSRVDeadTarget(t *testing.T) {
+	server := newFakeDNS(t,
+		record("_http._tcp.api.test.", 20, srv(10, 1, 8001, "a.test.")),
+		// Выведенная из работы цель: имени больше нет (NXDOMAIN)
+		record("_http._tcp.api.test.", 20, srv(10, 1, 8002, "dead.test.")),
+		record("a.test.", 15, a("10.0.0.1")),
+	)
+	dns := NewDNS(DNSConfig{Name: "_http._tcp.api.test.", Type: DNSTypeSRV, Server: server.addr}, logger.New("error"))
+
+	targets, _, err := dns.Resolve(context.Background())
+	if err != nil {
+		t.Fatalf("Ошибка одной цели не должна прерывать запрос: %v", err)
+	}
+	if len(targets) != 1 || targets[0].URL != "http://10.0.0.1:8001" {
+		t.Errorf("Ожидался только бэкенд живой цели, получено %+v", targets)
+	}
+
+	// Отказ на запрос AAAA не мешает адресам из записей A
+	dns = NewDNS(DNSConfig{Name: "a.test", Type: DNSTypeA, Port: 80, Server: server.addr}, logger.New("error"))
+	server.mu.Lock()
+	server.refused = map[dnsmessage.Type]bool{dnsmessage.TypeAAAA: true}
+	server.mu.Unlock()
+	if targets, _, err := dns.Resolve(context.Background()); err != nil || len(targets) != 1 {
+		t.Errorf("При отказе на AAAA получено %+v, %v", targets, err)
+	}
+
+	// Если ни одна цель не дала адресов, запрос завершается ошибкой
+	server.set(record("_http._tcp.api.test.", 20, srv(10, 1, 8002, "dead.test.")))
+	dns = NewDNS(DNSConfig{Name: "_http._tcp.api.test.", Type: DNSTypeSRV, Server: server.addr}, logger.New("error"))
+	if targets, _, err := dns.Resolve(context.Background()); err == nil {
+		t.Errorf("Ожидалась ошибка, получено %+v", targets)
+	}
+}
+
+func TestDNSRefresh(t *testing.T) {
+	server := newFakeDNS(t, record("api.test.", 0, a("10.0.0.1")))
+	dns := NewDNS(DNSConfig{
+		Name: "api.test", Type: DNSTypeA, Port: 80, Server: server.addr,
+		MinInterval: 10 * time.Millisecond, MaxInterval: time.Second,
+	}, logger.New("error"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan []Target, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dns.Run(ctx, func(targets []Target) {
+			select {
+			case updates <- targets:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	wait := func(url string) {
+		t.Helper()
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case targets := <-updates:
+				if len(targets) == 1 && targets[0].URL == url {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("Не получен бэкенд %s", url)
+			}
+		}
+	}
+	wait("http://10.0.0.1:80")
+	server.set(record("api.test.", 0, a("10.0.0.2")))
+	wait("http://10.0.0.2:80")
+
+	// NXDOMAIN не применяется: пул остается прежним до следующего ответа с адресами
+	server.set()
+	select {
+	case targets := <-updates:
+		t.Fatalf("После NXDOMAIN применен список %+v", targets)
+	case <-time.After(100 * time.Millisecond):
+	}
+	server.set(record("api.test.", 0, a("10.0.0.3")))
+	wait("http://10.0.0.3:80")
+}
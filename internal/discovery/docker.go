@@ -0,0 +1,316 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+// Метки контейнеров для обнаружения бэкендов
+const (
+	DockerLabelPool     = "lb.pool"     // Пул, в который входит контейнер
+	DockerLabelPort     = "lb.port"     // Порт бэкенда в контейнере
+	DockerLabelWeight   = "lb.weight"   // Вес бэкенда
+	DockerLabelPriority = "lb.priority" // Уровень приоритета бэкенда
+)
+
+// dockerTimeout - таймаут запроса списка контейнеров
+const dockerTimeout = 10 * time.Second
+
+// dockerActions - события контейнеров, после которых список перечитывается
+var dockerActions = map[string]bool{
+	"start": true, "restart": true, "die": true, "stop": true, "kill": true,
+	"pause": true, "unpause": true, "destroy": true,
+}
+
+// DockerConfig описывает обнаружение бэкендов среди контейнеров Docker
+type DockerConfig struct {
+	Socket   string // Путь к unix-сокету Docker Engine API
+	Pool     string // Значение метки lb.pool выбираемых контейнеров
+	Network  string // Сеть, адрес в которой получает бэкенд; пусто - первая по имени
+	Port     int    // Порт контейнеров без метки lb.port
+	Scheme   string // http или https
+	Weight   int    // Вес контейнеров без метки lb.weight
+	Priority int    // Уровень приоритета контейнеров без метки lb.priority
+	// Период повторного подключения после ошибки или разрыва потока событий
+	RetryInterval time.Duration
+}
+
+// dockerContainer - контейнер в ответе /containers/json
+type dockerContainer struct {
+	ID              string            `json:"Id"`
+	Names           []string          `json:"Names"`
+	State           string            `json:"State"`
+	Labels          map[string]string `json:"Labels"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress         string `json:"IPAddress"`
+			GlobalIPv6Address string `json:"GlobalIPv6Address"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// dockerEvent - событие из потока /events
+type dockerEvent struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+}
+
+// Docker находит бэкенды среди запущенных контейнеров с меткой lb.pool
+// и отслеживает их запуск и остановку по потоку событий Docker
+type Docker struct {
+	cfg    DockerConfig
+	client *http.Client
+	logger *logger.Logger
+}
+
+// NewDocker создает источник бэкендов по контейнерам Docker
+func NewDocker(cfg DockerConfig, log *logger.Logger) *Docker {
+	cfg.Socket = strings.TrimPrefix(cfg.Socket, "unix://")
+	if cfg.Socket == "" {
+		cfg.Socket = "/var/run/docker.sock"
+	}
+	if cfg.Scheme == "" {
+		cfg.Scheme = "http"
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = 5 * time.Second
+	}
+	socket := cfg.Socket
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &Docker{cfg: cfg, client: &http.Client{Transport: transport}, logger: log}
+}
+
+// Name возвращает имя источника
+func (d *Docker) Name() string {
+	return "docker " + d.cfg.Pool
+}
+
+// Run подписывается на события контейнеров пула и перечитывает их список
+// при подключении и после каждого запуска или остановки контейнера.
+// После ошибки подключение повторяется через RetryInterval
+func (d *Docker) Run(ctx context.Context, update func([]Target)) {
+	for {
+		err := d.watch(ctx, update)
+		if ctx.Err() != nil {
+			return
+		}
+		d.logger.Warn(fmt.Sprintf("Ошибка обнаружения бэкендов %s: %v", d.Name(), err))
+
+		timer := time.NewTimer(d.cfg.RetryInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// watch читает поток событий до его разрыва. Список контейнеров
+// запрашивается после подписки, чтобы не пропустить события между ними
+func (d *Docker) watch(ctx context.Context, update func([]Target)) error {
+	resp, err := d.get(ctx, "/events", url.Values{"filters": {d.filters(map[string][]string{"type": {"container"}})}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	refresh := func() error {
+		targets, err := d.Containers(ctx)
+		if err != nil {
+			return err
+		}
+		update(targets)
+		return nil
+	}
+	if err := refresh(); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event dockerEvent
+		if err := decoder.Decode(&event); err != nil {
+			if err == io.EOF {
+				return errors.New("поток событий закрыт")
+			}
+			return fmt.Errorf("поток событий: %w", err)
+		}
+		if event.Type == "container" && dockerActions[event.Action] {
+			if err := refresh(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Containers возвращает бэкенды запущенных контейнеров пула. Контейнеры
+// с некорректными метками или без адреса пропускаются с предупреждением
+func (d *Docker) Containers(ctx context.Context) ([]Target, error) {
+	ctx, cancel := context.WithTimeout(ctx, dockerTimeout)
+	defer cancel()
+	resp, err := d.get(ctx, "/containers/json", url.Values{"filters": {d.filters(map[string][]string{"status": {"running"}})}})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var containers []dockerContainer
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("некорректный список контейнеров: %w", err)
+	}
+
+	targets := make([]Target, 0, len(containers))
+	seen := make(map[string]bool, len(containers))
+	for _, c := range containers {
+		// Приостановленные контейнеры не отвечают на запросы
+		if c.State != "running" || c.Labels[DockerLabelPool] != d.cfg.Pool {
+			continue
+		}
+		target, err := d.target(c)
+		if err != nil {
+			d.logger.Warn(fmt.Sprintf("Контейнер %s пропущен: %v", c.name(), err))
+			continue
+		}
+		if seen[target.URL] {
+			continue
+		}
+		seen[target.URL] = true
+		targets = append(targets, target)
+	}
+	return sortTargets(targets), nil
+}
+
+// target строит бэкенд по адресу и меткам контейнера
+func (d *Docker) target(c dockerContainer) (Target, error) {
+	port, err := labelInt(c.Labels, DockerLabelPort, d.cfg.Port)
+	if err != nil {
+		return Target{}, err
+	}
+	if port < 1 || port > 65535 {
+		return Target{}, fmt.Errorf("не задан порт: метка %s или порт источника", DockerLabelPort)
+	}
+	weight, err := labelInt(c.Labels, DockerLabelWeight, d.cfg.Weight)
+	if err != nil {
+		return Target{}, err
+	}
+	priority, err := labelInt(c.Labels, DockerLabelPriority, d.cfg.Priority)
+	if err != nil {
+		return Target{}, err
+	}
+	if weight < 0 || priority < 0 {
+		return Target{}, errors.New("вес и приоритет не могут быть отрицательными")
+	}
+
+	addr := c.address(d.cfg.Network)
+	if addr == "" {
+		if d.cfg.Network != "" {
+			return Target{}, fmt.Errorf("нет адреса в сети %s", d.cfg.Network)
+		}
+		return Target{}, errors.New("нет адреса ни в одной сети")
+	}
+
+	labels := make(map[string]string)
+	for key, value := range c.Labels {
+		if strings.HasPrefix(key, "lb.") {
+			labels[key] = value
+		}
+	}
+	return Target{
+		URL:      d.cfg.Scheme + "://" + net.JoinHostPort(addr, strconv.Itoa(port)),
+		Weight:   weight,
+		Priority: priority,
+		Labels:   labels,
+	}, nil
+}
+
+// filters кодирует фильтр запроса к Docker API по метке пула
+func (d *Docker) filters(extra map[string][]string) string {
+	filters := map[string][]string{"label": {DockerLabelPool + "=" + d.cfg.Pool}}
+	for key, values := range extra {
+		filters[key] = values
+	}
+	data, _ := json.Marshal(filters)
+	return string(data)
+}
+
+// get выполняет GET-запрос к Docker API
+func (d *Docker) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker"+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: статус %d: %s", path, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// labelInt возвращает числовое значение метки или def, если метка не задана
+func labelInt(labels map[string]string, key string, def int) (int, error) {
+	value, ok := labels[key]
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("метка %s: ожидалось целое число, получено %q", key, value)
+	}
+	return n, nil
+}
+
+// address возвращает адрес контейнера в сети network
+// или, если она не задана, в первой по имени сети
+func (c dockerContainer) address(network string) string {
+	networks := c.NetworkSettings.Networks
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		if network == "" || name == network {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ip := networks[name].IPAddress; ip != "" {
+			return ip
+		}
+		if ip := networks[name].GlobalIPv6Address; ip != "" {
+			return ip
+		}
+	}
+	return ""
+}
+
+// name возвращает имя контейнера для логов
+func (c dockerContainer) name() string {
+	if len(c.Names) > 0 {
+		return strings.TrimPrefix(c.Names[0], "/")
+	}
+	if len(c.ID) > 12 {
+		return c.ID[:12]
+	}
+	return c.ID
+}
@@ -0,0 +1,200 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+// fakeDocker - Docker Engine API для тестов на локальном unix-сокете
+type fakeDocker struct {
+	socket     string
+	mu         sync.Mutex
+	containers []map[string]any
+	events     chan string   // События потока /events
+	closed     chan struct{} // Закрывает текущий поток событий
+}
+
+// newFakeDocker запускает Docker API на unix-сокете во временном каталоге
+func newFakeDocker(t *testing.T) *fakeDocker {
+	t.Helper()
+	// Путь к unix-сокету ограничен ~100 байтами, t.TempDir() может быть длиннее
+	dir, err := os.MkdirTemp("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	d := &fakeDocker{
+		socket: filepath.Join(dir, "docker.sock"),
+		events: make(chan string),
+		closed: make(chan struct{}),
+	}
+	listener, err := net.Listen("unix", d.socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /containers/json", func(w http.ResponseWriter, r *http.Request) {
+		var filters map[string][]string
+		if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil ||
+			!reflect.DeepEqual(filters["label"], []string{"lb.pool=api"}) {
+			http.Error(w, `{"message": "неверный фильтр"}`, http.StatusBadRequest)
+			return
+		}
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(d.containers)
+	})
+	mux.HandleFunc("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		closed := d.closed
+		d.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case event := <-d.events:
+				_, _ = w.Write([]byte(event + "\n"))
+				w.(http.Flusher).Flush()
+			case <-closed:
+				return
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+
+	server := httptest.NewUnstartedServer(mux)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return d
+}
+
+// set заменяет список контейнеров
+func (d *fakeDocker) set(containers ...map[string]any) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.containers = containers
+}
+
+// event отправляет событие контейнера в поток
+func (d *fakeDocker) event(action string) {
+	d.events <- `{"Type": "container", "Action": "` + action + `", "Actor": {"ID": "c1"}}`
+}
+
+// disconnect разрывает текущий поток событий
+func (d *fakeDocker) disconnect() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	close(d.closed)
+	d.closed = make(chan struct{})
+}
+
+// container описывает контейнер в формате /containers/json
+func container(name, state, ip string, labels map[string]string) map[string]any {
+	return map[string]any{
+		"Id":     name + "0123456789abcdef",
+		"Names":  []string{"/" + name},
+		"State":  state,
+		"Labels": labels,
+		"NetworkSettings": map[string]any{
+			"Networks": map[string]any{"app_default": map[string]any{"IPAddress": ip}},
+		},
+	}
+}
+
+func TestDockerContainers(t *testing.T) {
+	server := newFakeDocker(t)
+	server.set(
+		container("api-1", "running", "172.18.0.2", map[string]string{"lb.pool": "api", "lb.port": "8080", "lb.weight": "2", "com.docker.compose.service": "api"}),
+		container("api-2", "running", "172.18.0.3", map[string]string{"lb.pool": "api", "lb.priority": "1"}),
+		container("api-3", "paused", "172.18.0.4", map[string]string{"lb.pool": "api", "lb.port": "8080"}),
+		container("api-4", "running", "172.18.0.5", map[string]string{"lb.pool": "api", "lb.port": "http"}),
+		container("api-5", "running", "", map[string]string{"lb.pool": "api", "lb.port": "8080"}),
+	)
+	docker := NewDocker(DockerConfig{Socket: "unix://" + server.socket, Pool: "api", Port: 9000}, logger.New("error"))
+
+	targets, err := docker.Containers(context.Background())
+	if err != nil {
+		t.Fatalf("Ошибка запроса контейнеров: %v", err)
+	}
+	want := []Target{
+		{URL: "http://172.18.0.2:8080", Weight: 2, Labels: map[string]string{"lb.pool": "api", "lb.port": "8080", "lb.weight": "2"}},
+		{URL: "http://172.18.0.3:9000", Priority: 1, Labels: map[string]string{"lb.pool": "api", "lb.priority": "1"}},
+	}
+	if !reflect.DeepEqual(targets, want) {
+		t.Errorf("Получены бэкенды %+v, ожидались %+v", targets, want)
+	}
+
+	// Контейнеры без порта пропускаются
+	docker = NewDocker(DockerConfig{Socket: server.socket, Pool: "api"}, logger.New("error"))
+	if targets, err := docker.Containers(context.Background()); err != nil || len(targets) != 1 {
+		t.Errorf("Без порта по умолчанию ожидался один бэкенд, получено %+v, %v", targets, err)
+	}
+}
+
+func TestDockerEvents(t *testing.T) {
+	server := newFakeDocker(t)
+	server.set(container("api-1", "running", "172.18.0.2", map[string]string{"lb.pool": "api", "lb.port": "80"}))
+	docker := NewDocker(DockerConfig{Socket: server.socket, Pool: "api", RetryInterval: 10 * time.Millisecond}, logger.New("error"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan []Target, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		docker.Run(ctx, func(targets []Target) {
+			select {
+			case updates <- targets:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	wait := func(urls ...string) {
+		t.Helper()
+		select {
+		case targets := <-updates:
+			var got []string
+			for _, target := range targets {
+				got = append(got, target.URL)
+			}
+			if strings.Join(got, " ") != strings.Join(urls, " ") {
+				t.Fatalf("Получены бэкенды %v, ожидались %v", got, urls)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Не получены бэкенды %v", urls)
+		}
+	}
+	wait("http://172.18.0.2:80")
+
+	// Запуск контейнера добавляет бэкенд
+	server.set(
+		container("api-1", "running", "172.18.0.2", map[string]string{"lb.pool": "api", "lb.port": "80"}),
+		container("api-2", "running", "172.18.0.3", map[string]string{"lb.pool": "api", "lb.port": "80"}),
+	)
+	server.event("start")
+	wait("http://172.18.0.2:80", "http://172.18.0.3:80")
+
+	// После разрыва потока событий список перечитывается при переподключении
+	server.set(container("api-2", "running", "172.18.0.3", map[string]string{"lb.pool": "api", "lb.port": "80"}))
+	server.disconnect()
+	wait("http://172.18.0.3:80")
+}
@@ -0,0 +1,155 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+	"gopkg.in/yaml.v3"
+)
+
+// Форматы файла со списком бэкендов
+const (
+	FileFormatJSON = "json"
+	FileFormatYAML = "yaml"
+)
+
+// FileConfig описывает обнаружение бэкендов по файлу со списком
+type FileConfig struct {
+	Path     string
+	Format   string        // FileFormatJSON или FileFormatYAML
+	Interval time.Duration // Период проверки времени изменения файла
+}
+
+// fileTarget - элемент списка бэкендов в файле
+type fileTarget struct {
+	URL      string            `json:"url" yaml:"url"`
+	Weight   int               `json:"weight" yaml:"weight"`
+	Priority int               `json:"priority" yaml:"priority"`
+	Labels   map[string]string `json:"labels" yaml:"labels"`
+}
+
+// File находит бэкенды в файле, который ведут внешние скрипты.
+// Файл перечитывается при изменении; некорректный файл не применяется
+type File struct {
+	cfg    FileConfig
+	logger *logger.Logger
+}
+
+// NewFile создает источник бэкендов по файлу
+func NewFile(cfg FileConfig, log *logger.Logger) *File {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	return &File{cfg: cfg, logger: log}
+}
+
+// Name возвращает имя источника
+func (f *File) Name() string {
+	return "file " + f.cfg.Path
+}
+
+// Run читает файл сразу и затем при каждом изменении времени его
+// изменения. Ошибка логируется один раз, пока файл не будет исправлен
+func (f *File) Run(ctx context.Context, update func([]Target)) {
+	var mtime time.Time
+	failed := false
+	check := func() {
+		info, err := os.Stat(f.cfg.Path)
+		if err == nil && !mtime.IsZero() && info.ModTime().Equal(mtime) {
+			return
+		}
+		var targets []Target
+		if err == nil {
+			// Некорректный файл перечитывается только после следующего изменения
+			mtime = info.ModTime()
+			targets, err = f.Load()
+		}
+		if err != nil {
+			if !failed {
+				f.logger.Error(fmt.Sprintf("Список бэкендов %s не применен, пул не изменен: %v", f.cfg.Path, err))
+			}
+			failed = true
+			return
+		}
+		failed = false
+		update(targets)
+	}
+
+	check()
+	ticker := time.NewTicker(f.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			check()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Load читает и проверяет список бэкендов. Пустой файл считается
+// некорректным: его могут прочитать в момент записи; пустой пул
+// задается пустым списком
+func (f *File) Load() ([]Target, error) {
+	data, err := os.ReadFile(f.cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, errors.New("файл пуст")
+	}
+
+	var items []fileTarget
+	switch f.cfg.Format {
+	case FileFormatJSON:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&items)
+	case FileFormatYAML:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&items)
+	default:
+		return nil, fmt.Errorf("неизвестный формат %q", f.cfg.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make([]Target, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for i, item := range items {
+		if err := validateTarget(item); err != nil {
+			return nil, fmt.Errorf("бэкенд [%d]: %w", i, err)
+		}
+		if seen[item.URL] {
+			return nil, fmt.Errorf("бэкенд [%d]: %s уже задан", i, item.URL)
+		}
+		seen[item.URL] = true
+		targets = append(targets, Target{URL: item.URL, Weight: item.Weight, Priority: item.Priority, Labels: item.Labels})
+	}
+	return sortTargets(targets), nil
+}
+
+// validateTarget проверяет элемент списка бэкендов
+func validateTarget(item fileTarget) error {
+	u, err := url.Parse(item.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("URL должен быть вида http://host:port, получено %q", item.URL)
+	}
+	if item.Weight < 0 {
+		return fmt.Errorf("вес не может быть отрицательным, получено %d", item.Weight)
+	}
+	if item.Priority < 0 {
+		return fmt.Errorf("приоритет не может быть отрицательным, получено %d", item.Priority)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+// writeTargets записывает список бэкендов и сдвигает время изменения файла,
+// чтобы запись была заметна при грубом разрешении времени файловой системы
+func writeTargets(t *testing.T, path, data string, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileLoad(t *testing.T) {
+	dir := t.TempDir()
+	want := []Target{
+		{URL: "http://10.0.0.1:8080", Weight: 2, Labels: map[string]string{"zone": "a"}},
+		{URL: "http://10.0.0.2:8080", Priority: 1},
+	}
+
+	jsonPath := filepath.Join(dir, "targets.json")
+	writeTargets(t, jsonPath, `[
+		{"url": "http://10.0.0.2:8080", "priority": 1},
+		{"url": "http://10.0.0.1:8080", "weight": 2, "labels": {"zone": "a"}}
+	]`, time.Now())
+	yamlPath := filepath.Join(dir, "targets.yaml")
+	writeTargets(t, yamlPath, `
+- url: http://10.0.0.1:8080
+  weight: 2
+  labels:
+    zone: a
+- url: http://10.0.0.2:8080
+  priority: 1
+`, time.Now())
+
+	for path, format := range map[string]string{jsonPath: FileFormatJSON, yamlPath: FileFormatYAML} {
+		targets, err := NewFile(FileConfig{Path: path, Format: format}, logger.New("error")).Load()
+		if err != nil {
+			t.Fatalf("%s: ошибка чтения: %v", format, err)
+		}
+		if !reflect.DeepEqual(targets, want) {
+			t.Errorf("%s: получены бэкенды %+v, ожидались %+v", format, targets, want)
+		}
+	}
+
+	// Пустой список допустим и выводит все бэкенды из пула
+	writeTargets(t, jsonPath, `[]`, time.Now())
+	if targets, err := NewFile(FileConfig{Path: jsonPath, Format: FileFormatJSON}, logger.New("error")).Load(); err != nil || len(targets) != 0 {
+		t.Errorf("Для пустого списка получено %v, %v", targets, err)
+	}
+}
+
+func TestFileLoadErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	for name, data := range map[string]string{
+		"пустой файл":          "  \n",
+		"оборванная запись":    `[{"url": "http://10.0.0.1:8080"`,
+		"неизвестное поле":     `[{"url": "http://10.0.0.1:8080", "wieght": 2}]`,
+		"некорректный URL":     `[{"url": "10.0.0.1:8080"}]`,
+		"отрицательный вес":    `[{"url": "http://10.0.0.1:8080", "weight": -1}]`,
+		"повторяющийся бэкенд": `[{"url": "http://10.0.0.1:8080"}, {"url": "http://10.0.0.1:8080"}]`,
+	} {
+		writeTargets(t, path, data, time.Now())
+		if targets, err := NewFile(FileConfig{Path: path, Format: FileFormatJSON}, logger.New("error")).Load(); err == nil {
+			t.Errorf("%s: ожидалась ошибка, получено %v", name, targets)
+		}
+	}
+}
+
+func TestFileWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	mtime := time.Now().Add(-time.Hour)
+	writeTargets(t, path, `[{"url": "http://10.0.0.1:8080"}]`, mtime)
+	file := NewFile(FileConfig{Path: path, Format: FileFormatJSON, Interval: 10 * time.Millisecond}, logger.New("error"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan []Target, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		file.Run(ctx, func(targets []Target) {
+			select {
+			case updates <- targets:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	wait := func(url string) {
+		t.Helper()
+		select {
+		case targets := <-updates:
+			if len(targets) != 1 || targets[0].URL != url {
+				t.Fatalf("Получены бэкенды %+v, ожидался %s", targets, url)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Не получен бэкенд %s", url)
+		}
+	}
+	wait("http://10.0.0.1:8080")
+
+	// Некорректный файл не применяется, пул не изменяется
+	writeTargets(t, path, `[{"url": "http://10.0.0.2:8080"`, mtime.Add(time.Second))
+	select {
+	case targets := <-updates:
+		t.Fatalf("Некорректный файл применен: %+v", targets)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	writeTargets(t, path, `[{"url": "http://10.0.0.2:8080"}]`, mtime.Add(2*time.Second))
+	wait("http://10.0.0.2:8080")
+}
@@ -0,0 +1,266 @@
+package discovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// serviceAccountDir - каталог токена и сертификата сервисного аккаунта пода
+var serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeClient выполняет запросы к Kubernetes API
+type kubeClient struct {
+	server    string // Адрес API-сервера https://host:port
+	namespace string // Пространство имен по умолчанию из kubeconfig или пода
+	http      *http.Client
+	// token возвращает токен для заголовка Authorization; токен
+	// сервисного аккаунта перечитывается, так как kubelet его обновляет
+	token func() (string, error)
+}
+
+// kubeStatus - ответ API об ошибке
+type kubeStatus struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (s *kubeStatus) Error() string {
+	return fmt.Sprintf("статус %d %s: %s", s.Code, s.Reason, s.Message)
+}
+
+// kubeconfig - используемая часть файла kubeconfig
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string    `yaml:"token"`
+			TokenFile             string    `yaml:"tokenFile"`
+			ClientCertificate     string    `yaml:"client-certificate"`
+			ClientCertificateData string    `yaml:"client-certificate-data"`
+			ClientKey             string    `yaml:"client-key"`
+			ClientKeyData         string    `yaml:"client-key-data"`
+			Exec                  yaml.Node `yaml:"exec"`
+			AuthProvider          yaml.Node `yaml:"auth-provider"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// newKubeClient создает клиент по файлу kubeconfig или, если путь
+// не задан, по сервисному аккаунту пода
+func newKubeClient(path string) (*kubeClient, error) {
+	if path == "" {
+		return inClusterClient()
+	}
+	return kubeconfigClient(path)
+}
+
+// inClusterClient создает клиент по сервисному аккаунту пода
+func inClusterClient() (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("балансировщик запущен не в поде Kubernetes: укажите kubeconfig")
+	}
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if tlsConfig.RootCAs, err = certPool(ca); err != nil {
+		return nil, err
+	}
+	namespace, _ := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	tokenPath := filepath.Join(serviceAccountDir, "token")
+	return &kubeClient{
+		server:    "https://" + net.JoinHostPort(host, port),
+		namespace: strings.TrimSpace(string(namespace)),
+		http:      &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+		token:     func() (string, error) { return readToken(tokenPath) },
+	}, nil
+}
+
+// kubeconfigClient создает клиент по текущему контексту файла kubeconfig.
+// Поддерживаются токены и клиентские сертификаты; относительные пути
+// отсчитываются от каталога файла
+func kubeconfigClient(path string) (*kubeClient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg kubeconfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("некорректный kubeconfig %s: %w", path, err)
+	}
+	dir := filepath.Dir(path)
+	resolve := func(file string) string {
+		if file == "" || filepath.IsAbs(file) {
+			return file
+		}
+		return filepath.Join(dir, file)
+	}
+
+	client := &kubeClient{}
+	var clusterName, userName string
+	found := false
+	for _, c := range cfg.Contexts {
+		if c.Name == cfg.CurrentContext {
+			clusterName, userName, client.namespace = c.Context.Cluster, c.Context.User, c.Context.Namespace
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("kubeconfig %s: не найден текущий контекст %q", path, cfg.CurrentContext)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	found = false
+	for _, c := range cfg.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		found = true
+		client.server = strings.TrimSuffix(c.Cluster.Server, "/")
+		tlsConfig.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		ca, err := fileOrData(resolve(c.Cluster.CertificateAuthority), c.Cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: сертификат кластера: %w", path, err)
+		}
+		if ca != nil {
+			if tlsConfig.RootCAs, err = certPool(ca); err != nil {
+				return nil, fmt.Errorf("kubeconfig %s: %w", path, err)
+			}
+		}
+	}
+	if !found || client.server == "" {
+		return nil, fmt.Errorf("kubeconfig %s: не найден адрес кластера %q", path, clusterName)
+	}
+
+	for _, u := range cfg.Users {
+		if u.Name != userName {
+			continue
+		}
+		if !u.User.Exec.IsZero() || !u.User.AuthProvider.IsZero() {
+			return nil, fmt.Errorf("kubeconfig %s: авторизация через exec и auth-provider не поддерживается", path)
+		}
+		switch {
+		case u.User.Token != "":
+			token := u.User.Token
+			client.token = func() (string, error) { return token, nil }
+		case u.User.TokenFile != "":
+			tokenPath := resolve(u.User.TokenFile)
+			client.token = func() (string, error) { return readToken(tokenPath) }
+		}
+		certPEM, err := fileOrData(resolve(u.User.ClientCertificate), u.User.ClientCertificateData)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: клиентский сертификат: %w", path, err)
+		}
+		keyPEM, err := fileOrData(resolve(u.User.ClientKey), u.User.ClientKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: ключ клиентского сертификата: %w", path, err)
+		}
+		if certPEM != nil || keyPEM != nil {
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				return nil, fmt.Errorf("kubeconfig %s: клиентский сертификат: %w", path, err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+
+	client.http = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	return client, nil
+}
+
+// get выполняет GET-запрос к API. Ответ с ошибкой возвращается как *kubeStatus
+func (c *kubeClient) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.server+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != nil {
+		token, err := c.token()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		status := &kubeStatus{Code: resp.StatusCode}
+		if json.Unmarshal(body, status) != nil || status.Message == "" {
+			status.Message = strings.TrimSpace(string(body))
+		}
+		status.Code = resp.StatusCode
+		return nil, status
+	}
+	return resp, nil
+}
+
+// readToken читает токен из файла
+func readToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// fileOrData возвращает содержимое файла или данные в base64;
+// nil, если не задано ни то, ни другое
+func fileOrData(path, data string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if path != "" {
+		return os.ReadFile(path)
+	}
+	return nil, nil
+}
+
+// certPool создает набор корневых сертификатов из PEM
+func certPool(pem []byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("не найдено ни одного сертификата PEM")
+	}
+	return pool, nil
+}
@@ -0,0 +1,348 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+// kubeListTimeout - таймаут запроса списка EndpointSlice
+const kubeListTimeout = 30 * time.Second
+
+// kubeServiceLabel - метка EndpointSlice с именем сервиса
+const kubeServiceLabel = "kubernetes.io/service-name"
+
+// errWatchExpired - версия ресурсов устарела (410 Gone), нужен новый список
+var errWatchExpired = errors.New("версия ресурсов устарела")
+
+// KubernetesConfig описывает обнаружение бэкендов по EndpointSlice сервиса
+type KubernetesConfig struct {
+	Namespace  string // Пространство имен; пусто - из kubeconfig или пода
+	Service    string // Имя сервиса
+	PortName   string // Имя порта EndpointSlice; пусто - первый порт
+	Scheme     string // http или https
+	Weight     int    // Вес бэкендов
+	Priority   int    // Уровень приоритета бэкендов
+	Kubeconfig string // Путь к kubeconfig; пусто - сервисный аккаунт пода
+	// Период полного перечитывания списка; между перечитываниями
+	// изменения приходят через watch
+	ResyncInterval time.Duration
+	// Пауза перед повторным подключением после ошибки
+	RetryInterval time.Duration
+}
+
+// endpointSlice - используемая часть discovery.k8s.io/v1 EndpointSlice
+type endpointSlice struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Endpoints []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			Ready       *bool `json:"ready"`
+			Serving     *bool `json:"serving"`
+			Terminating *bool `json:"terminating"`
+		} `json:"conditions"`
+		NodeName  string `json:"nodeName"`
+		Zone      string `json:"zone"`
+		TargetRef *struct {
+			Kind string `json:"kind"`
+			Name string `json:"name"`
+		} `json:"targetRef"`
+	} `json:"endpoints"`
+	Ports []struct {
+		Name *string `json:"name"`
+		Port *int32  `json:"port"`
+	} `json:"ports"`
+}
+
+// endpointSliceList - ответ на запрос списка EndpointSlice
+type endpointSliceList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []endpointSlice `json:"items"`
+}
+
+// kubeEvent - событие потока watch
+type kubeEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// Kubernetes находит бэкенды в EndpointSlice сервиса Kubernetes.
+// Список читается целиком при подключении и раз в ResyncInterval,
+// изменения между перечитываниями приходят через watch
+type Kubernetes struct {
+	cfg    KubernetesConfig
+	logger *logger.Logger
+}
+
+// NewKubernetes создает источник бэкендов по EndpointSlice
+func NewKubernetes(cfg KubernetesConfig, log *logger.Logger) *Kubernetes {
+	if cfg.Scheme == "" {
+		cfg.Scheme = "http"
+	}
+	if cfg.ResyncInterval <= 0 {
+		cfg.ResyncInterval = 5 * time.Minute
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = 5 * time.Second
+	}
+	return &Kubernetes{cfg: cfg, logger: log}
+}
+
+// Name возвращает имя источника
+func (k *Kubernetes) Name() string {
+	if k.cfg.Namespace == "" {
+		return "kubernetes " + k.cfg.Service
+	}
+	return "kubernetes " + k.cfg.Namespace + "/" + k.cfg.Service
+}
+
+// Run читает список EndpointSlice и отслеживает его изменения.
+// После ошибки подключение повторяется через RetryInterval
+func (k *Kubernetes) Run(ctx context.Context, update func([]Target)) {
+	for {
+		err := k.sync(ctx, update)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			continue
+		}
+		k.logger.Warn(fmt.Sprintf("Ошибка обнаружения бэкендов %s: %v", k.Name(), err))
+
+		timer := time.NewTimer(k.cfg.RetryInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// sync читает список EndpointSlice и применяет события watch до срока
+// следующего перечитывания. Возвращает nil, если нужно перечитать список
+func (k *Kubernetes) sync(ctx context.Context, update func([]Target)) error {
+	// Файлы kubeconfig и токен перечитываются при каждом подключении
+	client, err := newKubeClient(k.cfg.Kubeconfig)
+	if err != nil {
+		return err
+	}
+	// Следующая синхронизация создает новый клиент: соединения этого закрываются
+	defer client.http.CloseIdleConnections()
+	namespace := k.cfg.Namespace
+	if namespace == "" {
+		namespace = client.namespace
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+	path := "/apis/discovery.k8s.io/v1/namespaces/" + url.PathEscape(namespace) + "/endpointslices"
+	query := url.Values{"labelSelector": {kubeServiceLabel + "=" + k.cfg.Service}}
+
+	listCtx, cancel := context.WithTimeout(ctx, kubeListTimeout)
+	resp, err := client.get(listCtx, path, query)
+	if err != nil {
+		cancel()
+		return err
+	}
+	var list endpointSliceList
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	cancel()
+	if err != nil {
+		return fmt.Errorf("некорректный список EndpointSlice: %w", err)
+	}
+
+	slices := make(map[string]endpointSlice, len(list.Items))
+	for _, slice := range list.Items {
+		slices[slice.Metadata.Name] = slice
+	}
+	update(k.targets(slices))
+
+	version := list.Metadata.ResourceVersion
+	deadline := time.Now().Add(k.cfg.ResyncInterval)
+	for {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return nil
+		}
+		version, err = k.watch(ctx, client, path, query, version, timeout, slices, update)
+		if errors.Is(err, errWatchExpired) {
+			k.logger.Debug(fmt.Sprintf("Источник %s: %v, список перечитывается", k.Name(), err))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// watch применяет события EndpointSlice начиная с версии version
+// и возвращает версию последнего события
+func (k *Kubernetes) watch(ctx context.Context, client *kubeClient, path string, query url.Values,
+	version string, timeout time.Duration, slices map[string]endpointSlice, update func([]Target)) (string, error) {
+	watchQuery := url.Values{
+		"watch":               {"true"},
+		"resourceVersion":     {version},
+		"allowWatchBookmarks": {"true"},
+		"timeoutSeconds":      {strconv.Itoa(int(math.Ceil(timeout.Seconds())))},
+	}
+	for key, values := range query {
+		watchQuery[key] = values
+	}
+	resp, err := client.get(ctx, path, watchQuery)
+	if err != nil {
+		var status *kubeStatus
+		if errors.As(err, &status) && status.Code == http.StatusGone {
+			return version, errWatchExpired
+		}
+		return version, err
+	}
+	defer resp.Body.Close()
+
+	deadline := time.Now().Add(timeout)
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event kubeEvent
+		if err := decoder.Decode(&event); err != nil {
+			// Сервер закрывает поток по истечении timeoutSeconds
+			if errors.Is(err, io.EOF) && time.Until(deadline) < time.Second {
+				return version, nil
+			}
+			if errors.Is(err, io.EOF) {
+				return version, errors.New("поток watch закрыт сервером")
+			}
+			return version, fmt.Errorf("поток watch: %w", err)
+		}
+
+		if event.Type == "ERROR" {
+			var status kubeStatus
+			if err := json.Unmarshal(event.Object, &status); err != nil {
+				return version, fmt.Errorf("некорректное событие ERROR: %w", err)
+			}
+			if status.Code == http.StatusGone {
+				return version, errWatchExpired
+			}
+			return version, &status
+		}
+
+		var slice endpointSlice
+		if err := json.Unmarshal(event.Object, &slice); err != nil {
+			return version, fmt.Errorf("некорректное событие %s: %w", event.Type, err)
+		}
+		version = slice.Metadata.ResourceVersion
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			slices[slice.Metadata.Name] = slice
+		case "DELETED":
+			delete(slices, slice.Metadata.Name)
+		default:
+			// BOOKMARK только сдвигает версию
+			continue
+		}
+		update(k.targets(slices))
+	}
+}
+
+// targets строит бэкенды по адресам EndpointSlice. Адрес, который
+// встречается в нескольких EndpointSlice, берется в лучшем состоянии
+func (k *Kubernetes) targets(slices map[string]endpointSlice) []Target {
+	names := make([]string, 0, len(slices))
+	for name := range slices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	found := make(map[string]Target)
+	for _, name := range names {
+		slice := slices[name]
+		port, ok := slice.port(k.cfg.PortName)
+		if !ok {
+			if len(slice.Endpoints) > 0 {
+				k.logger.Warn(fmt.Sprintf("EndpointSlice %s пропущен: нет порта %q", name, k.cfg.PortName))
+			}
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			conditions := endpoint.Conditions
+			// Отсутствующие условия: ready и serving - истина, terminating - ложь
+			ready := conditions.Ready == nil || *conditions.Ready
+			serving := ready
+			if conditions.Serving != nil {
+				serving = *conditions.Serving
+			}
+			terminating := conditions.Terminating != nil && *conditions.Terminating
+
+			labels := make(map[string]string)
+			if endpoint.NodeName != "" {
+				labels["node"] = endpoint.NodeName
+			}
+			if endpoint.Zone != "" {
+				labels["zone"] = endpoint.Zone
+			}
+			if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" {
+				labels["pod"] = endpoint.TargetRef.Name
+			}
+			for _, addr := range endpoint.Addresses {
+				target := Target{
+					URL:         k.cfg.Scheme + "://" + net.JoinHostPort(addr, strconv.Itoa(port)),
+					Weight:      k.cfg.Weight,
+					Priority:    k.cfg.Priority,
+					Labels:      labels,
+					NotReady:    !ready || !serving,
+					Terminating: terminating,
+				}
+				if existing, ok := found[target.URL]; !ok || rank(target) < rank(existing) {
+					found[target.URL] = target
+				}
+			}
+		}
+	}
+
+	targets := make([]Target, 0, len(found))
+	for _, target := range found {
+		targets = append(targets, target)
+	}
+	return sortTargets(targets)
+}
+
+// port возвращает номер порта с именем name или первый порт, если имя не задано
+func (s endpointSlice) port(name string) (int, bool) {
+	for _, p := range s.Ports {
+		if p.Port == nil {
+			continue
+		}
+		if name == "" || (p.Name != nil && *p.Name == name) {
+			return int(*p.Port), true
+		}
+	}
+	return 0, false
+}
+
+// rank упорядочивает состояния бэкенда: готовый, не готовый, завершающий работу
+func rank(target Target) int {
+	switch {
+	case target.Terminating:
+		return 2
+	case target.NotReady:
+		return 1
+	default:
+		return 0
+	}
+}
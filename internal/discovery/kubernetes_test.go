@@ -0,0 +1,294 @@
+package discovery
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+// fakeKube - API-сервер Kubernetes для тестов, отдающий EndpointSlice
+// одного сервиса: список и поток watch
+type fakeKube struct {
+	server  *httptest.Server
+	mu      sync.Mutex
+	items   string      // JSON-массив EndpointSlice в ответе на список
+	lists   int         // Число запросов списка
+	path    string      // Путь последнего запроса
+	version []string    // resourceVersion запросов watch
+	open    int         // Открытых соединений с сервером
+	watches int         // Активных запросов watch
+	events  chan string // События watch; пустая строка завершает поток
+}
+
+// newFakeKube запускает API-сервер; запросы без токена token отклоняются
+func newFakeKube(t *testing.T, token string) *fakeKube {
+	t.Helper()
+	k := &fakeKube{items: "[]", events: make(chan string)}
+	k.server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"kind": "Status", "code": 401, "reason": "Unauthorized", "message": "Unauthorized"}`)
+			return
+		}
+		if r.URL.Query().Get("labelSelector") != "kubernetes.io/service-name=api" {
+			http.Error(w, "неверный селектор", http.StatusBadRequest)
+			return
+		}
+
+		k.mu.Lock()
+		k.path = r.URL.Path
+		if r.URL.Query().Get("watch") != "true" {
+			k.lists++
+			fmt.Fprintf(w, `{"kind": "EndpointSliceList", "metadata": {"resourceVersion": "%d"}, "items": %s}`, 100*k.lists, k.items)
+			k.mu.Unlock()
+			return
+		}
+		k.version = append(k.version, r.URL.Query().Get("resourceVersion"))
+		k.watches++
+		k.mu.Unlock()
+		defer func() {
+			k.mu.Lock()
+			k.watches--
+			k.mu.Unlock()
+		}()
+
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case event := <-k.events:
+				if event == "" {
+					return
+				}
+				fmt.Fprintln(w, event)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	k.server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		switch state {
+		case http.StateNew:
+			k.open++
+		case http.StateClosed, http.StateHijacked:
+			k.open--
+		}
+	}
+	k.server.StartTLS()
+	t.Cleanup(k.server.Close)
+	return k
+}
+
+// connections возвращает число открытых соединений с сервером
+// и активных запросов watch
+func (k *fakeKube) connections() (int, int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.open, k.watches
+}
+
+// set заменяет EndpointSlice в ответе на список
+func (k *fakeKube) set(items string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.items = items
+}
+
+// requests возвращает число запросов списка, путь последнего запроса
+// и версии запросов watch
+func (k *fakeKube) requests() (int, string, []string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.lists, k.path, append([]string(nil), k.version...)
+}
+
+// caPEM возвращает сертификат сервера в PEM
+func (k *fakeKube) caPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: k.server.Certificate().Raw})
+}
+
+// endpointSliceJSON описывает EndpointSlice сервиса api с портами http и metrics
+func endpointSliceJSON(name, version, endpoints string) string {
+	return fmt.Sprintf(`{
+		"metadata": {"name": %q, "resourceVersion": %q, "labels": {"kubernetes.io/service-name": "api"}},
+		"addressType": "IPv4",
+		"endpoints": [%s],
+		"ports": [{"name": "metrics", "port": 9090}, {"name": "http", "port": 8080, "protocol": "TCP"}]
+	}`, name, version, endpoints)
+}
+
+// runProvider запускает источник и возвращает канал его обновлений
+func runProvider(t *testing.T, p Provider) <-chan []Target {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := make(chan []Target, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Run(ctx, func(targets []Target) {
+			select {
+			case updates <- targets:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return updates
+}
+
+// receive ждет обновления источника
+func receive(t *testing.T, updates <-chan []Target) []Target {
+	t.Helper()
+	select {
+	case targets := <-updates:
+		return targets
+	case <-time.After(2 * time.Second):
+		t.Fatal("Не получено обновление источника")
+		return nil
+	}
+}
+
+func TestKubernetesEndpointSlices(t *testing.T) {
+	api := newFakeKube(t, "secret")
+	api.set("[" + endpointSliceJSON("api-a", "90", `
+		{"addresses": ["10.0.0.1"], "conditions": {"ready": true}, "nodeName": "node-1", "zone": "a", "targetRef": {"kind": "Pod", "name": "api-1"}},
+		{"addresses": ["10.0.0.2"], "conditions": {"ready": false, "serving": false}},
+		{"addresses": ["10.0.0.3"], "conditions": {"ready": false, "serving": true, "terminating": true}}
+	`) + "]")
+
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	writeTargets(t, kubeconfig, fmt.Sprintf(`
+apiVersion: v1
+kind: Config
+current-context: test
+contexts:
+- name: test
+  context: {cluster: test, user: test, namespace: shop}
+clusters:
+- name: test
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+users:
+- name: test
+  user: {token: secret}
+`, api.server.URL, base64.StdEncoding.EncodeToString(api.caPEM())), time.Now())
+
+	k := NewKubernetes(KubernetesConfig{
+		Service: "api", PortName: "http", Weight: 2, Kubeconfig: kubeconfig,
+		RetryInterval: 10 * time.Millisecond,
+	}, logger.New("error"))
+	updates := runProvider(t, k)
+
+	want := []Target{
+		{URL: "http://10.0.0.1:8080", Weight: 2, Labels: map[string]string{"node": "node-1", "zone": "a", "pod": "api-1"}},
+		{URL: "http://10.0.0.2:8080", Weight: 2, Labels: map[string]string{}, NotReady: true},
+		{URL: "http://10.0.0.3:8080", Weight: 2, Labels: map[string]string{}, NotReady: true, Terminating: true},
+	}
+	if targets := receive(t, updates); !reflect.DeepEqual(targets, want) {
+		t.Errorf("Получены бэкенды %+v, ожидались %+v", targets, want)
+	}
+	if _, path, _ := api.requests(); path != "/apis/discovery.k8s.io/v1/namespaces/shop/endpointslices" {
+		t.Errorf("Неверный путь запроса %s", path)
+	}
+
+	// Изменения приходят через watch с версии списка
+	api.events <- `{"type": "ADDED", "object": ` + endpointSliceJSON("api-b", "101", `{"addresses": ["10.0.0.4"]}`) + `}`
+	if targets := receive(t, updates); len(targets) != 4 || targets[3].URL != "http://10.0.0.4:8080" || targets[3].NotReady {
+		t.Errorf("Не применено событие ADDED: %+v", targets)
+	}
+	api.events <- `{"type": "DELETED", "object": ` + endpointSliceJSON("api-a", "102", "") + `}`
+	if targets := receive(t, updates); len(targets) != 1 || targets[0].URL != "http://10.0.0.4:8080" {
+		t.Errorf("Не применено событие DELETED: %+v", targets)
+	}
+
+	// Устаревшая версия: список перечитывается, watch продолжается с новой версии
+	api.set("[" + endpointSliceJSON("api-b", "190", `{"addresses": ["10.0.0.5"], "conditions": {"ready": true}}`) + "]")
+	api.events <- `{"type": "ERROR", "object": {"kind": "Status", "code": 410, "reason": "Expired", "message": "too old resource version"}}`
+	if targets := receive(t, updates); len(targets) != 1 || targets[0].URL != "http://10.0.0.5:8080" {
+		t.Errorf("После 410 список не перечитан: %+v", targets)
+	}
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		lists, _, versions := api.requests()
+		if lists == 2 && reflect.DeepEqual(versions, []string{"100", "200"}) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Ожидалось 2 запроса списка и watch с версий 100 и 200, получено %d, %v", lists, versions)
+		}
+	}
+
+	// Каждое переподключение создает новый клиент; соединения прежних
+	// клиентов не остаются открытыми
+	for i := 0; i <= 3; i++ {
+		// Событие получает только текущий watch: прежний мог еще не завершиться
+		for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+			open, watches := api.connections()
+			if watches == 1 && (i < 3 || open == 1) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Открыто соединений с API-сервером: %d, запросов watch: %d, ожидалось по 1", open, watches)
+			}
+		}
+		if i < 3 {
+			api.events <- ""
+			receive(t, updates)
+		}
+	}
+}
+
+func TestKubernetesInCluster(t *testing.T) {
+	api := newFakeKube(t, "pod-token")
+	api.set("[" + endpointSliceJSON("api-a", "1", `{"addresses": ["10.0.0.1"]}`) + "]")
+
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"token":     "pod-token\n",
+		"namespace": "payments",
+		"ca.crt":    string(api.caPEM()),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	previous := serviceAccountDir
+	serviceAccountDir = dir
+	t.Cleanup(func() { serviceAccountDir = previous })
+	host, port, _ := net.SplitHostPort(api.server.Listener.Addr().String())
+	t.Setenv("KUBERNETES_SERVICE_HOST", host)
+	t.Setenv("KUBERNETES_SERVICE_PORT", port)
+
+	// Порт без имени: берется первый порт EndpointSlice
+	updates := runProvider(t, NewKubernetes(KubernetesConfig{Service: "api"}, logger.New("error")))
+	if targets := receive(t, updates); len(targets) != 1 || targets[0].URL != "http://10.0.0.1:9090" {
+		t.Errorf("Получены бэкенды %+v", targets)
+	}
+	if _, path, _ := api.requests(); path != "/apis/discovery.k8s.io/v1/namespaces/payments/endpointslices" {
+		t.Errorf("Не использовано пространство имен пода: %s", path)
+	}
+
+	// Без окружения пода и kubeconfig клиент не создается
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	if _, err := newKubeClient(""); err == nil {
+		t.Error("Ожидалась ошибка вне пода без kubeconfig")
+	}
+}
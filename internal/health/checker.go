@@ -26,13 +26,13 @@ type Checker struct {
 // NewChecker создает новый экземпляр Checker
 func NewChecker(balancer balancer.Balancer, checkInterval, timeout time.Duration, logger *logger.Logger) *Checker {
 	httpClient := &http.Client{
-		Timeout: timeout * time.Second,
+		Timeout: timeout,
 	}
 
 	return &Checker{
 		balancer:      balancer,
-		CheckInterval: checkInterval * time.Second,
-		timeout:       timeout * time.Second,
+		CheckInterval: checkInterval,
+		timeout:       timeout,
 		logger:        logger,
 		stopCh:        make(chan struct{}),
 		httpClient:    httpClient,
@@ -78,7 +78,7 @@ func (c *Checker) checkAllBackends() {
 		wg.Add(1)
 		go func(b *Backend) {
 			defer wg.Done()
-			currentStatus := b.IsAlive
+			currentStatus := b.Alive()
 			newStatus := c.checkBackend(b)
 
 			// Если статус изменился, логируем
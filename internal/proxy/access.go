@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/acl"
+)
+
+// AccessRule ограничивает доступ к запросам маршрута списком адресов
+type AccessRule struct {
+	RouteMatcher
+	Name string
+	List *acl.List
+}
+
+// SetAccessList задает глобальный список доступа. При bypassRateLimit
+// явно разрешенные адреса не проверяются rate limiting
+func (lb *LoadBalancer) SetAccessList(list *acl.List, bypassRateLimit bool) {
+	lb.access = list
+	lb.accessBypass = bypassRateLimit
+}
+
+// AddAccessRule добавляет список доступа маршрута.
+// Вызывается до начала обработки запросов
+func (lb *LoadBalancer) AddAccessRule(rule *AccessRule) {
+	lb.accessRules = append(lb.accessRules, rule)
+}
+
+// checkAccess проверяет адрес клиента по глобальному списку и спискам
+// подходящих маршрутов. Запрет любого списка запрещает запрос; Allow
+// возвращается, только если адрес явно разрешен и нигде не запрещен.
+// Также возвращается имя списка, определившего результат
+func (lb *LoadBalancer) checkAccess(r *http.Request, clientIP string) (acl.Action, string) {
+	// Нераспознанный адрес не подходит ни под одно правило
+	addr, _ := netip.ParseAddr(clientIP)
+
+	result, source := acl.None, ""
+	check := func(list *acl.List) bool {
+		switch list.Check(addr) {
+		case acl.Deny:
+			result, source = acl.Deny, list.Name()
+			return false
+		case acl.Allow:
+			if result == acl.None {
+				result, source = acl.Allow, list.Name()
+			}
+		}
+		return true
+	}
+
+	if lb.access != nil && !check(lb.access) {
+		return result, source
+	}
+	for _, rule := range lb.accessRules {
+		if rule.Matches(r) && !check(rule.List) {
+			return result, source
+		}
+	}
+	return result, source
+}
+
+// logDenied пишет в лог запрет доступа в формате ключ=значение
+func (lb *LoadBalancer) logDenied(r *http.Request, clientIP, list string) {
+	lb.logger.Warn(fmt.Sprintf("Доступ запрещен: client=%s list=%s method=%s host=%s path=%q",
+		clientIP, list, r.Method, r.Host, r.URL.Path))
+}
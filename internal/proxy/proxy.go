@@ -3,10 +3,12 @@ package proxy
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/acl"
 	"github.com/Roman-Samoilenko/http-load-balancer/internal/balancer"
 	"github.com/Roman-Samoilenko/http-load-balancer/internal/ratelimit"
 	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
@@ -16,6 +18,13 @@ import (
 type LoadBalancer struct {
 	balancer     balancer.Balancer
 	rateManager  *ratelimit.Manager
+	rateFormat   string // Формат тела ответа 429: text или json
+	busyStatus   int    // Статус ответа при превышении лимита одновременных запросов
+	routes       []*RoutePolicy
+	access       *acl.List // Глобальный список доступа; nil - без ограничений
+	accessBypass bool      // Явно разрешенные адреса не проверяются rate limiting
+	accessRules  []*AccessRule
+	bans         *ratelimit.Banlist // Временные блокировки клиентов; nil - без блокировок
 	reverseProxy *httputil.ReverseProxy
 	logger       *logger.Logger
 	server       *http.Server
@@ -26,6 +35,8 @@ func NewLoadBalancer(bal balancer.Balancer, rm *ratelimit.Manager, log *logger.L
 	lb := &LoadBalancer{
 		balancer:    bal,
 		rateManager: rm,
+		rateFormat:  FormatText,
+		busyStatus:  http.StatusServiceUnavailable,
 		logger:      log,
 	}
 
@@ -46,17 +57,76 @@ func NewLoadBalancer(bal balancer.Balancer, rm *ratelimit.Manager, log *logger.L
 	return lb
 }
 
+// SetRateLimitFormat задает формат тела ответа 429: text или json
+func (lb *LoadBalancer) SetRateLimitFormat(format string) {
+	lb.rateFormat = format
+}
+
+// SetConcurrencyStatus задает статус ответа при превышении лимита
+// одновременных запросов клиента
+func (lb *LoadBalancer) SetConcurrencyStatus(status int) {
+	lb.busyStatus = status
+}
+
+// SetBans подключает временные блокировки клиентов
+func (lb *LoadBalancer) SetBans(bans *ratelimit.Banlist) {
+	lb.bans = bans
+}
+
 // ServeHTTP обрабатывает входящие HTTP-запросы
 func (lb *LoadBalancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Извлечение IP клиента для rate limiting
-	clientIP := r.RemoteAddr
+	clientIP := clientIP(r)
+
+	// Заблокированный клиент отклоняется до любых других проверок и без
+	// записи в лог: блокировка уже залогирована при ее установке
+	if lb.bans != nil {
+		if ban, banned := lb.bans.Banned(clientIP); banned {
+			writeBanned(w, ban, lb.rateFormat)
+			return
+		}
+	}
+
+	// Проверка доступа выполняется до rate limiting
+	bypass := false
+	if lb.access != nil || len(lb.accessRules) > 0 {
+		action, list := lb.checkAccess(r, clientIP)
+		if action == acl.Deny {
+			lb.logDenied(r, clientIP, list)
+			writeForbidden(w, lb.rateFormat)
+			return
+		}
+		bypass = action == acl.Allow && lb.accessBypass
+	}
 
 	// Проверка rate limit, если включен
-	if lb.rateManager != nil {
-		if !lb.rateManager.Allow(clientIP) {
-			lb.logger.Warn("Rate limit превышен для", clientIP)
-			w.WriteHeader(http.StatusTooManyRequests)
-			_, _ = w.Write([]byte("Слишком много запросов. Пожалуйста, попробуйте позже."))
+	if !bypass && (lb.rateManager != nil || len(lb.routes) > 0) {
+		decision, policy := lb.checkRateLimits(r, clientIP)
+		setRateLimitHeaders(w.Header(), decision)
+		if !decision.Allowed {
+			lb.logger.Warn(fmt.Sprintf("Rate limit превышен для %s, политика %s", clientIP, policy))
+			writeRateLimited(w, decision, lb.rateFormat)
+			return
+		}
+	}
+
+	if !bypass && lb.rateManager != nil {
+		// Слот освобождается через defer: и после ответа, и при отмене
+		// запроса клиентом, и при панике в обработчике
+		release, ok := lb.rateManager.Acquire(r.Context(), clientIP)
+		if !ok {
+			lb.logger.Warn("Превышен лимит одновременных запросов для ", clientIP)
+			writeConcurrencyLimited(w, lb.busyStatus, lb.rateFormat)
+			return
+		}
+		defer release()
+
+		// Квота расходуется только запросами, прошедшими краткосрочные лимиты
+		quota := lb.rateManager.TakeQuota(clientIP)
+		setQuotaHeaders(w.Header(), quota)
+		if !quota.Allowed {
+			lb.logger.Warn(fmt.Sprintf("Квота %s исчерпана для %s", quota.Name, clientIP))
+			writeQuotaExceeded(w, quota, lb.rateFormat)
 			return
 		}
 	}
@@ -94,11 +164,21 @@ func (lb *LoadBalancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	proxyReq.Header.Set("X-Forwarded-Host", r.Host)
 	proxyReq.Header.Set("X-Forwarded-Proto", r.URL.Scheme)
 
+	// Уменьшаем счетчик активных соединений и при панике в обработчике
+	defer backend.DecrementConnections()
+
 	// Проксирование запроса
 	lb.reverseProxy.ServeHTTP(w, proxyReq)
+}
 
-	// Уменьшаем счетчик активных соединений
-	backend.DecrementConnections()
+// clientIP возвращает IP-адрес клиента без порта, чтобы все соединения
+// одного клиента учитывались в одном бакете
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
 // Start запускает HTTP-сервер
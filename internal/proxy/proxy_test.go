@@ -0,0 +1,265 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/acl"
+	. "github.com/Roman-Samoilenko/http-load-balancer/internal/backend"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/balancer"
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/ratelimit"
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+// panicBalancer падает при выборе бэкенда, имитируя панику в обработчике
+type panicBalancer struct {
+	balancer.BaseBalancer
+}
+
+func (p *panicBalancer) NextBackend() *Backend {
+	panic("сбой балансировщика")
+}
+
+func newConcurrencyManager(t *testing.T) *ratelimit.Manager {
+	t.Helper()
+
+	manager, err := ratelimit.NewManager(ratelimit.Policy{Capacity: 100, Rate: 100})
+	if err != nil {
+		t.Fatalf("Не удалось создать менеджер: %v", err)
+	}
+	manager.SetMaxInFlight(1, 0)
+	t.Cleanup(func() { _ = manager.Close() })
+	return manager
+}
+
+func TestConcurrencySlotReleasedOnCancellation(t *testing.T) {
+	started := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	}))
+	defer upstream.Close()
+
+	manager := newConcurrencyManager(t)
+	bal := balancer.NewRoundRobin([]*Backend{{URL: upstream.URL, IsAlive: true}})
+	lb := NewLoadBalancer(bal, manager, logger.New("error"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest(http.MethodGet, "/stream", nil).WithContext(ctx)
+		req.RemoteAddr = "10.0.0.1:5000"
+		lb.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	<-started
+
+	// Второй запрос того же клиента отклоняется, пока первый в работе
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:5001"
+	rec := httptest.NewRecorder()
+	lb.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Ожидался статус 503, получен %d", rec.Code)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Обработчик не завершился после отмены запроса")
+	}
+	if got := manager.InFlight("10.0.0.1"); got != 0 {
+		t.Errorf("Слот не освобожден после отмены запроса: %d в работе", got)
+	}
+}
+
+func TestConcurrencySlotReleasedOnPanic(t *testing.T) {
+	manager := newConcurrencyManager(t)
+	lb := NewLoadBalancer(&panicBalancer{}, manager, logger.New("error"))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:5000"
+	func() {
+		defer func() { _ = recover() }()
+		lb.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+
+	if got := manager.InFlight("10.0.0.1"); got != 0 {
+		t.Errorf("Слот не освобожден после паники: %d в работе", got)
+	}
+}
+
+func TestRoutePolicies(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	global, _ := ratelimit.NewManager(ratelimit.Policy{Capacity: 20, Rate: 0.001})
+	login, _ := ratelimit.NewManager(ratelimit.Policy{Capacity: 2, Rate: 0.001})
+	defer global.Close()
+	defer login.Close()
+
+	bal := balancer.NewRoundRobin([]*Backend{{URL: upstream.URL, IsAlive: true}})
+	lb := NewLoadBalancer(bal, global, logger.New("error"))
+	lb.AddRoutePolicy(&RoutePolicy{
+		RouteMatcher: RouteMatcher{Path: "/login", Methods: []string{"POST"}},
+		Name:         "login",
+		Cost:         1,
+		Limiter:      login,
+	})
+	lb.AddRoutePolicy(&RoutePolicy{RouteMatcher: RouteMatcher{Path: "/export"}, Name: "export", Cost: 10})
+
+	do := func(method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "10.0.0.1:5000"
+		rec := httptest.NewRecorder()
+		lb.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Строгий лимит маршрута действует только на POST /login
+	for i := 0; i < 2; i++ {
+		if code := do(http.MethodPost, "/login"); code != http.StatusOK {
+			t.Fatalf("Запрос %d к /login отклонен: %d", i, code)
+		}
+	}
+	if code := do(http.MethodPost, "/login/"); code != http.StatusTooManyRequests {
+		t.Errorf("Третий запрос к /login должен быть отклонен, получен %d", code)
+	}
+	if code := do(http.MethodGet, "/login"); code != http.StatusOK {
+		t.Errorf("GET /login не должен попадать под политику POST, получен %d", code)
+	}
+	if code := do(http.MethodPost, "/loginx"); code != http.StatusOK {
+		t.Errorf("/loginx не должен попадать под политику /login, получен %d", code)
+	}
+
+	// Общий бакет проверяется первым и списывается и с отклоненного
+	// маршрутом запроса: 20 - 3 - 2 = 15 токенов; экспорт стоит 10
+	if code := do(http.MethodGet, "/export"); code != http.StatusOK {
+		t.Fatalf("Первый экспорт должен быть пропущен, получен %d", code)
+	}
+	if code := do(http.MethodGet, "/export"); code != http.StatusTooManyRequests {
+		t.Errorf("Второй экспорт должен быть отклонен, получен %d", code)
+	}
+	if remaining := global.TakeN("10.0.0.1", 0).Remaining; remaining != 5 {
+		t.Errorf("В общем бакете ожидалось 5 токенов, осталось %d", remaining)
+	}
+}
+
+func TestRoutePolicyKeepsTokensOnGlobalDeny(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	global, _ := ratelimit.NewManager(ratelimit.Policy{Capacity: 1, Rate: 0.001})
+	login, _ := ratelimit.NewManager(ratelimit.Policy{Capacity: 5, Rate: 0.001})
+	defer global.Close()
+	defer login.Close()
+
+	bal := balancer.NewRoundRobin([]*Backend{{URL: upstream.URL, IsAlive: true}})
+	lb := NewLoadBalancer(bal, global, logger.New("error"))
+	lb.AddRoutePolicy(&RoutePolicy{RouteMatcher: RouteMatcher{Path: "/login"}, Name: "login", Cost: 1, Limiter: login})
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = "10.0.0.1:5000"
+		rec := httptest.NewRecorder()
+		lb.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Fatalf("Запрос %d: ожидался статус %d, получен %d", i, want, rec.Code)
+		}
+	}
+	// Отклоненные общим лимитом запросы не расходуют лимит маршрута
+	if remaining := login.TakeN("10.0.0.1", 0).Remaining; remaining != 4 {
+		t.Errorf("В бакете маршрута ожидалось 4 токена, осталось %d", remaining)
+	}
+}
+
+func TestQuotaExceededResponse(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	manager, _ := ratelimit.NewManager(ratelimit.Policy{Capacity: 100, Rate: 100})
+	defer manager.Close()
+	quota, _ := ratelimit.NewQuota(ratelimit.QuotaPolicy{Name: "daily", Period: ratelimit.QuotaDaily, Limit: 1})
+	manager.AddQuota(quota)
+
+	bal := balancer.NewRoundRobin([]*Backend{{URL: upstream.URL, IsAlive: true}})
+	lb := NewLoadBalancer(bal, manager, logger.New("error"))
+	lb.SetRateLimitFormat(FormatJSON)
+
+	do := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:5000"
+		rec := httptest.NewRecorder()
+		lb.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(); rec.Code != http.StatusOK || rec.Header().Get("X-Quota-Remaining") != "0" {
+		t.Fatalf("Первый запрос: статус %d, остаток квоты %q", rec.Code, rec.Header().Get("X-Quota-Remaining"))
+	}
+
+	rec := do()
+	var body rateLimitBody
+	_ = json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusTooManyRequests || body.Error != "quota_exceeded" {
+		t.Errorf("Ожидался 429 с кодом quota_exceeded, получено %d %q", rec.Code, body.Error)
+	}
+	if rec.Header().Get("X-Quota-Policy") != "daily" || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Ответ не содержит состояние квоты: %v", rec.Header())
+	}
+}
+
+func TestAccessLists(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	manager, _ := ratelimit.NewManager(ratelimit.Policy{Capacity: 1, Rate: 0.001})
+	defer manager.Close()
+
+	global, err := acl.NewList("global", acl.Rules{
+		Allow: []string{"10.0.0.1", "2001:db8::/32"},
+		Deny:  []string{"10.0.0.0/8"},
+	}, logger.New("error"))
+	if err != nil {
+		t.Fatalf("Ошибка создания списка: %v", err)
+	}
+	admin, _ := acl.NewList("admin", acl.Rules{Allow: []string{"10.0.0.1"}, DefaultDeny: true}, logger.New("error"))
+
+	bal := balancer.NewRoundRobin([]*Backend{{URL: upstream.URL, IsAlive: true}})
+	lb := NewLoadBalancer(bal, manager, logger.New("error"))
+	lb.SetAccessList(global, true)
+	lb.AddAccessRule(&AccessRule{RouteMatcher: RouteMatcher{Path: "/admin"}, Name: "admin", List: admin})
+
+	do := func(remoteAddr, path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		lb.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do("10.9.9.9:5000", "/"); code != http.StatusForbidden {
+		t.Errorf("Адрес из запрещенной подсети: ожидался 403, получен %d", code)
+	}
+	// Явно разрешенный адрес не ограничивается rate limiting
+	for i := 0; i < 3; i++ {
+		if code := do("10.0.0.1:5000", "/admin"); code != http.StatusOK {
+			t.Fatalf("Разрешенный адрес, запрос %d: ожидался 200, получен %d", i, code)
+		}
+	}
+	// Остальные адреса проходят rate limiting, но маршрут /admin им закрыт
+	if code := do("[2001:db8::5]:5000", "/admin"); code != http.StatusForbidden {
+		t.Errorf("Маршрут /admin: ожидался 403, получен %d", code)
+	}
+	if code := do("192.0.2.1:5000", "/"); code != http.StatusOK {
+		t.Errorf("Первый запрос без правил: ожидался 200, получен %d", code)
+	}
+	if code := do("192.0.2.1:5000", "/"); code != http.StatusTooManyRequests {
+		t.Errorf("Второй запрос без правил: ожидался 429, получен %d", code)
+	}
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/ratelimit"
+)
+
+// Форматы тела ответа при превышении лимита
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// rateLimitBody тело ответа об отказе в формате JSON
+type rateLimitBody struct {
+	Error      string `json:"error"`
+	Message    string `json:"message"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+// setRateLimitHeaders добавляет заголовки RateLimit-* (draft-ietf-httpapi-ratelimit-headers)
+func setRateLimitHeaders(h http.Header, d ratelimit.Decision) {
+	h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+	if d.Window > 0 {
+		h.Set("RateLimit-Policy", strconv.Itoa(d.Limit)+";w="+strconv.Itoa(ceilSeconds(d.Window)))
+	}
+}
+
+// setQuotaHeaders добавляет заголовки X-Quota-* с состоянием самой
+// исчерпанной календарной квоты клиента
+func setQuotaHeaders(h http.Header, d ratelimit.QuotaDecision) {
+	if d.Name == "" {
+		return
+	}
+	h.Set("X-Quota-Limit", strconv.FormatInt(d.Limit, 10))
+	h.Set("X-Quota-Remaining", strconv.FormatInt(d.Remaining, 10))
+	h.Set("X-Quota-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+	h.Set("X-Quota-Policy", d.Name)
+}
+
+// writeRateLimited отвечает 429 с заголовком Retry-After и телом в заданном формате
+func writeRateLimited(w http.ResponseWriter, d ratelimit.Decision, format string) {
+	writeLimited(w, http.StatusTooManyRequests, "rate_limited",
+		"Слишком много запросов. Пожалуйста, попробуйте позже.",
+		max(1, ceilSeconds(d.RetryAfter)), format)
+}
+
+// writeQuotaExceeded отвечает 429, когда исчерпана календарная квота;
+// повторить запрос можно после сброса счетчика
+func writeQuotaExceeded(w http.ResponseWriter, d ratelimit.QuotaDecision, format string) {
+	writeLimited(w, http.StatusTooManyRequests, "quota_exceeded",
+		"Квота запросов "+d.Name+" исчерпана.",
+		max(1, ceilSeconds(d.Reset)), format)
+}
+
+// writeBanned отвечает 429 временно заблокированному клиенту;
+// повторить запрос можно после окончания блокировки
+func writeBanned(w http.ResponseWriter, ban ratelimit.Ban, format string) {
+	writeLimited(w, http.StatusTooManyRequests, "banned",
+		"Клиент временно заблокирован за превышение лимитов.",
+		max(1, ceilSeconds(time.Until(ban.Until))), format)
+}
+
+// writeConcurrencyLimited отвечает заданным статусом, когда у клиента
+// слишком много одновременных запросов
+func writeConcurrencyLimited(w http.ResponseWriter, status int, format string) {
+	writeLimited(w, status, "concurrency_limited",
+		"Слишком много одновременных запросов. Пожалуйста, попробуйте позже.",
+		1, format)
+}
+
+// writeForbidden отвечает 403 адресу, запрещенному списком доступа
+func writeForbidden(w http.ResponseWriter, format string) {
+	message := "Доступ запрещен."
+	if format == FormatJSON {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(rateLimitBody{Error: "forbidden", Message: message})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	_, _ = w.Write([]byte(message))
+}
+
+// writeLimited отвечает отказом с заголовком Retry-After и телом
+// в заданном формате; code различает причины отказа в формате json
+func writeLimited(w http.ResponseWriter, status int, code, message string, retryAfter int, format string) {
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	if format == FormatJSON {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(rateLimitBody{
+			Error:      code,
+			Message:    message,
+			RetryAfter: retryAfter,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(message))
+}
+
+// ceilSeconds округляет длительность вверх до целых секунд
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
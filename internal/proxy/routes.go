@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/internal/ratelimit"
+)
+
+// DefaultPolicy - имя общей политики клиента в логах и admin API
+const DefaultPolicy = "default"
+
+// RouteMatcher описывает запросы, к которым применяется правило маршрута
+type RouteMatcher struct {
+	Path    string   // Префикс пути с точностью до сегмента; пусто - любой путь
+	Methods []string // Методы запроса; пусто - любой метод
+	Host    string   // Хост без порта; пусто - любой хост
+}
+
+// Matches сообщает, подходит ли запрос под матчер
+func (m RouteMatcher) Matches(r *http.Request) bool {
+	if m.Host != "" && !strings.EqualFold(requestHost(r), m.Host) {
+		return false
+	}
+	if len(m.Methods) > 0 && !containsFold(m.Methods, r.Method) {
+		return false
+	}
+	return matchPath(m.Path, r.URL.Path)
+}
+
+// RoutePolicy применяет отдельный лимит к запросам, подходящим под матчер.
+// У каждой политики свое пространство бакетов: лимит клиента на маршруте
+// не зависит от его общего лимита и от других маршрутов
+type RoutePolicy struct {
+	RouteMatcher
+	Name    string
+	Cost    int                // Стоимость запроса в токенах
+	Limiter *ratelimit.Manager // Бакеты политики; nil - стоимость списывается из общего бакета
+}
+
+// AddRoutePolicy добавляет политику маршрута. Вызывается до начала
+// обработки запросов; политики проверяются в порядке добавления
+func (lb *LoadBalancer) AddRoutePolicy(rp *RoutePolicy) {
+	lb.routes = append(lb.routes, rp)
+}
+
+// checkRateLimits проверяет запрос по общему лимиту клиента и по всем
+// подходящим политикам маршрутов. Запрос пропускается, только если его
+// пропустили все политики; проверка останавливается на первом отказе.
+// Возвращает решение с наименьшим запасом и имя отказавшей политики
+func (lb *LoadBalancer) checkRateLimits(r *http.Request, clientIP string) (ratelimit.Decision, string) {
+	var result ratelimit.Decision
+	checked := false
+	cost := 1
+
+	var matched []*RoutePolicy
+	for _, rp := range lb.routes {
+		if !rp.Matches(r) {
+			continue
+		}
+		if rp.Limiter == nil {
+			cost = max(cost, rp.Cost)
+			continue
+		}
+		matched = append(matched, rp)
+	}
+
+	// Сначала общий лимит: токены маршрутов списываются только с запросов,
+	// которые он пропустил, поэтому отклоненный запрос не расходует
+	// более строгий лимит маршрута
+	if lb.rateManager != nil {
+		decision := lb.rateManager.TakeN(clientIP, cost)
+		if !decision.Allowed {
+			return decision, DefaultPolicy
+		}
+		lb.logShadowed(decision, clientIP, DefaultPolicy)
+		result = decision
+		checked = true
+	}
+
+	for _, rp := range matched {
+		decision := rp.Limiter.TakeN(clientIP, rp.Cost)
+		if !decision.Allowed {
+			return decision, rp.Name
+		}
+		lb.logShadowed(decision, clientIP, rp.Name)
+		if !checked || decision.Remaining < result.Remaining {
+			result = decision
+		}
+		checked = true
+	}
+
+	if !checked {
+		result.Allowed = true
+	}
+	return result, ""
+}
+
+// logShadowed логирует запрос, пропущенный политикой в теневом режиме
+func (lb *LoadBalancer) logShadowed(decision ratelimit.Decision, clientIP, policy string) {
+	if decision.Shadowed {
+		lb.logger.Warn(fmt.Sprintf("Теневой режим: rate limit был бы превышен для %s, политика %s", clientIP, policy))
+	}
+}
+
+// matchPath сравнивает путь с префиксом по сегментам:
+// "/api" подходит для "/api" и "/api/users", но не для "/apix"
+func matchPath(prefix, path string) bool {
+	if prefix == "" || prefix == "/" {
+		return true
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || path[len(prefix)] == '/'
+}
+
+// requestHost возвращает хост запроса без порта
+func requestHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		return r.Host
+	}
+	return host
+}
+
+// containsFold ищет строку в списке без учета регистра
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
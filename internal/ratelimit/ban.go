@@ -0,0 +1,291 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+// BanPolicy описывает временную блокировку клиентов, которые продолжают
+// отправлять запросы после отказов: больше MaxRejections отказов за Window
+// блокируют клиента на Duration. Каждая следующая блокировка вдвое длиннее
+// предыдущей, но не длиннее MaxDuration. Уровень эскалации сбрасывается,
+// если клиент не блокировался ForgetAfter после окончания последней блокировки
+type BanPolicy struct {
+	MaxRejections int
+	Window        time.Duration
+	Duration      time.Duration
+	MaxDuration   time.Duration
+	ForgetAfter   time.Duration
+}
+
+// Validate проверяет корректность параметров блокировки
+func (p BanPolicy) Validate() error {
+	if p.MaxRejections <= 0 {
+		return fmt.Errorf("число отказов до блокировки должно быть положительным, получено %d", p.MaxRejections)
+	}
+	if p.Window <= 0 || p.Duration <= 0 {
+		return fmt.Errorf("окно и длительность блокировки должны быть положительными")
+	}
+	if p.MaxDuration < p.Duration {
+		return fmt.Errorf("максимальная длительность блокировки меньше начальной")
+	}
+	return nil
+}
+
+// duration возвращает длительность блокировки уровня level (с 1)
+func (p BanPolicy) duration(level int) time.Duration {
+	d := p.Duration
+	for i := 1; i < level && d < p.MaxDuration; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxDuration)
+}
+
+// Ban - блокировка клиента. После окончания запись хранится еще
+// ForgetAfter, чтобы следующая блокировка была длиннее
+type Ban struct {
+	ID        string    `json:"id"`
+	Level     int       `json:"level"` // Номер блокировки подряд
+	CreatedAt time.Time `json:"created_at"`
+	Until     time.Time `json:"until"`
+}
+
+// strikes хранит моменты последних отказов клиента в кольцевом буфере
+type strikes struct {
+	times []int64 // UnixNano
+	next  int
+	count int
+}
+
+// Banlist считает отказы клиентов и блокирует нарушителей.
+// Проверка блокировки не захватывает мьютекс, пока нет ни одной записи
+type Banlist struct {
+	policy  BanPolicy
+	clock   func() time.Time
+	bans    map[string]*Ban
+	records atomic.Int64 // Число записей в bans
+	banMu   sync.RWMutex
+	strikes map[string]*strikes
+	mu      sync.Mutex // Защищает strikes
+	store   Store
+	logger  *logger.Logger
+	stopCh  chan struct{}
+	stop    sync.Once
+	wg      sync.WaitGroup
+}
+
+// NewBanlist создает список блокировок по политике
+func NewBanlist(policy BanPolicy, log *logger.Logger) (*Banlist, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &Banlist{
+		policy:  policy,
+		clock:   time.Now,
+		bans:    make(map[string]*Ban),
+		strikes: make(map[string]*strikes),
+		logger:  log,
+		stopCh:  make(chan struct{}),
+	}, nil
+}
+
+// AttachStore загружает сохраненные блокировки; новые блокировки
+// и снятия сохраняются в хранилище сразу
+func (b *Banlist) AttachStore(store Store) error {
+	bans, err := store.Bans()
+	if err != nil {
+		return err
+	}
+
+	b.banMu.Lock()
+	defer b.banMu.Unlock()
+
+	for i := range bans {
+		b.bans[bans[i].ID] = &bans[i]
+	}
+	b.records.Store(int64(len(b.bans)))
+	b.store = store
+	return nil
+}
+
+// Banned сообщает, заблокирован ли клиент, и возвращает блокировку
+func (b *Banlist) Banned(id string) (Ban, bool) {
+	if b.records.Load() == 0 {
+		return Ban{}, false
+	}
+
+	b.banMu.RLock()
+	ban, exists := b.bans[id]
+	b.banMu.RUnlock()
+
+	if !exists || !b.clock().Before(ban.Until) {
+		return Ban{}, false
+	}
+	return *ban, true
+}
+
+// Reject учитывает отказ клиенту и блокирует его, если отказов за окно
+// стало больше допустимого
+func (b *Banlist) Reject(id string) {
+	now := b.clock()
+	ts := now.UnixNano()
+
+	b.mu.Lock()
+	s, exists := b.strikes[id]
+	if !exists {
+		s = &strikes{times: make([]int64, b.policy.MaxRejections)}
+		b.strikes[id] = s
+	}
+	// Самый старый из последних MaxRejections отказов еще в окне:
+	// вместе с текущим отказов больше допустимого
+	exceeded := s.count == len(s.times) && ts-s.times[s.next] < int64(b.policy.Window)
+	s.times[s.next] = ts
+	s.next = (s.next + 1) % len(s.times)
+	s.count = min(s.count+1, len(s.times))
+	if exceeded {
+		delete(b.strikes, id)
+	}
+	b.mu.Unlock()
+
+	if exceeded {
+		b.ban(id, now)
+	}
+}
+
+// ban блокирует клиента на срок, зависящий от числа предыдущих блокировок
+func (b *Banlist) ban(id string, now time.Time) {
+	b.banMu.Lock()
+	prev, exists := b.bans[id]
+	if exists && now.Before(prev.Until) {
+		// Уже заблокирован: отказы, посчитанные до блокировки, не продлевают ее
+		b.banMu.Unlock()
+		return
+	}
+
+	level := 1
+	if exists && now.Sub(prev.Until) < b.policy.ForgetAfter {
+		level = prev.Level + 1
+	}
+	ban := &Ban{ID: id, Level: level, CreatedAt: now, Until: now.Add(b.policy.duration(level))}
+	b.bans[id] = ban
+	b.records.Store(int64(len(b.bans)))
+	b.banMu.Unlock()
+
+	b.logger.Warn(fmt.Sprintf("Клиент %s заблокирован до %s (блокировка №%d): больше %d отказов за %v",
+		id, ban.Until.Format(time.RFC3339), level, b.policy.MaxRejections, b.policy.Window))
+
+	if b.store != nil {
+		if err := b.store.SaveBan(*ban); err != nil {
+			b.logger.Error("Ошибка сохранения блокировки клиента ", id, ": ", err)
+		}
+	}
+}
+
+// List возвращает действующие блокировки, начиная с самых поздних
+func (b *Banlist) List() []Ban {
+	now := b.clock()
+
+	b.banMu.RLock()
+	bans := make([]Ban, 0, len(b.bans))
+	for _, ban := range b.bans {
+		if now.Before(ban.Until) {
+			bans = append(bans, *ban)
+		}
+	}
+	b.banMu.RUnlock()
+
+	sort.Slice(bans, func(i, j int) bool { return bans[i].CreatedAt.After(bans[j].CreatedAt) })
+	return bans
+}
+
+// Unban снимает блокировку клиента и забывает его историю отказов.
+// Возвращает false, если клиент не был заблокирован
+func (b *Banlist) Unban(id string) (bool, error) {
+	b.banMu.Lock()
+	_, exists := b.bans[id]
+	delete(b.bans, id)
+	b.records.Store(int64(len(b.bans)))
+	b.banMu.Unlock()
+
+	b.mu.Lock()
+	delete(b.strikes, id)
+	b.mu.Unlock()
+
+	if !exists || b.store == nil {
+		return exists, nil
+	}
+	return true, b.store.DeleteBan(id)
+}
+
+// Start запускает периодическую очистку устаревших отказов и блокировок
+func (b *Banlist) Start() {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+
+		ticker := time.NewTicker(b.policy.Window)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				b.expire(b.clock())
+			case <-b.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// Close останавливает очистку
+func (b *Banlist) Close() {
+	b.stop.Do(func() { close(b.stopCh) })
+	b.wg.Wait()
+}
+
+// expire удаляет отказы, вышедшие из окна, и блокировки,
+// история которых уже не влияет на эскалацию
+func (b *Banlist) expire(now time.Time) {
+	oldest := now.Add(-b.policy.Window).UnixNano()
+
+	b.mu.Lock()
+	for id, s := range b.strikes {
+		latest := s.times[(s.next+len(s.times)-1)%len(s.times)]
+		if latest < oldest {
+			delete(b.strikes, id)
+		}
+	}
+	b.mu.Unlock()
+
+	var forgotten []string
+	b.banMu.Lock()
+	for id, ban := range b.bans {
+		if now.Sub(ban.Until) >= b.policy.ForgetAfter {
+			delete(b.bans, id)
+			forgotten = append(forgotten, id)
+		}
+	}
+	b.records.Store(int64(len(b.bans)))
+	b.banMu.Unlock()
+
+	if b.store == nil {
+		return
+	}
+	for _, id := range forgotten {
+		if err := b.store.DeleteBan(id); err != nil {
+			b.logger.Error("Ошибка удаления блокировки клиента ", id, ": ", err)
+		}
+	}
+}
+
+// SetBans подключает список блокировок: отказы менеджера учитываются
+// в нем. Один список может быть общим для нескольких менеджеров.
+// Вызывается до начала обработки запросов
+func (m *Manager) SetBans(b *Banlist) {
+	m.bans = b
+}
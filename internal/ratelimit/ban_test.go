@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+func newTestBanlist(t *testing.T, clock *fakeClock) *Banlist {
+	t.Helper()
+	bans, err := NewBanlist(BanPolicy{
+		MaxRejections: 3,
+		Window:        10 * time.Second,
+		Duration:      time.Minute,
+		MaxDuration:   3 * time.Minute,
+		ForgetAfter:   time.Hour,
+	}, logger.New("error"))
+	if err != nil {
+		t.Fatalf("Не удалось создать список блокировок: %v", err)
+	}
+	bans.clock = clock.Now
+	return bans
+}
+
+func TestBanEscalation(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_000_000, 0)}
+	bans := newTestBanlist(t, clock)
+
+	// Отказы, растянутые дольше окна, не приводят к блокировке
+	for i := 0; i < 6; i++ {
+		bans.Reject("10.0.0.1")
+		clock.Advance(4 * time.Second)
+	}
+	if _, banned := bans.Banned("10.0.0.1"); banned {
+		t.Fatalf("Клиент заблокирован за редкие отказы")
+	}
+
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		for i := 0; i < 4; i++ {
+			bans.Reject("10.0.0.1")
+		}
+		ban, banned := bans.Banned("10.0.0.1")
+		if !banned || ban.Until.Sub(clock.Now()) != want {
+			t.Fatalf("Ожидалась блокировка на %v, получено %+v (%v)", want, ban, banned)
+		}
+
+		// Отказы во время блокировки ее не продлевают
+		bans.Reject("10.0.0.1")
+		clock.Advance(want)
+		if _, banned := bans.Banned("10.0.0.1"); banned {
+			t.Fatalf("Блокировка не закончилась через %v", want)
+		}
+	}
+
+	// После долгого перерыва эскалация начинается заново
+	clock.Advance(time.Hour)
+	bans.expire(clock.Now())
+	for i := 0; i < 4; i++ {
+		bans.Reject("10.0.0.1")
+	}
+	if ban, _ := bans.Banned("10.0.0.1"); ban.Level != 1 {
+		t.Errorf("Ожидался первый уровень блокировки, получено %+v", ban)
+	}
+
+	if ok, _ := bans.Unban("10.0.0.1"); !ok {
+		t.Errorf("Снятие блокировки должно найти клиента")
+	}
+	if _, banned := bans.Banned("10.0.0.1"); banned || len(bans.List()) != 0 {
+		t.Errorf("Блокировка не снята")
+	}
+}
+
+func TestManagerRejectionsBanClient(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_000_000, 0)}
+	manager := newTestManager(t, 1, 0.001)
+	manager.clock = clock.Now
+	defer manager.Close()
+
+	bans := newTestBanlist(t, clock)
+	manager.SetBans(bans)
+
+	// Первый запрос пропущен, следующие четыре - отказы
+	for i := 0; i < 5; i++ {
+		manager.Take("10.0.0.1")
+	}
+	if _, banned := bans.Banned("10.0.0.1"); !banned {
+		t.Errorf("Клиент, продолжающий запросы после отказов, должен быть заблокирован")
+	}
+
+	// Отказы в теневом режиме не блокируют
+	manager.SetShadow(true)
+	for i := 0; i < 5; i++ {
+		manager.Take("10.0.0.2")
+	}
+	if _, banned := bans.Banned("10.0.0.2"); banned {
+		t.Errorf("Теневой режим не должен приводить к блокировке")
+	}
+}
+
+func TestBansSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clients.db")
+	clock := &fakeClock{now: time.Unix(1_000_000, 0)}
+
+	store := openTestStore(t, path)
+	bans := newTestBanlist(t, clock)
+	if err := bans.AttachStore(store); err != nil {
+		t.Fatalf("Ошибка подключения хранилища: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		bans.Reject("10.0.0.1")
+		bans.Reject("10.0.0.2")
+	}
+	if _, err := bans.Unban("10.0.0.2"); err != nil {
+		t.Fatalf("Ошибка снятия блокировки: %v", err)
+	}
+	_ = store.Close()
+
+	store = openTestStore(t, path)
+	defer store.Close()
+	bans = newTestBanlist(t, clock)
+	if err := bans.AttachStore(store); err != nil {
+		t.Fatalf("Ошибка подключения хранилища: %v", err)
+	}
+	list := bans.List()
+	if len(list) != 1 || list[0].ID != "10.0.0.1" || list[0].Level != 1 {
+		t.Errorf("После перезапуска ожидалась одна блокировка 10.0.0.1, получено %+v", list)
+	}
+}
@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// legacyBucket - исходная реализация Token Bucket на мьютексе,
+// сохраненная для сравнения семантики и производительности
+type legacyBucket struct {
+	capacity   int
+	tokens     float64
+	rate       float64
+	lastRefill time.Time
+	mu         sync.Mutex
+}
+
+func newLegacyBucket(capacity int, rate float64, now time.Time) *legacyBucket {
+	return &legacyBucket{capacity: capacity, tokens: float64(capacity), rate: rate, lastRefill: now}
+}
+
+func (tb *legacyBucket) allowAt(now time.Time) bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refill(now)
+	if tb.tokens >= 1 {
+		tb.tokens--
+		return true
+	}
+	return false
+}
+
+func (tb *legacyBucket) refill(now time.Time) {
+	delta := now.Sub(tb.lastRefill).Seconds()
+	tb.lastRefill = now
+	newTokens := delta * tb.rate
+	if newTokens > 0 {
+		tb.tokens = min(float64(tb.capacity), tb.tokens+newTokens)
+	}
+}
+
+// legacyManager - исходный менеджер с одной глобальной блокировкой
+type legacyManager struct {
+	clients map[string]*legacyBucket
+	cap     int
+	rate    float64
+	mu      sync.RWMutex
+}
+
+func (m *legacyManager) Allow(id string) bool {
+	m.mu.RLock()
+	bucket, exists := m.clients[id]
+	m.mu.RUnlock()
+
+	if !exists {
+		m.mu.Lock()
+		if bucket, exists = m.clients[id]; !exists {
+			bucket = newLegacyBucket(m.cap, m.rate, time.Now())
+			m.clients[id] = bucket
+		}
+		m.mu.Unlock()
+	}
+	return bucket.allowAt(time.Now())
+}
+
+func TestTokenBucketMatchesLegacySemantics(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	start := time.Now()
+
+	for _, params := range []struct {
+		capacity int
+		rate     float64
+	}{{1, 1}, {10, 0.2}, {100, 50}, {5, 0}} {
+		legacy := newLegacyBucket(params.capacity, params.rate, start)
+		bucket := Policy{Capacity: params.capacity, Rate: params.rate}.newLimiter(start).(*TokenBucket)
+
+		now := start
+		for i := 0; i < 10000; i++ {
+			now = now.Add(time.Duration(rng.IntN(int(200 * time.Millisecond))))
+			want, got := legacy.allowAt(now), bucket.Take(now, 1).Allowed
+			if want != got {
+				t.Fatalf("cap=%d rate=%v шаг %d: ожидалось %v, получено %v",
+					params.capacity, params.rate, i, want, got)
+			}
+		}
+
+		// Емкость ограничивает пополнение после долгого простоя
+		now = now.Add(time.Hour)
+		if tokens := bucket.snapshot(now); tokens > float64(params.capacity) {
+			t.Errorf("Токенов больше емкости: %v > %d", tokens, params.capacity)
+		}
+	}
+}
+
+type allower interface {
+	Allow(id string) bool
+}
+
+func benchmarkAllow(b *testing.B, limiter allower, keys int) {
+	ids := make([]string, keys)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("192.168.%d.%d", i/256, i%256)
+	}
+
+	var seed atomic.Uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		rng := rand.New(rand.NewPCG(seed.Add(1), 0))
+		for pb.Next() {
+			limiter.Allow(ids[rng.IntN(len(ids))])
+		}
+	})
+}
+
+func BenchmarkManagerAllow(b *testing.B) {
+	for _, keys := range []int{1, 16, 100000} {
+		b.Run(fmt.Sprintf("legacy/keys=%d", keys), func(b *testing.B) {
+			benchmarkAllow(b, &legacyManager{clients: make(map[string]*legacyBucket), cap: 100, rate: 1e6}, keys)
+		})
+		b.Run(fmt.Sprintf("sharded/keys=%d", keys), func(b *testing.B) {
+			manager := newTestManager(b, 100, 1e6)
+			defer manager.Close()
+			benchmarkAllow(b, manager, keys)
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package ratelimit
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	metaBucket      = []byte("meta")
+	clientsBucket   = []byte("clients")
+	snapshotsBucket = []byte("snapshots")
+	quotasBucket    = []byte("quotas")
+	bansBucket      = []byte("bans")
+	scopesBucket    = []byte("scopes")
+
+	schemaVersionKey = []byte("schema_version")
+)
+
+// migration переводит схему базы с версии i на версию i+1,
+// где i - индекс миграции в списке migrations
+type migration func(tx *bolt.Tx) error
+
+// migrations содержит все миграции схемы в порядке применения.
+// Новые миграции добавляются только в конец списка
+var migrations = []migration{
+	// v0 -> v1: бакеты для переопределений лимитов и снимков токенов
+	func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(clientsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(snapshotsBucket)
+		return err
+	},
+	// v1 -> v2: счетчики календарных квот
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(quotasBucket)
+		return err
+	},
+	// v2 -> v3: временные блокировки клиентов
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bansBucket)
+		return err
+	},
+	// v3 -> v4: состояния клиентов политик маршрутов
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(scopesBucket)
+		return err
+	},
+}
+
+// bucketParent - транзакция или бакет, содержащие бакеты хранилища
+type bucketParent interface {
+	Bucket(name []byte) *bolt.Bucket
+	CreateBucket(name []byte) (*bolt.Bucket, error)
+	DeleteBucket(name []byte) error
+}
+
+// BoltStore реализует Store поверх встроенной базы bbolt
+type BoltStore struct {
+	db    *bolt.DB
+	scope []byte // Область политики маршрута; nil - общая политика
+}
+
+// OpenBoltStore открывает (или создает) файл базы и применяет миграции схемы
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &BoltStore{db: db}
+	if err := s.migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Scope возвращает хранилище отдельной политики в той же базе: переопределения,
+// снимки бакетов и квоты области не пересекаются с общими и с другими
+// областями, блокировки общие. Закрытие области не закрывает базу
+func (s *BoltStore) Scope(name string) (*BoltStore, error) {
+	scope := []byte(name)
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.Bucket(scopesBucket).CreateBucketIfNotExists(scope)
+		if err != nil {
+			return err
+		}
+		for _, name := range [][]byte{clientsBucket, snapshotsBucket, quotasBucket} {
+			if _, err := bucket.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStore{db: s.db, scope: scope}, nil
+}
+
+// parent возвращает родителя бакетов области хранилища
+func (s *BoltStore) parent(tx *bolt.Tx) bucketParent {
+	if s.scope == nil {
+		return tx
+	}
+	return tx.Bucket(scopesBucket).Bucket(s.scope)
+}
+
+// SchemaVersion возвращает текущую версию схемы базы
+func (s *BoltStore) SchemaVersion() (int, error) {
+	var version int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		version = schemaVersion(tx)
+		return nil
+	})
+	return version, err
+}
+
+// migrate последовательно применяет недостающие миграции,
+// каждую в отдельной транзакции вместе с обновлением версии
+func (s *BoltStore) migrate() error {
+	for {
+		done := false
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			version := schemaVersion(tx)
+			if version > len(migrations) {
+				return fmt.Errorf("версия схемы базы %d новее поддерживаемой %d", version, len(migrations))
+			}
+			if version == len(migrations) {
+				done = true
+				return nil
+			}
+
+			if err := migrations[version](tx); err != nil {
+				return fmt.Errorf("миграция схемы до версии %d: %w", version+1, err)
+			}
+
+			meta, err := tx.CreateBucketIfNotExists(metaBucket)
+			if err != nil {
+				return err
+			}
+			buf := make([]byte, 8)
+			binary.BigEndian.PutUint64(buf, uint64(version+1))
+			return meta.Put(schemaVersionKey, buf)
+		})
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// schemaVersion читает версию схемы; отсутствие записи означает пустую базу
+func schemaVersion(tx *bolt.Tx) int {
+	meta := tx.Bucket(metaBucket)
+	if meta == nil {
+		return 0
+	}
+	value := meta.Get(schemaVersionKey)
+	if len(value) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(value))
+}
+
+// Clients возвращает все сохраненные переопределения лимитов
+func (s *BoltStore) Clients() ([]ClientRecord, error) {
+	var records []ClientRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return s.parent(tx).Bucket(clientsBucket).ForEach(func(_, value []byte) error {
+			var record ClientRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	return records, err
+}
+
+// SaveClient создает или обновляет переопределение лимитов клиента
+func (s *BoltStore) SaveClient(record ClientRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.parent(tx).Bucket(clientsBucket).Put([]byte(record.ID), value)
+	})
+}
+
+// DeleteClient удаляет переопределение лимитов клиента
+func (s *BoltStore) DeleteClient(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return s.parent(tx).Bucket(clientsBucket).Delete([]byte(id))
+	})
+}
+
+// Snapshots возвращает последний сохраненный снимок бакетов
+func (s *BoltStore) Snapshots() ([]BucketSnapshot, error) {
+	var snapshots []BucketSnapshot
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return s.parent(tx).Bucket(snapshotsBucket).ForEach(func(_, value []byte) error {
+			var snapshot BucketSnapshot
+			if err := json.Unmarshal(value, &snapshot); err != nil {
+				return err
+			}
+			snapshots = append(snapshots, snapshot)
+			return nil
+		})
+	})
+	return snapshots, err
+}
+
+// SaveSnapshots атомарно заменяет снимок бакетов новым
+func (s *BoltStore) SaveSnapshots(snapshots []BucketSnapshot) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		parent := s.parent(tx)
+		if err := parent.DeleteBucket(snapshotsBucket); err != nil {
+			return err
+		}
+		bucket, err := parent.CreateBucket(snapshotsBucket)
+		if err != nil {
+			return err
+		}
+		for _, snapshot := range snapshots {
+			value, err := json.Marshal(snapshot)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(snapshot.ID), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Quotas возвращает сохраненные счетчики квот
+func (s *BoltStore) Quotas() ([]QuotaRecord, error) {
+	var records []QuotaRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return s.parent(tx).Bucket(quotasBucket).ForEach(func(_, value []byte) error {
+			var record QuotaRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	return records, err
+}
+
+// SaveQuotas атомарно заменяет счетчики квот новыми
+func (s *BoltStore) SaveQuotas(records []QuotaRecord) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		parent := s.parent(tx)
+		if err := parent.DeleteBucket(quotasBucket); err != nil {
+			return err
+		}
+		bucket, err := parent.CreateBucket(quotasBucket)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			value, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			// Ключ составной: одна запись на квоту и клиента
+			if err := bucket.Put([]byte(record.Quota+"/"+record.ID), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Bans возвращает сохраненные блокировки клиентов
+func (s *BoltStore) Bans() ([]Ban, error) {
+	var bans []Ban
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bansBucket).ForEach(func(_, value []byte) error {
+			var ban Ban
+			if err := json.Unmarshal(value, &ban); err != nil {
+				return err
+			}
+			bans = append(bans, ban)
+			return nil
+		})
+	})
+	return bans, err
+}
+
+// SaveBan создает или обновляет блокировку клиента
+func (s *BoltStore) SaveBan(ban Ban) error {
+	value, err := json.Marshal(ban)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bansBucket).Put([]byte(ban.ID), value)
+	})
+}
+
+// DeleteBan удаляет блокировку клиента
+func (s *BoltStore) DeleteBan(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bansBucket).Delete([]byte(id))
+	})
+}
+
+// Close закрывает файл базы; для области политики ничего не делает
+func (s *BoltStore) Close() error {
+	if s.scope != nil {
+		return nil
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,157 @@
+package ratelimit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+func newTestManager(t testing.TB, capacity int, rate float64) *Manager {
+	t.Helper()
+	manager, err := NewManager(Policy{Capacity: capacity, Rate: rate})
+	if err != nil {
+		t.Fatalf("Не удалось создать менеджер: %v", err)
+	}
+	return manager
+}
+
+func openTestStore(t *testing.T, path string) *BoltStore {
+	t.Helper()
+	store, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("Не удалось открыть хранилище: %v", err)
+	}
+	return store
+}
+
+func TestBoltStoreMigrationsAndClients(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clients.db")
+	store := openTestStore(t, path)
+
+	version, err := store.SchemaVersion()
+	if err != nil || version != len(migrations) {
+		t.Fatalf("Ожидалась версия схемы %d, получено %d (%v)", len(migrations), version, err)
+	}
+
+	record := ClientRecord{ID: "10.0.0.1", Capacity: 5, Rate: 1}
+	if err := store.SaveClient(record); err != nil {
+		t.Fatalf("Ошибка сохранения клиента: %v", err)
+	}
+	if err := store.SaveClient(ClientRecord{ID: "10.0.0.2", Capacity: 1, Rate: 1}); err != nil {
+		t.Fatalf("Ошибка сохранения клиента: %v", err)
+	}
+	if err := store.DeleteClient("10.0.0.2"); err != nil {
+		t.Fatalf("Ошибка удаления клиента: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Ошибка закрытия хранилища: %v", err)
+	}
+
+	// Повторное открытие не должно заново применять миграции и терять данные
+	store = openTestStore(t, path)
+	defer store.Close()
+
+	clients, err := store.Clients()
+	if err != nil {
+		t.Fatalf("Ошибка чтения клиентов: %v", err)
+	}
+	if len(clients) != 1 || clients[0].ID != record.ID || clients[0].Capacity != record.Capacity {
+		t.Errorf("Ожидался один клиент %+v, получено %+v", record, clients)
+	}
+}
+
+func TestBoltStoreSnapshotsAreReplaced(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "clients.db"))
+	defer store.Close()
+
+	now := time.Now()
+	first := []BucketSnapshot{{ID: "a", Tokens: 1, TakenAt: now}, {ID: "b", Tokens: 2, TakenAt: now}}
+	if err := store.SaveSnapshots(first); err != nil {
+		t.Fatalf("Ошибка сохранения снимка: %v", err)
+	}
+	if err := store.SaveSnapshots([]BucketSnapshot{{ID: "c", Tokens: 3, TakenAt: now}}); err != nil {
+		t.Fatalf("Ошибка сохранения снимка: %v", err)
+	}
+
+	snapshots, err := store.Snapshots()
+	if err != nil {
+		t.Fatalf("Ошибка чтения снимка: %v", err)
+	}
+	if len(snapshots) != 1 || snapshots[0].ID != "c" {
+		t.Errorf("Новый снимок должен полностью заменять старый, получено %+v", snapshots)
+	}
+}
+
+func TestBoltStoreScopes(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "clients.db"))
+	defer store.Close()
+	login, err := store.Scope("route:login")
+	if err != nil {
+		t.Fatalf("Ошибка открытия области: %v", err)
+	}
+
+	now := time.Now()
+	if err := store.SaveSnapshots([]BucketSnapshot{{ID: "a", Tokens: 1, TakenAt: now}}); err != nil {
+		t.Fatalf("Ошибка сохранения снимка: %v", err)
+	}
+	if err := login.SaveSnapshots([]BucketSnapshot{{ID: "b", Tokens: 2, TakenAt: now}}); err != nil {
+		t.Fatalf("Ошибка сохранения снимка области: %v", err)
+	}
+	if err := login.SaveClient(ClientRecord{ID: "vip", Capacity: 10, Rate: 1}); err != nil {
+		t.Fatalf("Ошибка сохранения клиента области: %v", err)
+	}
+	// Закрытие области не закрывает базу
+	if err := login.Close(); err != nil {
+		t.Fatalf("Ошибка закрытия области: %v", err)
+	}
+
+	// Снимок одной политики не заменяет снимки другой
+	root, err := store.Snapshots()
+	if err != nil || len(root) != 1 || root[0].ID != "a" {
+		t.Errorf("Снимок общей политики: %+v, %v", root, err)
+	}
+	scoped, err := login.Snapshots()
+	if err != nil || len(scoped) != 1 || scoped[0].ID != "b" {
+		t.Errorf("Снимок политики маршрута: %+v, %v", scoped, err)
+	}
+	if clients, err := store.Clients(); err != nil || len(clients) != 0 {
+		t.Errorf("Переопределения области попали в общую политику: %+v, %v", clients, err)
+	}
+}
+
+func TestManagerRestoresStateAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clients.db")
+	log := logger.New("error")
+
+	manager := newTestManager(t, 3, 0.001)
+	if err := manager.AttachStore(openTestStore(t, path), time.Hour, log); err != nil {
+		t.Fatalf("Ошибка подключения хранилища: %v", err)
+	}
+	if err := manager.SetClientPolicy("vip", Policy{Capacity: 10, Rate: 1}); err != nil {
+		t.Fatalf("Ошибка установки лимитов: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		manager.Allow("abuser")
+	}
+	if err := manager.Close(); err != nil {
+		t.Fatalf("Ошибка закрытия менеджера: %v", err)
+	}
+
+	// После перезапуска клиент не должен получить полный бакет
+	manager = newTestManager(t, 3, 0.001)
+	if err := manager.AttachStore(openTestStore(t, path), time.Hour, log); err != nil {
+		t.Fatalf("Ошибка подключения хранилища: %v", err)
+	}
+	defer manager.Close()
+
+	if manager.Allow("abuser") {
+		t.Errorf("Клиент с пустым бакетом получил токен после перезапуска")
+	}
+
+	vip := manager.GetClient("vip")
+	if !vip.Override || vip.Capacity != 10 || vip.Rate != 1 {
+		t.Errorf("Индивидуальные лимиты не восстановлены: %+v", vip)
+	}
+}
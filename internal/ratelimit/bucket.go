@@ -1,15 +1,129 @@
 package ratelimit
 
 import (
-	"sync"
+	"sync/atomic"
 	"time"
 )
 
-// TokenBucket реализует алгоритм Token Bucket
-type TokenBucket struct {
-	capacity   int     // Максимальное количество токенов
+// epoch - точка отсчета монотонного времени бакетов
+var epoch = time.Now()
+
+// monotonic переводит момент времени в наносекунды от epoch
+func monotonic(t time.Time) int64 {
+	return int64(t.Sub(epoch))
+}
+
+// bucketState неизменяемое состояние бакета, заменяемое целиком через CAS
+type bucketState struct {
 	tokens     float64 // Текущее количество токенов
-	rate       float64 // Скорость пополнения токенов в секунду
-	lastRefill time.Time
-	mu         sync.Mutex
+	lastRefill int64   // Время последнего пополнения, наносекунды от epoch
+}
+
+// TokenBucket реализует алгоритм Token Bucket без блокировок:
+// состояние хранится в атомарном указателе и обновляется через CAS
+type TokenBucket struct {
+	capacity int     // Максимальное количество токенов
+	rate     float64 // Скорость пополнения токенов в секунду
+	state    atomic.Pointer[bucketState]
+}
+
+// NewTokenBucket создает новый экземпляр TokenBucket
+func NewTokenBucket(capacity int, rate float64) *TokenBucket {
+	tb := &TokenBucket{
+		capacity: capacity,
+		rate:     rate,
+	}
+	tb.state.Store(&bucketState{
+		tokens:     float64(capacity),
+		lastRefill: monotonic(time.Now()),
+	})
+	return tb
+}
+
+// Allow проверяет и берет токен, если доступен
+func (tb *TokenBucket) Allow() bool {
+	return tb.Take(time.Now(), 1).Allowed
+}
+
+// Take проверяет и берет cost токенов на момент now. Если другая горутина
+// уже пополнила бакет на более поздний момент, время не откатывается назад
+func (tb *TokenBucket) Take(now time.Time, cost int) Decision {
+	at := monotonic(now)
+	for {
+		old := tb.state.Load()
+		next := tb.refill(*old, at)
+
+		allowed := next.tokens >= float64(cost)
+		if allowed {
+			next.tokens -= float64(cost)
+		}
+
+		if tb.state.CompareAndSwap(old, &next) {
+			decision := Decision{
+				Allowed:   allowed,
+				Limit:     tb.capacity,
+				Remaining: int(next.tokens),
+				Reset:     tb.timeUntil(next.tokens, float64(tb.capacity)),
+				Window:    seconds(float64(tb.capacity) / tb.rate),
+			}
+			if !allowed {
+				decision.RetryAfter = tb.timeUntil(next.tokens, float64(cost))
+			}
+			return decision
+		}
+	}
+}
+
+// Tokens возвращает количество токенов в бакете на момент now
+func (tb *TokenBucket) Tokens(now time.Time) float64 {
+	return tb.snapshot(now)
+}
+
+// TimeToNextToken возвращает время до появления целого токена;
+// 0, если токен уже доступен или бакет не пополняется
+func (tb *TokenBucket) TimeToNextToken(now time.Time) time.Duration {
+	return tb.timeUntil(tb.snapshot(now), 1)
+}
+
+// timeUntil возвращает время, за которое бакет пополнится с from до target токенов
+func (tb *TokenBucket) timeUntil(from, target float64) time.Duration {
+	if from >= target {
+		return 0
+	}
+	return seconds((target - from) / tb.rate)
+}
+
+// refill возвращает состояние бакета, пополненное на момент now
+func (tb *TokenBucket) refill(state bucketState, now int64) bucketState {
+	delta := time.Duration(now - state.lastRefill).Seconds() // время, прошедшее с последнего пополнения
+	state.lastRefill = max(state.lastRefill, now)            // обновляет время последнего пополнения
+
+	// Вычисляем, сколько токенов нужно добавить
+	newTokens := delta * tb.rate
+
+	// Обновляем количество токенов, не превышая емкость
+	if newTokens > 0 {
+		state.tokens = min(float64(tb.capacity), state.tokens+newTokens)
+	}
+
+	return state
+}
+
+// Idle сообщает, что к моменту now бакет полностью пополнился
+func (tb *TokenBucket) Idle(now time.Time) bool {
+	return tb.snapshot(now) >= float64(tb.capacity)
+}
+
+// snapshot возвращает уровень токенов на момент now, не изменяя бакет
+func (tb *TokenBucket) snapshot(now time.Time) float64 {
+	return tb.refill(*tb.state.Load(), monotonic(now)).tokens
+}
+
+// restore восстанавливает уровень токенов из снимка, сделанного в момент takenAt.
+// Токены за время простоя будут начислены при следующем пополнении
+func (tb *TokenBucket) restore(tokens float64, takenAt time.Time) {
+	tb.state.Store(&bucketState{
+		tokens:     max(0, min(float64(tb.capacity), tokens)),
+		lastRefill: monotonic(takenAt),
+	})
 }
@@ -1,15 +1,28 @@
 package ratelimit
 
 import (
+	"container/list"
+	"sync/atomic"
 	"time"
 )
 
 // Client представляет клиента с настройками rate limiting
 type Client struct {
 	ID        string
-	Bucket    *TokenBucket
+	Limiter   Limiter
+	Algorithm string
 	Capacity  int
 	Rate      float64
+	Override  bool // Индивидуальные лимиты, сохраняемые в хранилище
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	lastSeen atomic.Int64  // Время последнего обращения, UnixNano
+	element  *list.Element // Позиция клиента в списке LRU менеджера
+	slots    chan struct{} // Слоты одновременных запросов; nil - без ограничения
+}
+
+// Policy возвращает политику, по которой создан лимитер клиента
+func (c *Client) Policy() Policy {
+	return Policy{Algorithm: c.Algorithm, Capacity: c.Capacity, Rate: c.Rate}
 }
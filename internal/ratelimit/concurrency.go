@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SetMaxInFlight ограничивает число одновременных запросов одного клиента
+// (0 - без ограничения). Запрос сверх лимита ждет освобождения слота
+// не дольше queueTimeout (0 - отклоняется сразу). Вызывается до начала
+// обработки запросов
+func (m *Manager) SetMaxInFlight(maxInFlight int, queueTimeout time.Duration) {
+	m.maxInFlight = maxInFlight
+	m.queueTimeout = queueTimeout
+}
+
+// Acquire занимает слот одновременного запроса клиента. При успехе
+// возвращает функцию освобождения слота, которую безопасно вызывать
+// несколько раз; ее следует вызывать через defer, чтобы слот
+// освобождался и при панике обработчика
+func (m *Manager) Acquire(ctx context.Context, id string) (release func(), ok bool) {
+	if m.maxInFlight <= 0 {
+		return func() {}, true
+	}
+
+	s := m.shardFor(id)
+
+	// Слот занимается под блокировкой шарда, поэтому клиент не может быть
+	// вытеснен между поиском и захватом слота
+	s.mu.RLock()
+	client, exists := s.clients[id]
+	acquired := exists && client.tryAcquire()
+	s.mu.RUnlock()
+
+	if !exists {
+		s.mu.Lock()
+		client = s.getOrCreateLocked(id)
+		acquired = client.tryAcquire()
+		s.mu.Unlock()
+	}
+
+	// Пока все слоты заняты, у клиента есть запросы в работе, и он не вытесняется
+	if !acquired && !client.waitAcquire(ctx, m.queueTimeout) {
+		return nil, false
+	}
+
+	var once sync.Once
+	return func() { once.Do(client.release) }, true
+}
+
+// InFlight возвращает число одновременных запросов клиента
+func (m *Manager) InFlight(id string) int {
+	s := m.shardFor(id)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if client, exists := s.clients[id]; exists {
+		return client.inFlight()
+	}
+	return 0
+}
+
+// tryAcquire занимает слот без ожидания
+func (c *Client) tryAcquire() bool {
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitAcquire ждет свободный слот не дольше timeout или до отмены запроса
+func (c *Client) waitAcquire(ctx context.Context, timeout time.Duration) bool {
+	if timeout <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release освобождает слот
+func (c *Client) release() {
+	<-c.slots
+}
+
+// inFlight возвращает число занятых слотов
+func (c *Client) inFlight() int {
+	return len(c.slots)
+}
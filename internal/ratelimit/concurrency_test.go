@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAcquireLimitsInFlightRequests(t *testing.T) {
+	manager := newTestManager(t, 10, 1)
+	defer manager.Close()
+	manager.SetMaxInFlight(2, 0)
+
+	release1, ok1 := manager.Acquire(context.Background(), "10.0.0.1")
+	release2, ok2 := manager.Acquire(context.Background(), "10.0.0.1")
+	if !ok1 || !ok2 {
+		t.Fatalf("Первые два запроса должны получить слот")
+	}
+	if _, ok := manager.Acquire(context.Background(), "10.0.0.1"); ok {
+		t.Errorf("Третий одновременный запрос должен быть отклонен")
+	}
+	if _, ok := manager.Acquire(context.Background(), "10.0.0.2"); !ok {
+		t.Errorf("Лимит одного клиента не должен влиять на другого")
+	}
+
+	// Повторное освобождение не должно освобождать чужой слот
+	release1()
+	release1()
+	if got := manager.InFlight("10.0.0.1"); got != 1 {
+		t.Errorf("Ожидался 1 запрос в работе, получено %d", got)
+	}
+
+	release2()
+	if got := manager.InFlight("10.0.0.1"); got != 0 {
+		t.Errorf("Ожидалось 0 запросов в работе, получено %d", got)
+	}
+}
+
+func TestAcquireQueuesUntilSlotIsReleased(t *testing.T) {
+	manager := newTestManager(t, 10, 1)
+	defer manager.Close()
+	manager.SetMaxInFlight(1, time.Second)
+
+	release, _ := manager.Acquire(context.Background(), "10.0.0.1")
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		release()
+	}()
+
+	queued, ok := manager.Acquire(context.Background(), "10.0.0.1")
+	if !ok {
+		t.Fatalf("Запрос из очереди должен получить освободившийся слот")
+	}
+	queued()
+
+	// Отмена запроса прерывает ожидание
+	hold, _ := manager.Acquire(context.Background(), "10.0.0.1")
+	defer hold()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, ok := manager.Acquire(ctx, "10.0.0.1"); ok {
+		t.Errorf("Отмененный запрос не должен получить слот")
+	}
+}
@@ -0,0 +1,240 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/redis"
+)
+
+// Режимы работы при недоступности общего хранилища
+const (
+	FailLocal  = "local"  // Ограничивать локально, как будто реплика одна
+	FailOpen   = "open"   // Пропускать все запросы
+	FailClosed = "closed" // Отклонять все запросы
+)
+
+// Границы интервала проверки недоступного хранилища: интервал
+// удваивается после каждой неудачной попытки
+const (
+	probeMinInterval = 100 * time.Millisecond
+	probeMaxInterval = 10 * time.Second
+)
+
+// tokenBucketScript атомарно пополняет и списывает общий бакет.
+// Используется время сервера Redis, чтобы реплики с разными часами
+// видели одинаковое состояние. Возвращает {разрешено, остаток токенов}
+var tokenBucketScript = redis.NewScript(`
+redis.replicate_commands()
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+
+if now > ts then
+	tokens = math.min(capacity, tokens + (now - ts) * rate)
+	ts = now
+end
+
+local allowed = 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(ts))
+if rate > 0 then
+	redis.call('EXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate) + 1)
+end
+return {allowed, tostring(tokens)}
+`)
+
+// Distributed - общий для всех реплик бэкенд rate limiting поверх Redis.
+// Поддерживает алгоритм Token Bucket; клиенты с другими алгоритмами
+// ограничиваются локально. Пока хранилище недоступно, запросы к нему
+// не выполняются: решения принимаются в режиме onError, а доступность
+// проверяется в фоне
+type Distributed struct {
+	client    *redis.Client
+	keyPrefix string
+	onError   string
+	logger    *logger.Logger
+	healthy   atomic.Bool
+	probing   atomic.Bool // Запущена фоновая проверка доступности
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewDistributed создает бэкенд; onError задает поведение при сбое Redis
+func NewDistributed(client *redis.Client, keyPrefix, onError string, log *logger.Logger) (*Distributed, error) {
+	switch onError {
+	case FailLocal, FailOpen, FailClosed:
+	default:
+		return nil, fmt.Errorf("неизвестный режим при сбое хранилища: %q", onError)
+	}
+
+	d := &Distributed{
+		client:    client,
+		keyPrefix: keyPrefix,
+		onError:   onError,
+		logger:    log,
+		done:      make(chan struct{}),
+	}
+	d.healthy.Store(true)
+	return d, nil
+}
+
+// take выполняет скрипт для ключа клиента, списывая cost токенов
+func (d *Distributed) take(id string, capacity int, rate float64, cost int) (bool, float64, error) {
+	reply, err := d.client.Eval(tokenBucketScript, []string{d.keyPrefix + id},
+		strconv.Itoa(capacity),
+		strconv.FormatFloat(rate, 'f', -1, 64),
+		strconv.Itoa(cost),
+	)
+	if err != nil {
+		return false, 0, err
+	}
+
+	items, ok := reply.([]interface{})
+	if !ok || len(items) != 2 {
+		return false, 0, fmt.Errorf("неожиданный ответ скрипта: %v", reply)
+	}
+	allowed, _ := items[0].(int64)
+	tokensStr, _ := items[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return false, 0, fmt.Errorf("неожиданный остаток токенов: %v", items[1])
+	}
+	return allowed == 1, tokens, nil
+}
+
+// setHealthy фиксирует доступность хранилища и логирует только переходы
+func (d *Distributed) setHealthy(healthy bool, err error) {
+	if d.healthy.Swap(healthy) == healthy {
+		return
+	}
+	if healthy {
+		d.logger.Info("Хранилище распределенного rate limiting снова доступно")
+	} else {
+		d.logger.Error("Хранилище распределенного rate limiting недоступно, режим ", d.onError, ": ", err)
+		d.startProbe()
+	}
+}
+
+// startProbe запускает фоновую проверку доступности хранилища, если она
+// еще не запущена
+func (d *Distributed) startProbe() {
+	select {
+	case <-d.done:
+		return
+	default:
+	}
+	if !d.probing.CompareAndSwap(false, true) {
+		return
+	}
+	d.wg.Add(1)
+	go d.probe()
+}
+
+// probe проверяет хранилище командой PING с увеличивающимся интервалом
+// и возвращает его в работу после первого успешного ответа
+func (d *Distributed) probe() {
+	defer d.wg.Done()
+	wait := probeMinInterval
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-d.done:
+			timer.Stop()
+			return
+		}
+		if _, err := d.client.Do("PING"); err == nil {
+			// Сбрасывается до setHealthy, чтобы следующий сбой запустил новую проверку
+			d.probing.Store(false)
+			d.setHealthy(true, nil)
+			return
+		}
+		wait = min(wait*2, probeMaxInterval)
+	}
+}
+
+// Healthy сообщает, доступно ли хранилище
+func (d *Distributed) Healthy() bool {
+	return d.healthy.Load()
+}
+
+// Close останавливает проверку доступности и закрывает соединения с хранилищем
+func (d *Distributed) Close() error {
+	close(d.done)
+	d.wg.Wait()
+	return d.client.Close()
+}
+
+// distributedLimiter ограничивает клиента общим бакетом в Redis,
+// а при сбое хранилища - согласно режиму onError
+type distributedLimiter struct {
+	backend  *Distributed
+	id       string
+	capacity int
+	rate     float64
+	local    Limiter // Локальный бакет для режима FailLocal
+}
+
+// Take проверяет запрос по общему бакету. Пока хранилище недоступно,
+// решение сразу принимается в режиме onError без ожидания таймаута
+func (dl *distributedLimiter) Take(now time.Time, cost int) Decision {
+	if !dl.backend.Healthy() {
+		return dl.fallback(now, cost)
+	}
+	allowed, tokens, err := dl.backend.take(dl.id, dl.capacity, dl.rate, cost)
+	if err != nil {
+		dl.backend.setHealthy(false, err)
+		return dl.fallback(now, cost)
+	}
+	dl.backend.setHealthy(true, nil)
+
+	decision := Decision{
+		Allowed:   allowed,
+		Limit:     dl.capacity,
+		Remaining: int(tokens),
+		Reset:     seconds((float64(dl.capacity) - tokens) / dl.rate),
+		Window:    seconds(float64(dl.capacity) / dl.rate),
+	}
+	if !allowed {
+		decision.RetryAfter = seconds((float64(cost) - tokens) / dl.rate)
+	}
+	return decision
+}
+
+// fallback принимает решение без общего хранилища
+func (dl *distributedLimiter) fallback(now time.Time, cost int) Decision {
+	switch dl.backend.onError {
+	case FailOpen:
+		return Decision{Allowed: true, Limit: dl.capacity, Remaining: dl.capacity}
+	case FailClosed:
+		return Decision{Limit: dl.capacity, RetryAfter: time.Second}
+	default:
+		return dl.local.Take(now, cost)
+	}
+}
+
+// Idle сообщает, что локальное состояние клиента можно вытеснить:
+// общий бакет хранится в Redis и переживает вытеснение
+func (dl *distributedLimiter) Idle(now time.Time) bool {
+	return dl.local.Idle(now)
+}
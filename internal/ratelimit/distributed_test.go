@@ -0,0 +1,119 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/redis"
+)
+
+// newReplica создает менеджер, подключенный к общему хранилищу,
+// как отдельная реплика балансировщика
+func newReplica(t *testing.T, addr, onError string) *Manager {
+	t.Helper()
+
+	client := redis.NewClient(redis.Options{Addr: addr, Timeout: 200 * time.Millisecond})
+	backend, err := NewDistributed(client, "lb:rl:", onError, logger.New("error"))
+	if err != nil {
+		t.Fatalf("Не удалось создать распределенный бэкенд: %v", err)
+	}
+
+	manager := newTestManager(t, 5, 0.001)
+	manager.SetDistributed(backend)
+	t.Cleanup(func() { _ = manager.Close() })
+	return manager
+}
+
+func TestDistributedLimitIsSharedBetweenReplicas(t *testing.T) {
+	server := miniredis.RunT(t)
+	first := newReplica(t, server.Addr(), FailLocal)
+	second := newReplica(t, server.Addr(), FailLocal)
+
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		replica := first
+		if i%2 == 1 {
+			replica = second
+		}
+		if replica.Allow("10.0.0.1") {
+			allowed++
+		}
+	}
+	if allowed != 5 {
+		t.Errorf("Ожидалось 5 запросов на обе реплики, пропущено %d", allowed)
+	}
+
+	decision := first.Take("10.0.0.1")
+	if decision.Allowed || decision.Remaining != 0 || decision.RetryAfter <= 0 {
+		t.Errorf("Некорректное решение для исчерпанного общего бакета: %+v", decision)
+	}
+	if !server.Exists("lb:rl:10.0.0.1") {
+		t.Errorf("Состояние бакета не сохранено в хранилище")
+	}
+}
+
+func TestDistributedFallbackModes(t *testing.T) {
+	for _, tc := range []struct {
+		mode    string
+		allowed int
+	}{
+		{FailLocal, 5},
+		{FailOpen, 10},
+		{FailClosed, 0},
+	} {
+		t.Run(tc.mode, func(t *testing.T) {
+			server := miniredis.RunT(t)
+			manager := newReplica(t, server.Addr(), tc.mode)
+			server.Close()
+
+			allowed := 0
+			for i := 0; i < 10; i++ {
+				if manager.Allow("10.0.0.1") {
+					allowed++
+				}
+			}
+			if allowed != tc.allowed {
+				t.Errorf("Режим %s: ожидалось %d пропущенных запросов, получено %d", tc.mode, tc.allowed, allowed)
+			}
+			if manager.distributed.Healthy() {
+				t.Errorf("Недоступное хранилище помечено как доступное")
+			}
+		})
+	}
+}
+
+func TestDistributedRecovery(t *testing.T) {
+	server := miniredis.RunT(t)
+	manager := newReplica(t, server.Addr(), FailOpen)
+	addr := server.Addr()
+	server.Close()
+
+	// Запрос к хранилищу выполняется один раз: остальные сразу
+	// обрабатываются в режиме onError без ожидания таймаута
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if !manager.Allow("10.0.0.1") {
+			t.Fatalf("Режим open: запрос %d отклонен", i)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Запросы при недоступном хранилище заняли %v", elapsed)
+	}
+
+	// Фоновая проверка возвращает хранилище в работу
+	if err := server.StartAddr(addr); err != nil {
+		t.Fatalf("Не удалось перезапустить хранилище: %v", err)
+	}
+	for deadline := time.Now().Add(3 * time.Second); !manager.distributed.Healthy(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Хранилище не возвращено в работу")
+		}
+	}
+	manager.Allow("10.0.0.1")
+	if !server.Exists("lb:rl:10.0.0.1") {
+		t.Errorf("После восстановления запросы не проверяются по общему бакету")
+	}
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+// Stats содержит метрики отслеживаемых клиентов
+type Stats struct {
+	Tracked int    `json:"tracked"` // Клиентов в памяти сейчас
+	Created uint64 `json:"created"` // Клиентов создано за все время
+	Evicted uint64 `json:"evicted"` // Клиентов вытеснено за все время
+}
+
+// Stats возвращает текущие метрики менеджера
+func (m *Manager) Stats() Stats {
+	tracked := 0
+	for _, s := range m.shards {
+		s.mu.RLock()
+		tracked += len(s.clients)
+		s.mu.RUnlock()
+	}
+
+	return Stats{
+		Tracked: tracked,
+		Created: m.created.Load(),
+		Evicted: m.evicted.Load(),
+	}
+}
+
+// StartEviction ограничивает число отслеживаемых клиентов значением
+// maxClients (0 - без ограничения) и запускает фоновое вытеснение клиентов,
+// чей лимитер в исходном состоянии и не использовался дольше ttl (0 - без вытеснения по простою).
+// Лимит не жесткий: он делится поровну между шардами, ceil(maxClients/64),
+// но не меньше 1 на шард, и вытеснение LRU выполняется внутри шарда. Поэтому
+// всего отслеживается до 64*ceil(maxClients/64) клиентов, а клиент может
+// быть вытеснен из заполненного шарда раньше, чем заполнятся остальные.
+// Клиенты с индивидуальными лимитами и запросами в работе не вытесняются
+// и могут превысить долю шарда. Тот же предел (общий, без деления на шарды)
+// ограничивает число счетчиков каждой квоты
+func (m *Manager) StartEviction(ttl time.Duration, maxClients int, log *logger.Logger) {
+	m.logger = log
+	m.maxClients = maxClients
+	for _, q := range m.quotas {
+		q.setMaxCounters(maxClients)
+	}
+
+	perShard := 0
+	if maxClients > 0 {
+		perShard = max(1, (maxClients+shardCount-1)/shardCount)
+	}
+	for _, s := range m.shards {
+		s.mu.Lock()
+		s.maxClients = perShard
+		if perShard > 0 && len(s.clients) > perShard {
+			s.evictOverflowLocked()
+		}
+		s.mu.Unlock()
+	}
+
+	if ttl <= 0 {
+		return
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(ttl / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if evicted := m.evictIdle(m.clock(), ttl); evicted > 0 {
+					stats := m.Stats()
+					m.logger.Info("Вытеснено неактивных клиентов: ", evicted,
+						", отслеживается: ", stats.Tracked,
+						", создано: ", stats.Created,
+						", вытеснено всего: ", stats.Evicted)
+				}
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// evictIdle вытесняет неактивных клиентов во всех шардах
+// и возвращает их общее число
+func (m *Manager) evictIdle(now time.Time, ttl time.Duration) int {
+	evicted := 0
+	for _, s := range m.shards {
+		evicted += s.evictIdle(now, ttl)
+	}
+	return evicted
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+func TestEvictIdleKeepsBusyAndOverrideClients(t *testing.T) {
+	manager := newTestManager(t, 2, 1000)
+	defer manager.Close()
+
+	manager.Allow("idle")
+	if err := manager.SetClientPolicy("vip", Policy{Capacity: 2, Rate: 1000}); err != nil {
+		t.Fatalf("Ошибка установки лимитов: %v", err)
+	}
+
+	// Бакет клиента "empty" не успеет пополниться при нулевой скорости
+	s := manager.shardFor("empty")
+	s.mu.Lock()
+	s.addClientLocked(manager.newClient("empty", Policy{Capacity: 2}))
+	s.mu.Unlock()
+	manager.Allow("empty")
+
+	evicted := manager.evictIdle(time.Now().Add(time.Hour), time.Minute)
+	if evicted != 1 {
+		t.Errorf("Ожидалось вытеснение одного клиента, вытеснено %d", evicted)
+	}
+
+	stats := manager.Stats()
+	if stats.Tracked != 2 || stats.Created != 3 || stats.Evicted != 1 {
+		t.Errorf("Некорректные метрики: %+v", stats)
+	}
+	if tracked(manager, "idle") {
+		t.Errorf("Неактивный клиент с полным бакетом не вытеснен")
+	}
+}
+
+// tracked проверяет, отслеживается ли клиент менеджером
+func tracked(m *Manager, id string) bool {
+	s := m.shardFor(id)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, exists := s.clients[id]
+	return exists
+}
+
+// sameShardIDs подбирает n идентификаторов, попадающих в один шард
+func sameShardIDs(n int) []string {
+	var ids []string
+	for i := 0; len(ids) < n; i++ {
+		id := fmt.Sprintf("10.0.0.%d", i)
+		if shardIndex(id) == shardIndex("10.0.0.0") {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func TestMaxClientsEvictsLeastRecentlyUsed(t *testing.T) {
+	manager := newTestManager(t, 10, 1)
+	defer manager.Close()
+	// Лимит делится между шардами: по два клиента на шард
+	manager.StartEviction(0, 2*shardCount, logger.New("error"))
+
+	ids := sameShardIDs(3)
+	a, b, c := ids[0], ids[1], ids[2]
+
+	manager.Allow(a)
+	manager.Allow(b)
+	// Порядок LRU обновляется не чаще touchGranularity
+	time.Sleep(2 * touchGranularity)
+	manager.Allow(a) // b становится наименее недавно использованным
+	manager.Allow(c)
+
+	if !tracked(manager, a) || tracked(manager, b) || !tracked(manager, c) {
+		t.Errorf("Ожидалось вытеснение клиента b: a=%v, b=%v, c=%v",
+			tracked(manager, a), tracked(manager, b), tracked(manager, c))
+	}
+}
+
+func TestMaxClientsPerShard(t *testing.T) {
+	manager := newTestManager(t, 10, 1)
+	defer manager.Close()
+	// Предел меньше числа шардов: каждому шарду достается одно место
+	manager.StartEviction(0, 10, logger.New("error"))
+
+	for i := 0; i < 1000; i++ {
+		manager.Allow(fmt.Sprintf("client-%d", i))
+	}
+	if count := manager.Stats().Tracked; count <= 10 || count > shardCount {
+		t.Errorf("Отслеживается %d клиентов, ожидалось от 11 до %d", count, shardCount)
+	}
+}
+
+func TestEvictionDoesNotRaceWithAllow(t *testing.T) {
+	manager := newTestManager(t, 1000, 1000)
+	defer manager.Close()
+	manager.StartEviction(0, shardCount, logger.New("error"))
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				manager.Allow(fmt.Sprintf("client-%d-%d", g, i%100))
+			}
+		}(g)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			manager.evictIdle(time.Now(), 0)
+		}
+	}()
+	wg.Wait()
+
+	if count := manager.Stats().Tracked; count > shardCount {
+		t.Errorf("Превышен лимит отслеживаемых клиентов: %d", count)
+	}
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// GCRA реализует Generic Cell Rate Algorithm. Вместо счетчика токенов
+// хранится теоретическое время прибытия (TAT) следующего запроса:
+// запрос пропускается, если он пришел не раньше TAT минус допустимый всплеск
+type GCRA struct {
+	interval  time.Duration // Интервал эмиссии: 1/rate
+	tolerance time.Duration // Допустимое опережение: burst*interval
+	tat       int64         // Теоретическое время прибытия, UnixNano
+	mu        sync.Mutex
+}
+
+func newGCRA(burst int, rate float64) *GCRA {
+	interval := time.Duration(float64(time.Second) / rate)
+	return &GCRA{
+		interval:  interval,
+		tolerance: time.Duration(burst) * interval,
+	}
+}
+
+// Take проверяет и учитывает запрос стоимостью cost в момент now
+func (g *GCRA) Take(now time.Time, cost int) Decision {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ts := now.UnixNano()
+	tat := max(g.tat, ts)
+	next := tat + int64(cost)*int64(g.interval)
+
+	decision := Decision{
+		Limit:  int(g.tolerance / g.interval),
+		Window: g.tolerance,
+	}
+	if next-ts > int64(g.tolerance) {
+		decision.RetryAfter = time.Duration(next - int64(g.tolerance) - ts)
+	} else {
+		decision.Allowed = true
+		g.tat = next
+		tat = next
+	}
+
+	// Запас до предела в интервалах эмиссии
+	decision.Remaining = int((int64(g.tolerance) - (tat - ts)) / int64(g.interval))
+	decision.Reset = time.Duration(tat - ts)
+	return decision
+}
+
+// Idle сообщает, что TAT остался в прошлом и всплеск полностью восстановлен
+func (g *GCRA) Idle(now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.tat <= now.UnixNano()
+}
@@ -0,0 +1,120 @@
+package ratelimit
+
+import "time"
+
+// Inherit переносит в новый менеджер состояние менеджера old, который он
+// заменяет при перезагрузке конфигурации: лимитеры клиентов, занятые слоты
+// одновременных запросов, индивидуальные политики и счетчики квот.
+// Вызывается после AttachStore: состояние в памяти новее сохраненного снимка.
+// Лимитер клиента переносится целиком, если его политика не изменилась;
+// при смене емкости или скорости Token Bucket переносится уровень токенов,
+// при смене алгоритма лимитер начинается заново. Слоты переносятся, если
+// не изменился лимит одновременных запросов
+func (m *Manager) Inherit(old *Manager) {
+	var clients []*Client
+	for _, s := range old.shards {
+		s.mu.RLock()
+		for _, client := range s.clients {
+			clients = append(clients, client)
+		}
+		s.mu.RUnlock()
+	}
+
+	now := m.clock()
+	for _, oldClient := range clients {
+		s := m.shardFor(oldClient.ID)
+		s.mu.Lock()
+		client, exists := s.clients[oldClient.ID]
+		switch {
+		case exists:
+		case oldClient.Override:
+			// Политика, заданная через admin API без хранилища
+			client = m.newClient(oldClient.ID, oldClient.Policy())
+			client.Override = true
+			client.CreatedAt, client.UpdatedAt = oldClient.CreatedAt, oldClient.UpdatedAt
+			s.addClientLocked(client)
+		default:
+			client = s.getOrCreateLocked(oldClient.ID)
+		}
+		inheritLimiter(client, oldClient, now)
+		if client.slots != nil && cap(client.slots) == cap(oldClient.slots) {
+			// Запросы в работе освобождают слоты общего канала
+			client.slots = oldClient.slots
+		}
+		client.lastSeen.Store(oldClient.lastSeen.Load())
+		s.mu.Unlock()
+	}
+
+	m.restoreQuotas(old.quotaRecords(now), now)
+}
+
+// inheritLimiter переносит состояние лимитера клиента old в клиента client.
+// Общий бакет распределенного режима хранится в Redis, переносится только
+// локальный бакет режима FailLocal; при включении или выключении
+// распределенного режима лимитер начинается заново
+func inheritLimiter(client, old *Client, now time.Time) {
+	_, distributed := client.Limiter.(*distributedLimiter)
+	if _, oldDistributed := old.Limiter.(*distributedLimiter); distributed != oldDistributed {
+		return
+	}
+	from := localLimiter(old.Limiter)
+	if client.Policy() == old.Policy() {
+		if dl, ok := client.Limiter.(*distributedLimiter); ok {
+			dl.local = from
+		} else {
+			client.Limiter = from
+		}
+		return
+	}
+
+	tb, ok := localLimiter(client.Limiter).(*TokenBucket)
+	fromTB, fromOK := from.(*TokenBucket)
+	if ok && fromOK {
+		tb.restore(fromTB.snapshot(now), now)
+	}
+}
+
+// localLimiter возвращает локальный лимитер клиента
+func localLimiter(l Limiter) Limiter {
+	if dl, ok := l.(*distributedLimiter); ok {
+		return dl.local
+	}
+	return l
+}
+
+// Inherit переносит в новый список блокировок действующие блокировки
+// и историю отказов списка old, который он заменяет при перезагрузке
+// конфигурации. Вызывается после AttachStore. При смене max_rejections
+// сохраняются последние отказы в пределах нового лимита
+func (b *Banlist) Inherit(old *Banlist) {
+	old.banMu.RLock()
+	bans := make([]Ban, 0, len(old.bans))
+	for _, ban := range old.bans {
+		bans = append(bans, *ban)
+	}
+	old.banMu.RUnlock()
+
+	b.banMu.Lock()
+	for i := range bans {
+		b.bans[bans[i].ID] = &bans[i]
+	}
+	b.records.Store(int64(len(b.bans)))
+	b.banMu.Unlock()
+
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for id, s := range old.strikes {
+		inherited := &strikes{times: make([]int64, b.policy.MaxRejections)}
+		// Отказы переносятся от старых к новым, лишние старые отбрасываются
+		skip := max(0, s.count-len(inherited.times))
+		for i := skip; i < s.count; i++ {
+			inherited.times[inherited.next] = s.times[(s.next-s.count+i+len(s.times))%len(s.times)]
+			inherited.next = (inherited.next + 1) % len(inherited.times)
+			inherited.count++
+		}
+		b.strikes[id] = inherited
+	}
+}
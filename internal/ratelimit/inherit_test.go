@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestManagerInherit(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)}
+	old := newTestManager(t, 3, 0.001)
+	old.clock = clock.Now
+	old.SetMaxInFlight(2, 0)
+	defer old.Close()
+	daily, _ := NewQuota(QuotaPolicy{Name: "daily", Period: QuotaDaily, Limit: 5})
+	old.AddQuota(daily)
+
+	for i := 0; i < 3; i++ {
+		old.Take("10.0.0.1")
+		old.TakeQuota("10.0.0.1")
+	}
+	old.Take("10.0.0.2")
+	if err := old.SetClientPolicy("vip", Policy{Capacity: 100, Rate: 1}); err != nil {
+		t.Fatal(err)
+	}
+	release, _ := old.Acquire(context.Background(), "10.0.0.2")
+
+	// Новая политика увеличивает емкость и лимит квоты
+	m := newTestManager(t, 10, 0.001)
+	m.clock = clock.Now
+	m.SetMaxInFlight(2, 0)
+	defer m.Close()
+	daily, _ = NewQuota(QuotaPolicy{Name: "daily", Period: QuotaDaily, Limit: 10})
+	m.AddQuota(daily)
+	m.Inherit(old)
+
+	if decision := m.Take("10.0.0.1"); decision.Allowed {
+		t.Errorf("Исчерпанный бакет сброшен при переносе: %+v", decision)
+	}
+	if decision := m.Take("10.0.0.2"); !decision.Allowed || decision.Remaining != 1 {
+		t.Errorf("Уровень токенов не перенесен: %+v", decision)
+	}
+	if decision := m.TakeQuota("10.0.0.1"); decision.Remaining != 6 {
+		t.Errorf("Счетчик квоты не перенесен: %+v", decision)
+	}
+	if client := m.GetClient("vip"); !client.Override || client.Capacity != 100 {
+		t.Errorf("Индивидуальная политика не перенесена: %+v", client.Policy())
+	}
+
+	// Запрос в работе занимает слот нового менеджера и освобождает его
+	if m.InFlight("10.0.0.2") != 1 {
+		t.Fatalf("Слоты одновременных запросов не перенесены")
+	}
+	release()
+	if m.InFlight("10.0.0.2") != 0 {
+		t.Errorf("Слот не освобожден в новом менеджере")
+	}
+}
+
+func TestBanlistInherit(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_000_000, 0)}
+	old := newTestBanlist(t, clock)
+	for i := 0; i < 4; i++ {
+		old.Reject("10.0.0.1")
+	}
+	for i := 0; i < 3; i++ {
+		old.Reject("10.0.0.2")
+	}
+
+	bans := newTestBanlist(t, clock)
+	bans.Inherit(old)
+	if _, banned := bans.Banned("10.0.0.1"); !banned {
+		t.Errorf("Блокировка не перенесена")
+	}
+	// История отказов переносится: следующий отказ приводит к блокировке
+	bans.Reject("10.0.0.2")
+	if _, banned := bans.Banned("10.0.0.2"); !banned {
+		t.Errorf("История отказов не перенесена")
+	}
+}
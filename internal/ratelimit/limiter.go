@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Поддерживаемые алгоритмы ограничения частоты запросов
+const (
+	AlgorithmTokenBucket          = "token_bucket"
+	AlgorithmFixedWindow          = "fixed_window"
+	AlgorithmSlidingWindowLog     = "sliding_window_log"
+	AlgorithmSlidingWindowCounter = "sliding_window_counter"
+	AlgorithmGCRA                 = "gcra"
+)
+
+// Decision описывает результат проверки запроса и состояние лимита после нее
+type Decision struct {
+	Allowed    bool
+	Limit      int           // Максимальный всплеск запросов
+	Remaining  int           // Сколько запросов еще можно выполнить немедленно
+	Reset      time.Duration // Время до полного восстановления лимита
+	RetryAfter time.Duration // Время до следующего разрешенного запроса; 0, если запрос пропущен
+	Window     time.Duration // Окно политики: Limit запросов за Window
+	Shadowed   bool          // Запрос превысил лимит, но пропущен в теневом режиме
+}
+
+// Limiter интерфейс алгоритма ограничения частоты запросов одного клиента.
+// Время передается явно, что позволяет проверять алгоритмы на фиктивных часах
+type Limiter interface {
+	// Take проверяет и учитывает запрос стоимостью cost токенов,
+	// пришедший в момент now
+	Take(now time.Time, cost int) Decision
+	// Idle сообщает, что к моменту now состояние лимитера не отличается
+	// от нового, и клиента можно вытеснить без потери информации
+	Idle(now time.Time) bool
+}
+
+// Policy описывает алгоритм и его параметры.
+// Capacity - максимальный всплеск запросов, Rate - долгосрочная скорость
+// в запросах в секунду. Оконные алгоритмы пропускают Capacity запросов
+// за окно длиной Capacity/Rate секунд
+type Policy struct {
+	Algorithm string  `json:"algorithm"`
+	Capacity  int     `json:"capacity"`
+	Rate      float64 `json:"rate"`
+}
+
+// Validate проверяет корректность параметров политики
+func (p Policy) Validate() error {
+	if p.Capacity <= 0 {
+		return fmt.Errorf("емкость должна быть положительной, получено %d", p.Capacity)
+	}
+	if p.Rate < 0 {
+		return fmt.Errorf("скорость не может быть отрицательной, получено %v", p.Rate)
+	}
+
+	switch p.algorithm() {
+	case AlgorithmTokenBucket:
+		return nil
+	case AlgorithmFixedWindow, AlgorithmSlidingWindowLog, AlgorithmSlidingWindowCounter:
+		if p.Rate == 0 {
+			return fmt.Errorf("алгоритм %s требует положительной скорости", p.Algorithm)
+		}
+		if p.window() < time.Nanosecond {
+			return fmt.Errorf("скорость %v слишком велика для емкости %d: окно алгоритма %s короче 1нс",
+				p.Rate, p.Capacity, p.Algorithm)
+		}
+		return nil
+	case AlgorithmGCRA:
+		if p.Rate == 0 {
+			return fmt.Errorf("алгоритм %s требует положительной скорости", p.Algorithm)
+		}
+		if seconds(1/p.Rate) < time.Nanosecond {
+			return fmt.Errorf("скорость %v слишком велика: интервал алгоритма %s короче 1нс", p.Rate, p.Algorithm)
+		}
+		return nil
+	default:
+		return fmt.Errorf("неизвестный алгоритм rate limiting: %q", p.Algorithm)
+	}
+}
+
+// algorithm возвращает алгоритм политики; по умолчанию используется Token Bucket
+func (p Policy) algorithm() string {
+	if p.Algorithm == "" {
+		return AlgorithmTokenBucket
+	}
+	return p.Algorithm
+}
+
+// window возвращает длину окна политики; 0 при нулевой скорости
+func (p Policy) window() time.Duration {
+	return seconds(float64(p.Capacity) / p.Rate)
+}
+
+// seconds переводит секунды в time.Duration; бесконечность и NaN дают 0
+func seconds(s float64) time.Duration {
+	if math.IsInf(s, 0) || math.IsNaN(s) {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+// NewLimiter создает лимитер по политике; now - момент создания
+func NewLimiter(p Policy, now time.Time) (Limiter, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p.newLimiter(now), nil
+}
+
+// newLimiter создает лимитер по заранее проверенной политике
+func (p Policy) newLimiter(now time.Time) Limiter {
+	switch p.algorithm() {
+	case AlgorithmFixedWindow:
+		return newFixedWindow(p.Capacity, p.window())
+	case AlgorithmSlidingWindowLog:
+		return newSlidingWindowLog(p.Capacity, p.window())
+	case AlgorithmSlidingWindowCounter:
+		return newSlidingWindowCounter(p.Capacity, p.window())
+	case AlgorithmGCRA:
+		return newGCRA(p.Capacity, p.Rate)
+	default:
+		tb := NewTokenBucket(p.Capacity, p.Rate)
+		tb.restore(float64(p.Capacity), now)
+		return tb
+	}
+}
@@ -0,0 +1,206 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock - управляемые часы для проверки алгоритмов
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// conformanceCase описывает алгоритм и заявленный им предел: максимальное
+// число пропущенных запросов в любом интервале длиной в одно окно
+type conformanceCase struct {
+	algorithm string
+	perWindow func(p Policy) int
+}
+
+var conformanceCases = []conformanceCase{
+	{AlgorithmTokenBucket, func(p Policy) int { return 2 * p.Capacity }},
+	{AlgorithmGCRA, func(p Policy) int { return 2 * p.Capacity }},
+	{AlgorithmSlidingWindowLog, func(p Policy) int { return p.Capacity }},
+	// Оба оконных счетчика допускают двойной всплеск на стыке окон
+	{AlgorithmFixedWindow, func(p Policy) int { return 2 * p.Capacity }},
+	{AlgorithmSlidingWindowCounter, func(p Policy) int { return 2 * p.Capacity }},
+}
+
+func TestLimiterConformance(t *testing.T) {
+	for _, tc := range conformanceCases {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			policy := Policy{Algorithm: tc.algorithm, Capacity: 10, Rate: 5}
+			window := policy.window()
+			// Начало совпадает с границей окна, чтобы результат был детерминирован
+			clock := &fakeClock{now: time.Unix(1_000_000, 0)}
+
+			// Политика с окном или интервалом короче 1нс либо отклоняется,
+			// либо работает без паники
+			if extreme, err := NewLimiter(Policy{Algorithm: tc.algorithm, Capacity: 1, Rate: 1e10}, clock.Now()); err == nil {
+				extreme.Take(clock.Now(), 1)
+				extreme.Take(clock.Now(), 1)
+			}
+
+			limiter, err := NewLimiter(policy, clock.Now())
+			if err != nil {
+				t.Fatalf("Не удалось создать лимитер: %v", err)
+			}
+			if !limiter.Idle(clock.Now()) {
+				t.Errorf("Новый лимитер должен быть в исходном состоянии")
+			}
+
+			// Мгновенный всплеск ограничен емкостью
+			burst := 0
+			for i := 0; i < 100; i++ {
+				if limiter.Take(clock.Now(), 1).Allowed {
+					burst++
+				}
+			}
+			if burst != policy.Capacity {
+				t.Errorf("Всплеск: ожидалось %d запросов, пропущено %d", policy.Capacity, burst)
+			}
+			if limiter.Idle(clock.Now()) {
+				t.Errorf("Лимитер с учтенными запросами не должен считаться простаивающим")
+			}
+
+			// Отказ сообщает точное время до следующего разрешенного запроса
+			denied := limiter.Take(clock.Now(), 1)
+			if denied.Allowed || denied.Remaining != 0 || denied.RetryAfter <= 0 || denied.Limit != policy.Capacity {
+				t.Fatalf("Некорректное решение после всплеска: %+v", denied)
+			}
+			clock.Advance(denied.RetryAfter - time.Millisecond)
+			if limiter.Take(clock.Now(), 1).Allowed {
+				t.Errorf("Запрос пропущен раньше RetryAfter=%v", denied.RetryAfter)
+			}
+			clock.Advance(time.Millisecond)
+			if !limiter.Take(clock.Now(), 1).Allowed {
+				t.Errorf("Запрос не пропущен по истечении RetryAfter=%v", denied.RetryAfter)
+			}
+
+			// Равномерная перегрузка: 100 запросов в секунду в течение минуты
+			duration := time.Minute
+			var accepted []time.Time
+			for elapsed := time.Duration(0); elapsed < duration; elapsed += 10 * time.Millisecond {
+				clock.Advance(10 * time.Millisecond)
+				if limiter.Take(clock.Now(), 1).Allowed {
+					accepted = append(accepted, clock.Now())
+				}
+			}
+
+			// В любом интервале длиной в окно не больше заявленного предела
+			limit := tc.perWindow(policy)
+			for i, start := range accepted {
+				count := 0
+				for _, ts := range accepted[i:] {
+					if ts.Sub(start) >= window {
+						break
+					}
+					count++
+				}
+				if count > limit {
+					t.Fatalf("В окне с %v пропущено %d запросов, предел %d", start, count, limit)
+				}
+			}
+
+			// Долгосрочная скорость не превышает политику. Скользящий счетчик
+			// под постоянной перегрузкой пропускает заметно меньше, поэтому
+			// снизу проверяется только отсутствие голодания
+			expected := policy.Rate * duration.Seconds()
+			if got := float64(len(accepted)); got > expected+float64(policy.Capacity) || got < 0.8*expected {
+				t.Errorf("За %v пропущено %v запросов, ожидалось около %v", duration, got, expected)
+			}
+
+			// После простоя лимитер возвращается в исходное состояние
+			clock.Advance(2 * window)
+			if !limiter.Idle(clock.Now()) {
+				t.Errorf("Лимитер не вернулся в исходное состояние после простоя")
+			}
+		})
+	}
+}
+
+func TestLimiterCost(t *testing.T) {
+	for _, tc := range conformanceCases {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			policy := Policy{Algorithm: tc.algorithm, Capacity: 10, Rate: 5}
+			clock := &fakeClock{now: time.Unix(1_000_000, 0)}
+			limiter, _ := NewLimiter(policy, clock.Now())
+
+			// Запросы стоимостью 4 токена: в емкость 10 помещаются два
+			if !limiter.Take(clock.Now(), 4).Allowed || !limiter.Take(clock.Now(), 4).Allowed {
+				t.Fatalf("Два запроса стоимостью 4 должны быть пропущены")
+			}
+			denied := limiter.Take(clock.Now(), 4)
+			if denied.Allowed || denied.Remaining != 2 || denied.RetryAfter <= 0 {
+				t.Fatalf("Некорректное решение для дорогого запроса: %+v", denied)
+			}
+			if !limiter.Take(clock.Now(), 2).Allowed {
+				t.Fatalf("Оставшиеся токены должны быть доступны дешевому запросу")
+			}
+
+			denied = limiter.Take(clock.Now(), 4)
+			clock.Advance(denied.RetryAfter - time.Millisecond)
+			if limiter.Take(clock.Now(), 4).Allowed {
+				t.Errorf("Запрос пропущен раньше RetryAfter=%v", denied.RetryAfter)
+			}
+			clock.Advance(time.Millisecond)
+			if !limiter.Take(clock.Now(), 4).Allowed {
+				t.Errorf("Запрос не пропущен по истечении RetryAfter=%v", denied.RetryAfter)
+			}
+
+			// Запрос дороже емкости отклоняется без паники
+			if limiter.Take(clock.Now(), 11).Allowed {
+				t.Errorf("Запрос дороже емкости не должен быть пропущен")
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	invalid := []Policy{
+		{Capacity: 0, Rate: 1},
+		{Capacity: 1, Rate: -1},
+		{Algorithm: "leaky", Capacity: 1, Rate: 1},
+		{Algorithm: AlgorithmGCRA, Capacity: 1, Rate: 0},
+		// Окно или интервал округляются до нуля
+		{Algorithm: AlgorithmFixedWindow, Capacity: 1, Rate: 1e10},
+		{Algorithm: AlgorithmSlidingWindowLog, Capacity: 1, Rate: 1e10},
+		{Algorithm: AlgorithmSlidingWindowCounter, Capacity: 1, Rate: 1e10},
+		{Algorithm: AlgorithmGCRA, Capacity: 1, Rate: 1e10},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Политика %+v должна быть отклонена", p)
+		}
+	}
+}
+
+func TestManagerPerClientAlgorithm(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_000_000, 0)}
+	manager := newTestManager(t, 2, 1)
+	manager.clock = clock.Now
+	defer manager.Close()
+
+	if err := manager.SetClientPolicy("log", Policy{Algorithm: AlgorithmSlidingWindowLog, Capacity: 1, Rate: 1}); err != nil {
+		t.Fatalf("Ошибка установки политики: %v", err)
+	}
+
+	if _, ok := manager.GetClient("log").Limiter.(*SlidingWindowLog); !ok {
+		t.Errorf("Клиенту не назначен алгоритм из индивидуальной политики")
+	}
+	if !manager.Allow("log") || manager.Allow("log") {
+		t.Errorf("Индивидуальная политика клиента не применяется")
+	}
+	if !manager.Allow("default") || !manager.Allow("default") || manager.Allow("default") {
+		t.Errorf("Политика по умолчанию не применяется")
+	}
+
+	clock.Advance(time.Second)
+	if !manager.Allow("log") {
+		t.Errorf("Запрос после окна должен быть пропущен")
+	}
+}
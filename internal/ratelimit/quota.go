@@ -0,0 +1,402 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Периоды квот
+const (
+	QuotaDaily   = "daily"
+	QuotaMonthly = "monthly"
+)
+
+// quotaExpiryInterval - период удаления счетчиков завершившихся периодов
+const quotaExpiryInterval = time.Minute
+
+// QuotaPolicy описывает квоту на календарный период: не более Limit
+// запросов клиента между двумя границами. Граница суточной квоты наступает
+// каждый день в ResetAt после полуночи по часовому поясу Location,
+// месячной - в тот же момент дня ResetDay каждого месяца
+type QuotaPolicy struct {
+	Name     string
+	Period   string
+	Limit    int64
+	Location *time.Location // nil - UTC
+	ResetAt  time.Duration  // Смещение границы от полуночи
+	ResetDay int            // День месяца для месячной квоты, 1..28
+}
+
+// Validate проверяет корректность параметров квоты
+func (p QuotaPolicy) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("квота должна иметь имя")
+	}
+	if p.Limit <= 0 {
+		return fmt.Errorf("квота %s: лимит должен быть положительным, получено %d", p.Name, p.Limit)
+	}
+	if p.ResetAt < 0 || p.ResetAt >= 24*time.Hour {
+		return fmt.Errorf("квота %s: время сброса должно быть в пределах суток, получено %v", p.Name, p.ResetAt)
+	}
+
+	switch p.Period {
+	case QuotaDaily:
+		return nil
+	case QuotaMonthly:
+		// Дни после 28-го есть не в каждом месяце
+		if p.ResetDay < 1 || p.ResetDay > 28 {
+			return fmt.Errorf("квота %s: день сброса должен быть от 1 до 28, получено %d", p.Name, p.ResetDay)
+		}
+		return nil
+	default:
+		return fmt.Errorf("квота %s: неизвестный период %q", p.Name, p.Period)
+	}
+}
+
+// periodStart возвращает начало периода, содержащего момент now
+func (p QuotaPolicy) periodStart(now time.Time) time.Time {
+	loc := p.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	hour, minute := int(p.ResetAt/time.Hour), int(p.ResetAt%time.Hour/time.Minute)
+	sec := int(p.ResetAt % time.Minute / time.Second)
+
+	// Граница строится через time.Date, поэтому переходы на летнее
+	// время сдвигают длину периода, но не момент сброса
+	if p.Period == QuotaMonthly {
+		start := time.Date(local.Year(), local.Month(), p.ResetDay, hour, minute, sec, 0, loc)
+		if local.Before(start) {
+			start = time.Date(local.Year(), local.Month()-1, p.ResetDay, hour, minute, sec, 0, loc)
+		}
+		return start
+	}
+
+	start := time.Date(local.Year(), local.Month(), local.Day(), hour, minute, sec, 0, loc)
+	if local.Before(start) {
+		start = time.Date(local.Year(), local.Month(), local.Day()-1, hour, minute, sec, 0, loc)
+	}
+	return start
+}
+
+// nextReset возвращает конец периода, начавшегося в start
+func (p QuotaPolicy) nextReset(start time.Time) time.Time {
+	if p.Period == QuotaMonthly {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// QuotaDecision описывает результат проверки квот и состояние самой
+// исчерпанной из них
+type QuotaDecision struct {
+	Allowed   bool
+	Name      string        // Имя квоты; пусто, если квоты не настроены
+	Limit     int64         // Лимит запросов на период
+	Remaining int64         // Сколько запросов осталось до конца периода
+	Reset     time.Duration // Время до сброса счетчика
+}
+
+// quotaCounter - счетчик запросов клиента в текущем периоде
+type quotaCounter struct {
+	start time.Time
+	used  int64
+}
+
+// Quota хранит счетчики одной квоты для всех клиентов
+type Quota struct {
+	policy      QuotaPolicy
+	limits      map[string]int64 // Индивидуальные лимиты клиентов
+	counters    map[string]*quotaCounter
+	maxCounters int // Максимум счетчиков; 0 - без ограничения
+	// Начало периода, в котором таблица счетчиков заполнена
+	// израсходованными квотами; до его конца освобождать нечего
+	fullPeriod time.Time
+	rejected   int64 // Новых клиентов отклонено из-за заполненной таблицы
+	mu         sync.Mutex
+}
+
+// NewQuota создает квоту по политике
+func NewQuota(policy QuotaPolicy) (*Quota, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &Quota{
+		policy:   policy,
+		limits:   make(map[string]int64),
+		counters: make(map[string]*quotaCounter),
+	}, nil
+}
+
+// Name возвращает имя квоты
+func (q *Quota) Name() string {
+	return q.policy.Name
+}
+
+// SetClientLimit задает клиенту индивидуальный лимит квоты по договору
+func (q *Quota) SetClientLimit(id string, limit int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.limits[id] = limit
+}
+
+// limitLocked возвращает лимит клиента. Вызывается под mu
+func (q *Quota) limitLocked(id string) int64 {
+	if limit, ok := q.limits[id]; ok {
+		return limit
+	}
+	return q.policy.Limit
+}
+
+// counterLocked возвращает счетчик клиента в периоде, содержащем now,
+// сбрасывая счетчик прошедшего периода. Если таблица счетчиков заполнена
+// клиентами, уже расходовавшими квоту в этом периоде, новый счетчик
+// не создается и возвращается false: удаление такого счетчика выдало бы
+// клиенту квоту заново. Вызывается под mu
+func (q *Quota) counterLocked(id string, now time.Time) (*quotaCounter, bool) {
+	start := q.policy.periodStart(now)
+	counter, ok := q.counters[id]
+	if ok {
+		if !counter.start.Equal(start) {
+			counter.start, counter.used = start, 0
+		}
+		return counter, true
+	}
+
+	if q.maxCounters > 0 && len(q.counters) >= q.maxCounters && !q.pruneLocked(start) {
+		q.rejected++
+		return nil, false
+	}
+	counter = &quotaCounter{start: start}
+	q.counters[id] = counter
+	return counter, true
+}
+
+// pruneLocked удаляет счетчики прошедших периодов и неизрасходованные
+// счетчики. Возвращает false, если таблица по-прежнему заполнена; в этом
+// случае до конца периода повторный просмотр не выполняется. Вызывается под mu
+func (q *Quota) pruneLocked(start time.Time) bool {
+	if q.fullPeriod.Equal(start) {
+		return false
+	}
+	for id, counter := range q.counters {
+		if counter.used == 0 || counter.start.Before(start) {
+			delete(q.counters, id)
+		}
+	}
+	if len(q.counters) < q.maxCounters {
+		return true
+	}
+	q.fullPeriod = start
+	return false
+}
+
+// setMaxCounters ограничивает число счетчиков квоты; 0 - без ограничения
+func (q *Quota) setMaxCounters(maxCounters int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.maxCounters = maxCounters
+	q.fullPeriod = time.Time{}
+}
+
+// takeRejected возвращает и обнуляет число новых клиентов,
+// отклоненных из-за заполненной таблицы счетчиков
+func (q *Quota) takeRejected() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	rejected := q.rejected
+	q.rejected = 0
+	return rejected
+}
+
+// expire удаляет счетчики завершившихся периодов
+func (q *Quota) expire(now time.Time) {
+	start := q.policy.periodStart(now)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for id, counter := range q.counters {
+		if counter.start.Before(start) {
+			delete(q.counters, id)
+		}
+	}
+}
+
+// AddQuota подключает квоту к менеджеру. Вызывается до AttachStore
+// и до начала обработки запросов. Число счетчиков квоты ограничено
+// тем же max_clients, что и число клиентов: счетчики клиентов, уже
+// расходовавших квоту в текущем периоде, не вытесняются, а новые клиенты
+// сверх предела получают отказ до конца периода. Счетчики завершившихся
+// периодов удаляются раз в quotaExpiryInterval
+func (m *Manager) AddQuota(q *Quota) {
+	q.setMaxCounters(m.maxClients)
+	m.quotas = append(m.quotas, q)
+	if len(m.quotas) == 1 {
+		m.startQuotaExpiry()
+	}
+}
+
+// startQuotaExpiry запускает фоновое удаление счетчиков завершившихся
+// периодов. Не зависит от вытеснения клиентов по простою
+func (m *Manager) startQuotaExpiry() {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(quotaExpiryInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.expireQuotas(m.clock())
+				m.logQuotaRejections()
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// TakeQuota учитывает запрос клиента во всех квотах. Запрос пропускается,
+// только если ни одна квота не исчерпана; отклоненный запрос не расходует
+// ни одну из квот. Возвращает состояние квоты с наименьшим остатком
+func (m *Manager) TakeQuota(id string) QuotaDecision {
+	if len(m.quotas) == 0 {
+		return QuotaDecision{Allowed: true}
+	}
+	now := m.clock()
+
+	// Квоты блокируются в порядке подключения, поэтому взаимоблокировок нет
+	for _, q := range m.quotas {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+	}
+
+	counters := make([]*quotaCounter, len(m.quotas))
+	for i, q := range m.quotas {
+		counter, ok := q.counterLocked(id, now)
+		if !ok {
+			m.dropUnusedLocked(id, counters[:i])
+			return q.fullDecision(q.limitLocked(id), now)
+		}
+		counters[i] = counter
+		if limit := q.limitLocked(id); counter.used >= limit {
+			m.dropUnusedLocked(id, counters[:i+1])
+			return q.decision(counter, limit, now, false)
+		}
+	}
+
+	var result QuotaDecision
+	for i, q := range m.quotas {
+		counters[i].used++
+		decision := q.decision(counters[i], q.limitLocked(id), now, true)
+		if result.Name == "" || decision.Remaining < result.Remaining {
+			result = decision
+		}
+	}
+	return result
+}
+
+// dropUnusedLocked удаляет неизрасходованные счетчики клиента, созданные
+// для отклоненного запроса, чтобы они не занимали место в таблицах.
+// Вызывается под mu всех квот
+func (m *Manager) dropUnusedLocked(id string, counters []*quotaCounter) {
+	for i, counter := range counters {
+		if counter.used == 0 {
+			delete(m.quotas[i].counters, id)
+		}
+	}
+}
+
+// logQuotaRejections логирует новых клиентов, отклоненных
+// из-за заполненной таблицы счетчиков квоты
+func (m *Manager) logQuotaRejections() {
+	for _, q := range m.quotas {
+		if rejected := q.takeRejected(); rejected > 0 && m.logger != nil {
+			m.logger.Warn(fmt.Sprintf("Квота %s: таблица счетчиков заполнена (max_clients), отклонено запросов новых клиентов: %d",
+				q.policy.Name, rejected))
+		}
+	}
+}
+
+// fullDecision формирует отказ новому клиенту при заполненной таблице
+// счетчиков: место освобождается в конце периода
+func (q *Quota) fullDecision(limit int64, now time.Time) QuotaDecision {
+	return QuotaDecision{
+		Name:  q.policy.Name,
+		Limit: limit,
+		Reset: q.policy.nextReset(q.policy.periodStart(now)).Sub(now),
+	}
+}
+
+// decision формирует решение по счетчику квоты
+func (q *Quota) decision(counter *quotaCounter, limit int64, now time.Time, allowed bool) QuotaDecision {
+	return QuotaDecision{
+		Allowed:   allowed,
+		Name:      q.policy.Name,
+		Limit:     limit,
+		Remaining: max(0, limit-counter.used),
+		Reset:     q.policy.nextReset(counter.start).Sub(now),
+	}
+}
+
+// quotaRecords возвращает ненулевые счетчики текущих периодов для сохранения
+func (m *Manager) quotaRecords(now time.Time) []QuotaRecord {
+	var records []QuotaRecord
+	for _, q := range m.quotas {
+		start := q.policy.periodStart(now)
+
+		q.mu.Lock()
+		for id, counter := range q.counters {
+			if counter.used > 0 && counter.start.Equal(start) {
+				records = append(records, QuotaRecord{
+					Quota:       q.policy.Name,
+					ID:          id,
+					PeriodStart: counter.start,
+					Used:        counter.used,
+				})
+			}
+		}
+		q.mu.Unlock()
+	}
+	return records
+}
+
+// restoreQuotas загружает сохраненные счетчики. Счетчики прошедших
+// периодов и квот, удаленных из конфигурации, отбрасываются
+func (m *Manager) restoreQuotas(records []QuotaRecord, now time.Time) {
+	byName := make(map[string]*Quota, len(m.quotas))
+	for _, q := range m.quotas {
+		byName[q.policy.Name] = q
+	}
+
+	for _, record := range records {
+		q, ok := byName[record.Quota]
+		if !ok {
+			continue
+		}
+		start := q.policy.periodStart(now)
+		if !record.PeriodStart.Equal(start) {
+			continue
+		}
+
+		// Сохраненные счетчики восстанавливаются и сверх max_clients
+		q.mu.Lock()
+		q.counters[record.ID] = &quotaCounter{start: start, used: record.Used}
+		q.mu.Unlock()
+	}
+}
+
+// expireQuotas удаляет счетчики завершившихся периодов во всех квотах
+func (m *Manager) expireQuotas(now time.Time) {
+	for _, q := range m.quotas {
+		q.expire(now)
+	}
+}
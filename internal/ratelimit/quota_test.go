@@ -0,0 +1,159 @@
+package ratelimit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
+)
+
+func TestQuotaPeriodBoundaries(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skipf("Нет данных о часовых поясах: %v", err)
+	}
+
+	daily := QuotaPolicy{Name: "daily", Period: QuotaDaily, Limit: 1, Location: moscow, ResetAt: 3 * time.Hour}
+	// 23:30 UTC - это 02:30 по Москве, до сброса в 03:00: период начался вчера
+	now := time.Date(2026, 3, 10, 23, 30, 0, 0, time.UTC)
+	want := time.Date(2026, 3, 10, 3, 0, 0, 0, moscow)
+	if got := daily.periodStart(now); !got.Equal(want) {
+		t.Errorf("Начало суточного периода: ожидалось %v, получено %v", want, got)
+	}
+	if got := daily.nextReset(want); !got.Equal(want.AddDate(0, 0, 1)) {
+		t.Errorf("Неверная граница следующего периода: %v", got)
+	}
+
+	monthly := QuotaPolicy{Name: "monthly", Period: QuotaMonthly, Limit: 1, ResetDay: 15}
+	now = time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	want = time.Date(2025, 12, 15, 0, 0, 0, 0, time.UTC)
+	if got := monthly.periodStart(now); !got.Equal(want) {
+		t.Errorf("Начало месячного периода: ожидалось %v, получено %v", want, got)
+	}
+}
+
+func TestManagerQuotas(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)}
+	manager := newTestManager(t, 100, 100)
+	manager.clock = clock.Now
+	defer manager.Close()
+
+	daily, _ := NewQuota(QuotaPolicy{Name: "daily", Period: QuotaDaily, Limit: 2})
+	monthly, _ := NewQuota(QuotaPolicy{Name: "monthly", Period: QuotaMonthly, Limit: 3, ResetDay: 1})
+	manager.AddQuota(daily)
+	manager.AddQuota(monthly)
+
+	for i := 0; i < 2; i++ {
+		if !manager.TakeQuota("10.0.0.1").Allowed {
+			t.Fatalf("Запрос %d в пределах квоты отклонен", i)
+		}
+	}
+	denied := manager.TakeQuota("10.0.0.1")
+	if denied.Allowed || denied.Name != "daily" || denied.Remaining != 0 || denied.Reset != 12*time.Hour {
+		t.Fatalf("Некорректное решение для исчерпанной квоты: %+v", denied)
+	}
+
+	// Отклоненный суточной квотой запрос не расходует месячную
+	clock.Advance(12 * time.Hour)
+	decision := manager.TakeQuota("10.0.0.1")
+	if !decision.Allowed || decision.Name != "monthly" || decision.Remaining != 0 {
+		t.Errorf("После сброса суточной квоты ожидался остаток месячной 0: %+v", decision)
+	}
+	if manager.TakeQuota("10.0.0.1").Allowed {
+		t.Errorf("Запрос сверх месячной квоты должен быть отклонен")
+	}
+
+	// Индивидуальный лимит по договору
+	daily.SetClientLimit("partner", 100)
+	monthly.SetClientLimit("partner", 100)
+	if decision := manager.TakeQuota("partner"); decision.Limit != 100 || decision.Remaining != 99 {
+		t.Errorf("Индивидуальный лимит не применяется: %+v", decision)
+	}
+}
+
+func TestQuotaCountersBounded(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)}
+	manager := newTestManager(t, 100, 100)
+	manager.clock = clock.Now
+	defer manager.Close()
+	manager.StartEviction(0, 2, logger.New("error"))
+
+	daily, _ := NewQuota(QuotaPolicy{Name: "daily", Period: QuotaDaily, Limit: 2})
+	manager.AddQuota(daily)
+
+	manager.TakeQuota("a")
+	manager.TakeQuota("a")
+	if manager.TakeQuota("a").Allowed {
+		t.Fatalf("Запрос сверх квоты должен быть отклонен")
+	}
+	manager.TakeQuota("b")
+
+	// Таблица заполнена клиентами, расходовавшими квоту: новый клиент
+	// получает отказ, а счетчики прежних клиентов не сбрасываются
+	if decision := manager.TakeQuota("c"); decision.Allowed || decision.Name != "daily" || decision.Reset != 12*time.Hour {
+		t.Errorf("Новый клиент при заполненной таблице должен получить отказ до конца периода: %+v", decision)
+	}
+	if manager.TakeQuota("d").Allowed {
+		t.Errorf("Новый клиент при заполненной таблице должен получить отказ")
+	}
+	if manager.TakeQuota("a").Allowed {
+		t.Errorf("Исчерпанная квота сброшена новыми клиентами")
+	}
+	if decision := manager.TakeQuota("b"); !decision.Allowed || decision.Remaining != 0 {
+		t.Errorf("Счетчик клиента b потерян: %+v", decision)
+	}
+	if rejected := daily.takeRejected(); rejected != 2 {
+		t.Errorf("Отклонено новых клиентов %d, ожидалось 2", rejected)
+	}
+
+	// В следующем периоде счетчики прошлого освобождают место
+	clock.Advance(24 * time.Hour)
+	if !manager.TakeQuota("c").Allowed {
+		t.Errorf("В новом периоде клиент должен пройти")
+	}
+	daily.mu.Lock()
+	tracked := len(daily.counters)
+	daily.mu.Unlock()
+	if tracked != 1 {
+		t.Errorf("После смены периода осталось счетчиков: %d", tracked)
+	}
+}
+
+func TestQuotasSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clients.db")
+	clock := &fakeClock{now: time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)}
+
+	start := func() *Manager {
+		manager := newTestManager(t, 100, 100)
+		manager.clock = clock.Now
+		quota, _ := NewQuota(QuotaPolicy{Name: "daily", Period: QuotaDaily, Limit: 5})
+		manager.AddQuota(quota)
+		if err := manager.AttachStore(openTestStore(t, path), time.Hour, logger.New("error")); err != nil {
+			t.Fatalf("Ошибка подключения хранилища: %v", err)
+		}
+		return manager
+	}
+
+	manager := start()
+	for i := 0; i < 3; i++ {
+		manager.TakeQuota("10.0.0.1")
+	}
+	if err := manager.Close(); err != nil {
+		t.Fatalf("Ошибка закрытия менеджера: %v", err)
+	}
+
+	manager = start()
+	if decision := manager.TakeQuota("10.0.0.1"); decision.Remaining != 1 {
+		t.Errorf("После перезапуска ожидался остаток 1, получено %+v", decision)
+	}
+	_ = manager.Close()
+
+	// Счетчик прошедшего периода не восстанавливается
+	clock.Advance(24 * time.Hour)
+	manager = start()
+	defer manager.Close()
+	if decision := manager.TakeQuota("10.0.0.1"); decision.Remaining != 4 {
+		t.Errorf("В новом периоде ожидался остаток 4, получено %+v", decision)
+	}
+}
@@ -1,98 +1,327 @@
 package ratelimit
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/Roman-Samoilenko/http-load-balancer/pkg/logger"
 )
 
-// NewTokenBucket создает новый экземпляр TokenBucket
-func NewTokenBucket(capacity int, rate float64) *TokenBucket {
-	return &TokenBucket{
-		capacity:   capacity,
-		tokens:     float64(capacity),
-		rate:       rate,
-		lastRefill: time.Now(),
+// Manager управляет клиентами и их rate limits.
+// Клиенты распределены по шардам, каждый со своей блокировкой
+type Manager struct {
+	shards [shardCount]*shard
+	policy Policy           // Политика по умолчанию для новых клиентов
+	clock  func() time.Time // Источник времени; подменяется в тестах
+
+	created atomic.Uint64
+	evicted atomic.Uint64
+
+	store       Store
+	distributed *Distributed // Общий бакет для всех реплик; nil - только локально
+	quotas      []*Quota     // Календарные квоты, проверяемые вместе с лимитом
+	bans        *Banlist     // Блокировка клиентов, часто получающих отказ; nil - без блокировок
+
+	shadow    atomic.Bool    // Теневой режим: отказы учитываются, но запросы пропускаются
+	offenders *offenderStats // Отказы теневого режима по клиентам
+
+	maxClients   int           // Максимум клиентов и счетчиков каждой квоты; 0 - без ограничения
+	maxInFlight  int           // Максимум одновременных запросов клиента; 0 - без ограничения
+	queueTimeout time.Duration // Максимальное ожидание свободного слота
+	logger       *logger.Logger
+	stopCh       chan struct{}
+	stop         sync.Once
+	wg           sync.WaitGroup
+}
+
+// NewManager создает новый экземпляр Manager с политикой по умолчанию
+func NewManager(policy Policy) (*Manager, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		policy:    policy,
+		clock:     time.Now,
+		offenders: newOffenderStats(defaultShadowWindow),
+		stopCh:    make(chan struct{}),
 	}
+	for i := range m.shards {
+		m.shards[i] = newShard(m)
+	}
+	return m, nil
 }
 
-// Allow проверяет и берет токен, если доступен
-func (tb *TokenBucket) Allow() bool {
-	tb.mu.Lock()
-	defer tb.mu.Unlock()
+// shardFor возвращает шард, в котором хранится клиент
+func (m *Manager) shardFor(id string) *shard {
+	return m.shards[shardIndex(id)]
+}
 
-	now := time.Now()
-	tb.refill(now)
+// GetClient возвращает клиента по ID (IP или API-ключ).
+// Возвращенный клиент может быть вытеснен при простое, поэтому для
+// проверки лимита следует использовать Allow
+func (m *Manager) GetClient(id string) *Client {
+	s := m.shardFor(id)
 
-	if tb.tokens >= 1 {
-		tb.tokens--
-		return true
+	s.mu.RLock()
+	client, exists := s.clients[id]
+	s.mu.RUnlock()
+
+	if exists {
+		return client
 	}
 
-	return false
+	// Если клиент не существует, создаем нового
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.getOrCreateLocked(id)
 }
 
-// refill пополняет токены в бакете
-func (tb *TokenBucket) refill(now time.Time) {
-	delta := now.Sub(tb.lastRefill).Seconds() // время, прошедшее с последнего пополнения
-	tb.lastRefill = now                       // обновляет время последнего пополнения
+// SetDistributed подключает общий для реплик бэкенд. Вызывается до начала
+// обработки запросов; действует на клиентов с алгоритмом Token Bucket
+func (m *Manager) SetDistributed(d *Distributed) {
+	m.distributed = d
+}
 
-	// Вычисляем, сколько токенов нужно добавить
-	newTokens := delta * tb.rate
+// newClient создает клиента с лимитером по проверенной политике
+func (m *Manager) newClient(id string, policy Policy) *Client {
+	now := m.clock()
 
-	// Обновляем количество токенов, не превышая емкость
-	if newTokens > 0 {
-		tb.tokens = min(float64(tb.capacity), tb.tokens+newTokens)
+	limiter := policy.newLimiter(now)
+	if m.distributed != nil && policy.algorithm() == AlgorithmTokenBucket {
+		limiter = &distributedLimiter{
+			backend:  m.distributed,
+			id:       id,
+			capacity: policy.Capacity,
+			rate:     policy.Rate,
+			local:    limiter,
+		}
 	}
+
+	client := &Client{
+		ID:        id,
+		Limiter:   limiter,
+		Algorithm: policy.algorithm(),
+		Capacity:  policy.Capacity,
+		Rate:      policy.Rate,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if m.maxInFlight > 0 {
+		client.slots = make(chan struct{}, m.maxInFlight)
+	}
+	return client
 }
 
-// Manager управляет клиентами и их rate limits
-type Manager struct {
-	clients     map[string]*Client
-	defaultCap  int
-	defaultRate float64
-	mu          sync.RWMutex
+// Allow проверяет разрешение запроса для клиента
+func (m *Manager) Allow(id string) bool {
+	return m.Take(id).Allowed
+}
+
+// Take проверяет запрос клиента и возвращает состояние его лимита
+func (m *Manager) Take(id string) Decision {
+	return m.TakeN(id, 1)
 }
 
-// NewManager создает новый экземпляр Manager
-func NewManager(defaultCap int, defaultRate float64) *Manager {
-	return &Manager{
-		clients:     make(map[string]*Client),
-		defaultCap:  defaultCap,
-		defaultRate: defaultRate,
+// TakeN проверяет запрос клиента стоимостью cost токенов.
+// Проверка выполняется под блокировкой шарда, поэтому вытеснение
+// не может удалить клиента во время списания токенов
+func (m *Manager) TakeN(id string, cost int) Decision {
+	s := m.shardFor(id)
+	now := m.clock()
+
+	var decision Decision
+	s.mu.RLock()
+	if client, exists := s.clients[id]; exists {
+		s.touch(client, now)
+		decision = client.Limiter.Take(now, cost)
+		s.mu.RUnlock()
+	} else {
+		s.mu.RUnlock()
+
+		s.mu.Lock()
+		client := s.getOrCreateLocked(id)
+		s.touch(client, now)
+		decision = client.Limiter.Take(now, cost)
+		s.mu.Unlock()
 	}
+
+	decision = m.applyShadow(id, decision, now)
+	if !decision.Allowed && m.bans != nil {
+		m.bans.Reject(id)
+	}
+	return decision
 }
 
-// GetClient возвращает клиента по ID (IP или API-ключ)
-func (m *Manager) GetClient(id string) *Client {
-	m.mu.RLock()
-	client, exists := m.clients[id]
-	m.mu.RUnlock()
+// SetClientPolicy устанавливает индивидуальную политику клиента
+// и сохраняет ее в хранилище, если оно подключено
+func (m *Manager) SetClientPolicy(id string, policy Policy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
 
-	if exists {
-		return client
+	s := m.shardFor(id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client := m.newClient(id, policy)
+	client.Override = true
+	if old, exists := s.clients[id]; exists {
+		client.CreatedAt = old.CreatedAt
 	}
 
-	// Если клиент не существует, создаем нового
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	if m.store != nil {
+		err := m.store.SaveClient(ClientRecord{
+			ID:        id,
+			Algorithm: client.Algorithm,
+			Capacity:  client.Capacity,
+			Rate:      client.Rate,
+			CreatedAt: client.CreatedAt,
+			UpdatedAt: client.UpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
 
-	// Повторная проверка после получения эксклюзивной блокировки
-	if client, exists = m.clients[id]; exists {
-		return client
+	s.addClientLocked(client)
+	return nil
+}
+
+// ResetClientPolicy возвращает клиенту политику по умолчанию
+func (m *Manager) ResetClientPolicy(id string) error {
+	s := m.shardFor(id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m.store != nil {
+		if err := m.store.DeleteClient(id); err != nil {
+			return err
+		}
+	}
+
+	if client, exists := s.clients[id]; exists {
+		s.removeClientLocked(client)
 	}
+	return nil
+}
 
-	// Создание нового клиента
-	client = &Client{
-		ID:     id,
-		Bucket: NewTokenBucket(m.defaultCap, m.defaultRate),
+// AttachStore подключает постоянное хранилище: загружает переопределения
+// лимитов и последний снимок бакетов, после чего периодически сохраняет
+// уровень токенов, чтобы перезапуск не выдавал клиентам полный бакет
+func (m *Manager) AttachStore(store Store, snapshotInterval time.Duration, log *logger.Logger) error {
+	records, err := store.Clients()
+	if err != nil {
+		return err
+	}
+	snapshots, err := store.Snapshots()
+	if err != nil {
+		return err
+	}
+	quotas, err := store.Quotas()
+	if err != nil {
+		return err
 	}
-	m.clients[id] = client
 
-	return client
+	for _, record := range records {
+		policy := Policy{Algorithm: record.Algorithm, Capacity: record.Capacity, Rate: record.Rate}
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("клиент %s: %w", record.ID, err)
+		}
+
+		client := m.newClient(record.ID, policy)
+		client.Override = true
+		client.CreatedAt = record.CreatedAt
+		client.UpdatedAt = record.UpdatedAt
+
+		s := m.shardFor(record.ID)
+		s.mu.Lock()
+		s.addClientLocked(client)
+		s.mu.Unlock()
+	}
+	for _, snapshot := range snapshots {
+		if tb, ok := m.GetClient(snapshot.ID).Limiter.(*TokenBucket); ok {
+			tb.restore(snapshot.Tokens, snapshot.TakenAt)
+		}
+	}
+	m.restoreQuotas(quotas, m.clock())
+	m.store = store
+	m.logger = log
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(snapshotInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.saveSnapshots(); err != nil {
+					m.logger.Error("Ошибка сохранения снимка rate limit:", err)
+				}
+			case <-m.stopCh:
+				return
+			}
+		}
+	}()
+
+	return nil
 }
 
-// Allow проверяет разрешение запроса для клиента
-func (m *Manager) Allow(id string) bool {
-	client := m.GetClient(id)
-	return client.Bucket.Allow()
+// saveSnapshots сохраняет уровень токенов всех клиентов с неполным бакетом
+// и счетчики квот. Полный бакет эквивалентен новому, поэтому такие клиенты
+// не сохраняются
+func (m *Manager) saveSnapshots() error {
+	now := m.clock()
+
+	var snapshots []BucketSnapshot
+	for _, s := range m.shards {
+		s.mu.RLock()
+		for id, client := range s.clients {
+			tb, ok := client.Limiter.(*TokenBucket)
+			if !ok {
+				continue
+			}
+			if tokens := tb.snapshot(now); tokens < float64(client.Capacity) {
+				snapshots = append(snapshots, BucketSnapshot{ID: id, Tokens: tokens, TakenAt: now})
+			}
+		}
+		s.mu.RUnlock()
+	}
+
+	if err := m.store.SaveSnapshots(snapshots); err != nil {
+		return err
+	}
+	if len(m.quotas) == 0 {
+		return nil
+	}
+	m.expireQuotas(now)
+	return m.store.SaveQuotas(m.quotaRecords(now))
+}
+
+// Close останавливает фоновые задачи, сохраняет финальный снимок
+// и закрывает хранилище
+func (m *Manager) Close() error {
+	m.stop.Do(func() { close(m.stopCh) })
+	m.wg.Wait()
+
+	if m.distributed != nil {
+		_ = m.distributed.Close()
+	}
+	if m.store == nil {
+		return nil
+	}
+
+	err := m.saveSnapshots()
+	if closeErr := m.store.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// shadowSlots - число интервалов, на которые делится окно статистики
+	shadowSlots = 10
+	// defaultShadowWindow - окно статистики теневого режима по умолчанию
+	defaultShadowWindow = 10 * time.Minute
+)
+
+// Offender - клиент и число его запросов, которые были бы отклонены
+type Offender struct {
+	ID         string `json:"id"`
+	Rejections uint64 `json:"rejections"`
+}
+
+// ShadowReport - сводка теневого режима за окно статистики
+type ShadowReport struct {
+	Enabled    bool          `json:"enabled"`
+	Window     time.Duration `json:"-"`
+	Rejections uint64        `json:"rejections"` // Всего запросов, которые были бы отклонены
+	Clients    int           `json:"clients"`    // Сколько клиентов было бы затронуто
+	Top        []Offender    `json:"top"`
+}
+
+// offenderSlot хранит счетчики отказов за один интервал окна
+type offenderSlot struct {
+	start  int64 // Начало интервала, UnixNano
+	counts map[string]uint64
+}
+
+// offenderStats считает отказы клиентов в скользящем окне, разбитом
+// на shadowSlots интервалов; устаревший интервал переиспользуется
+type offenderStats struct {
+	slot  time.Duration
+	slots [shadowSlots]offenderSlot
+	mu    sync.Mutex
+}
+
+func newOffenderStats(window time.Duration) *offenderStats {
+	return &offenderStats{slot: max(time.Second, window/shadowSlots)}
+}
+
+// record учитывает отказ клиента в момент now
+func (st *offenderStats) record(id string, now time.Time) {
+	ts := now.UnixNano()
+	start := ts - ts%int64(st.slot)
+	slot := &st.slots[(start/int64(st.slot))%shadowSlots]
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if slot.start != start || slot.counts == nil {
+		slot.start = start
+		slot.counts = make(map[string]uint64)
+	}
+	slot.counts[id]++
+}
+
+// top суммирует отказы за окно, заканчивающееся в now, и возвращает
+// общее число отказов, число клиентов и limit клиентов с наибольшим числом отказов
+func (st *offenderStats) top(now time.Time, limit int) (uint64, int, []Offender) {
+	oldest := now.UnixNano() - int64(st.slot)*shadowSlots
+
+	totals := make(map[string]uint64)
+	var rejections uint64
+
+	st.mu.Lock()
+	for i := range st.slots {
+		slot := &st.slots[i]
+		if slot.start <= oldest {
+			continue
+		}
+		for id, count := range slot.counts {
+			totals[id] += count
+			rejections += count
+		}
+	}
+	st.mu.Unlock()
+
+	offenders := make([]Offender, 0, len(totals))
+	for id, count := range totals {
+		offenders = append(offenders, Offender{ID: id, Rejections: count})
+	}
+	sort.Slice(offenders, func(i, j int) bool {
+		if offenders[i].Rejections != offenders[j].Rejections {
+			return offenders[i].Rejections > offenders[j].Rejections
+		}
+		return offenders[i].ID < offenders[j].ID
+	})
+	if limit > 0 && len(offenders) > limit {
+		offenders = offenders[:limit]
+	}
+	return rejections, len(totals), offenders
+}
+
+// SetShadow включает или выключает теневой режим: запросы сверх лимита
+// пропускаются, а отказы только учитываются. Безопасно вызывать во время
+// обработки запросов
+func (m *Manager) SetShadow(enabled bool) {
+	m.shadow.Store(enabled)
+}
+
+// Shadow сообщает, включен ли теневой режим
+func (m *Manager) Shadow() bool {
+	return m.shadow.Load()
+}
+
+// SetShadowWindow задает окно статистики теневого режима.
+// Вызывается до начала обработки запросов
+func (m *Manager) SetShadowWindow(window time.Duration) {
+	m.offenders = newOffenderStats(window)
+}
+
+// ShadowReport возвращает сводку теневого режима с limit клиентами,
+// которые чаще всего превышали бы лимит
+func (m *Manager) ShadowReport(limit int) ShadowReport {
+	rejections, clients, top := m.offenders.top(m.clock(), limit)
+	return ShadowReport{
+		Enabled:    m.Shadow(),
+		Window:     m.offenders.slot * shadowSlots,
+		Rejections: rejections,
+		Clients:    clients,
+		Top:        top,
+	}
+}
+
+// applyShadow в теневом режиме учитывает отказ и пропускает запрос
+func (m *Manager) applyShadow(id string, decision Decision, now time.Time) Decision {
+	if decision.Allowed || !m.shadow.Load() {
+		return decision
+	}
+	m.offenders.record(id, now)
+	decision.Allowed = true
+	decision.Shadowed = true
+	decision.RetryAfter = 0
+	return decision
+}
@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShadowModeCountsWouldBeRejections(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1_000_000, 0)}
+	manager := newTestManager(t, 1, 0.001)
+	manager.clock = clock.Now
+	manager.SetShadowWindow(time.Minute)
+	defer manager.Close()
+
+	manager.SetShadow(true)
+	for i := 0; i < 4; i++ {
+		decision := manager.Take("10.0.0.1")
+		if !decision.Allowed {
+			t.Fatalf("Теневой режим не должен отклонять запросы")
+		}
+		if shadowed := i > 0; decision.Shadowed != shadowed {
+			t.Errorf("Запрос %d: Shadowed=%v, ожидалось %v", i, decision.Shadowed, shadowed)
+		}
+	}
+	manager.Take("10.0.0.2")
+	manager.Take("10.0.0.2")
+
+	report := manager.ShadowReport(1)
+	if !report.Enabled || report.Rejections != 4 || report.Clients != 2 || report.Window != time.Minute {
+		t.Errorf("Некорректная сводка: %+v", report)
+	}
+	if len(report.Top) != 1 || report.Top[0] != (Offender{ID: "10.0.0.1", Rejections: 3}) {
+		t.Errorf("Неверный список нарушителей: %+v", report.Top)
+	}
+
+	// Отказы за пределами окна не учитываются
+	clock.Advance(time.Minute)
+	if report := manager.ShadowReport(10); report.Rejections != 0 {
+		t.Errorf("Отказы вне окна остались в сводке: %+v", report)
+	}
+
+	manager.SetShadow(false)
+	if manager.Allow("10.0.0.1") {
+		t.Errorf("После выключения теневого режима лимит должен применяться")
+	}
+}
@@ -0,0 +1,144 @@
+package ratelimit
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// shardCount - число шардов менеджера; степень двойки для быстрого выбора шарда
+const shardCount = 64
+
+// shard хранит часть клиентов менеджера под собственной блокировкой,
+// чтобы обращения разных клиентов не конкурировали за один мьютекс
+type shard struct {
+	clients    map[string]*Client
+	mu         sync.RWMutex
+	lru        *list.List // Клиенты в порядке последнего обращения, первый - самый свежий
+	lruMu      sync.Mutex // Защищает порядок lru при чтении под mu.RLock
+	maxClients int        // Максимум клиентов в шарде; 0 - без ограничения
+	manager    *Manager
+}
+
+func newShard(m *Manager) *shard {
+	return &shard{
+		clients: make(map[string]*Client),
+		lru:     list.New(),
+		manager: m,
+	}
+}
+
+// shardIndex выбирает шард по хешу FNV-1a идентификатора клиента
+func shardIndex(id string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		hash ^= uint32(id[i])
+		hash *= 16777619
+	}
+	return hash & (shardCount - 1)
+}
+
+// getOrCreateLocked возвращает клиента, создавая его со стандартными
+// лимитами при отсутствии. Вызывается под эксклюзивной блокировкой mu
+func (s *shard) getOrCreateLocked(id string) *Client {
+	// Повторная проверка после получения эксклюзивной блокировки
+	if client, exists := s.clients[id]; exists {
+		return client
+	}
+
+	// Создание нового клиента
+	client := s.manager.newClient(id, s.manager.policy)
+	s.addClientLocked(client)
+
+	return client
+}
+
+// addClientLocked добавляет (или заменяет) клиента и при превышении
+// maxClients вытесняет давно не обращавшихся. Вызывается под mu.Lock
+func (s *shard) addClientLocked(client *Client) {
+	if old, exists := s.clients[client.ID]; exists {
+		s.lru.Remove(old.element)
+		// Запросы в работе освободят слоты нового объекта клиента
+		client.slots = old.slots
+	} else {
+		s.manager.created.Add(1)
+	}
+
+	client.lastSeen.Store(s.manager.clock().UnixNano())
+	client.element = s.lru.PushFront(client)
+	s.clients[client.ID] = client
+
+	if s.maxClients > 0 && len(s.clients) > s.maxClients {
+		s.evictOverflowLocked()
+	}
+}
+
+// removeClientLocked удаляет клиента из шарда. Вызывается под mu.Lock
+func (s *shard) removeClientLocked(client *Client) {
+	s.lru.Remove(client.element)
+	delete(s.clients, client.ID)
+}
+
+// touchGranularity - минимальный интервал между перемещениями клиента
+// в начало списка LRU; частые обращения не захватывают lruMu
+const touchGranularity = 100 * time.Millisecond
+
+// touch отмечает обращение клиента в момент now и переносит его
+// в начало списка LRU
+func (s *shard) touch(client *Client, now time.Time) {
+	at := now.UnixNano()
+	if at-client.lastSeen.Load() < int64(touchGranularity) {
+		return
+	}
+	client.lastSeen.Store(at)
+
+	s.lruMu.Lock()
+	s.lru.MoveToFront(client.element)
+	s.lruMu.Unlock()
+}
+
+// evictIdle удаляет клиентов, не обращавшихся дольше ttl, если их лимитер
+// вернулся в исходное состояние. Возвращает число вытесненных клиентов
+func (s *shard) evictIdle(now time.Time, ttl time.Duration) int {
+	deadline := now.Add(-ttl).UnixNano()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evicted := 0
+	// Идем с конца списка LRU, пока клиенты достаточно давние
+	for e := s.lru.Back(); e != nil; {
+		client := e.Value.(*Client)
+		e = e.Prev()
+
+		if client.lastSeen.Load() > deadline {
+			break
+		}
+		if client.Override || client.inFlight() > 0 || !client.Limiter.Idle(now) {
+			continue
+		}
+
+		s.removeClientLocked(client)
+		evicted++
+	}
+
+	s.manager.evicted.Add(uint64(evicted))
+	return evicted
+}
+
+// evictOverflowLocked вытесняет наименее недавно использованных клиентов,
+// пока их число превышает maxClients. Самый свежий клиент (только что
+// добавленный) не вытесняется. Вызывается под mu.Lock
+func (s *shard) evictOverflowLocked() {
+	for e := s.lru.Back(); e != nil && e != s.lru.Front() && len(s.clients) > s.maxClients; {
+		client := e.Value.(*Client)
+		e = e.Prev()
+
+		if client.Override || client.inFlight() > 0 {
+			continue
+		}
+
+		s.removeClientLocked(client)
+		s.manager.evicted.Add(1)
+	}
+}
@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+// ClientRecord описывает индивидуальные настройки клиента,
+// которые переопределяют стандартные лимиты
+type ClientRecord struct {
+	ID        string    `json:"id"`
+	Algorithm string    `json:"algorithm,omitempty"`
+	Capacity  int       `json:"capacity"`
+	Rate      float64   `json:"rate"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BucketSnapshot хранит уровень токенов клиента на момент снимка.
+// Снимки сохраняются только для алгоритма Token Bucket
+type BucketSnapshot struct {
+	ID      string    `json:"id"`
+	Tokens  float64   `json:"tokens"`
+	TakenAt time.Time `json:"taken_at"`
+}
+
+// QuotaRecord хранит счетчик квоты клиента в текущем периоде
+type QuotaRecord struct {
+	Quota       string    `json:"quota"`
+	ID          string    `json:"id"`
+	PeriodStart time.Time `json:"period_start"`
+	Used        int64     `json:"used"`
+}
+
+// Store интерфейс постоянного хранилища состояний клиентов
+type Store interface {
+	// Clients возвращает все сохраненные переопределения лимитов
+	Clients() ([]ClientRecord, error)
+	// SaveClient создает или обновляет переопределение лимитов клиента
+	SaveClient(record ClientRecord) error
+	// DeleteClient удаляет переопределение лимитов клиента
+	DeleteClient(id string) error
+	// Snapshots возвращает последний сохраненный снимок бакетов
+	Snapshots() ([]BucketSnapshot, error)
+	// SaveSnapshots атомарно заменяет снимок бакетов новым
+	SaveSnapshots(snapshots []BucketSnapshot) error
+	// Quotas возвращает сохраненные счетчики квот
+	Quotas() ([]QuotaRecord, error)
+	// SaveQuotas атомарно заменяет счетчики квот новыми
+	SaveQuotas(records []QuotaRecord) error
+	// Bans возвращает сохраненные блокировки клиентов
+	Bans() ([]Ban, error)
+	// SaveBan создает или обновляет блокировку клиента
+	SaveBan(ban Ban) error
+	// DeleteBan удаляет блокировку клиента
+	DeleteBan(id string) error
+	// Close закрывает хранилище
+	Close() error
+}
@@ -0,0 +1,225 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// FixedWindow пропускает не более limit запросов в каждом окне фиксированной
+// длины. Окна выровнены по Unix-времени; на стыке двух окон возможен
+// всплеск до 2*limit запросов
+type FixedWindow struct {
+	limit  int
+	window time.Duration
+	start  int64 // Начало текущего окна, UnixNano
+	count  int
+	mu     sync.Mutex
+}
+
+func newFixedWindow(limit int, window time.Duration) *FixedWindow {
+	return &FixedWindow{limit: limit, window: window}
+}
+
+// Take проверяет и учитывает запрос стоимостью cost в момент now
+func (fw *FixedWindow) Take(now time.Time, cost int) Decision {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	start := alignWindow(now, fw.window)
+	if start != fw.start {
+		fw.start = start
+		fw.count = 0
+	}
+
+	decision := Decision{
+		Limit:  fw.limit,
+		Reset:  time.Duration(start + int64(fw.window) - now.UnixNano()),
+		Window: fw.window,
+	}
+	if fw.count+cost <= fw.limit {
+		fw.count += cost
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = decision.Reset
+	}
+	decision.Remaining = fw.limit - fw.count
+	return decision
+}
+
+// Idle сообщает, что окно с запросами клиента уже закончилось
+func (fw *FixedWindow) Idle(now time.Time) bool {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	return fw.count == 0 || alignWindow(now, fw.window) != fw.start
+}
+
+// alignWindow возвращает начало окна, содержащего момент now
+func alignWindow(now time.Time, window time.Duration) int64 {
+	ts := now.UnixNano()
+	return ts - ts%int64(window)
+}
+
+// SlidingWindowLog хранит время каждого пропущенного запроса и пропускает
+// не более limit запросов в любом интервале длиной window
+type SlidingWindowLog struct {
+	limit  int
+	window time.Duration
+	log    []int64 // Кольцевой буфер моментов пропущенных запросов, UnixNano
+	head   int     // Индекс самой старой записи
+	size   int
+	mu     sync.Mutex
+}
+
+func newSlidingWindowLog(limit int, window time.Duration) *SlidingWindowLog {
+	return &SlidingWindowLog{limit: limit, window: window}
+}
+
+// Take проверяет и учитывает запрос стоимостью cost в момент now;
+// запрос занимает cost записей журнала
+func (sl *SlidingWindowLog) Take(now time.Time, cost int) Decision {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	ts := now.UnixNano()
+	sl.expire(ts)
+
+	decision := Decision{Limit: sl.limit, Window: sl.window}
+	switch {
+	case sl.size+cost <= sl.limit:
+		// Буфер выделяется лениво, чтобы неактивные клиенты не занимали память
+		if sl.log == nil {
+			sl.log = make([]int64, sl.limit)
+		}
+		for i := 0; i < cost; i++ {
+			sl.log[(sl.head+sl.size)%sl.limit] = ts
+			sl.size++
+		}
+		decision.Allowed = true
+	case cost > sl.limit:
+		// Запрос дороже всего окна не будет пропущен никогда
+		decision.RetryAfter = sl.window
+	default:
+		// Место освободится, когда из окна выйдут самые старые записи
+		oldest := sl.log[(sl.head+sl.size+cost-sl.limit-1)%sl.limit]
+		decision.RetryAfter = time.Duration(oldest + int64(sl.window) - ts)
+	}
+
+	decision.Remaining = sl.limit - sl.size
+	if sl.size > 0 {
+		newest := sl.log[(sl.head+sl.size-1)%sl.limit]
+		decision.Reset = time.Duration(newest + int64(sl.window) - ts)
+	}
+	return decision
+}
+
+// Idle сообщает, что в журнале не осталось запросов внутри окна
+func (sl *SlidingWindowLog) Idle(now time.Time) bool {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	sl.expire(now.UnixNano())
+	return sl.size == 0
+}
+
+// expire удаляет записи, вышедшие за пределы окна
+func (sl *SlidingWindowLog) expire(ts int64) {
+	for sl.size > 0 && ts-sl.log[sl.head] >= int64(sl.window) {
+		sl.head = (sl.head + 1) % sl.limit
+		sl.size--
+	}
+}
+
+// SlidingWindowCounter приближает скользящее окно двумя соседними
+// фиксированными окнами: счетчик предыдущего окна учитывается с весом,
+// равным доле его перекрытия со скользящим окном
+type SlidingWindowCounter struct {
+	limit    int
+	window   time.Duration
+	start    int64 // Начало текущего окна, UnixNano
+	current  int
+	previous int
+	mu       sync.Mutex
+}
+
+func newSlidingWindowCounter(limit int, window time.Duration) *SlidingWindowCounter {
+	return &SlidingWindowCounter{limit: limit, window: window}
+}
+
+// Take проверяет и учитывает запрос стоимостью cost в момент now
+func (sc *SlidingWindowCounter) Take(now time.Time, cost int) Decision {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	ts := now.UnixNano()
+	sc.advance(ts)
+
+	decision := Decision{Limit: sc.limit, Window: sc.window}
+	if sc.estimate(ts)+float64(cost) > float64(sc.limit) {
+		decision.RetryAfter = sc.retryAfter(ts, cost)
+	} else {
+		sc.current += cost
+		decision.Allowed = true
+	}
+
+	decision.Remaining = max(0, int(float64(sc.limit)-sc.estimate(ts)))
+	// Счетчики обнулятся, когда текущее окно станет предыдущим и уйдет из оценки
+	end := sc.start + int64(sc.window)
+	if sc.current > 0 {
+		end += int64(sc.window)
+	}
+	decision.Reset = time.Duration(end - ts)
+	return decision
+}
+
+// retryAfter вычисляет время, через которое оценка опустится достаточно,
+// чтобы пропустить запрос стоимостью cost
+func (sc *SlidingWindowCounter) retryAfter(ts int64, cost int) time.Duration {
+	if cost > sc.limit {
+		// Запрос дороже всего окна не будет пропущен никогда
+		return sc.window
+	}
+	room := float64(sc.limit - cost)
+	window := float64(sc.window)
+
+	// Внутри текущего окна вес предыдущего убывает линейно
+	if float64(sc.current) <= room && sc.previous > 0 {
+		elapsed := 1 - (room-float64(sc.current))/float64(sc.previous)
+		return time.Duration(math.Ceil(float64(sc.start) + elapsed*window - float64(ts)))
+	}
+
+	// Иначе ждем следующего окна, где текущий счетчик станет предыдущим
+	next := sc.start + int64(sc.window)
+	elapsed := max(0, 1-room/float64(sc.current))
+	return time.Duration(math.Ceil(float64(next) + elapsed*window - float64(ts)))
+}
+
+// Idle сообщает, что оба окна со счетчиками уже закончились
+func (sc *SlidingWindowCounter) Idle(now time.Time) bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.advance(now.UnixNano())
+	return sc.current == 0 && sc.previous == 0
+}
+
+// advance переключает окна, если момент ts лежит за пределами текущего
+func (sc *SlidingWindowCounter) advance(ts int64) {
+	start := ts - ts%int64(sc.window)
+	switch {
+	case start == sc.start:
+	case start-sc.start == int64(sc.window):
+		sc.previous, sc.current = sc.current, 0
+		sc.start = start
+	default:
+		sc.previous, sc.current = 0, 0
+		sc.start = start
+	}
+}
+
+// estimate оценивает число запросов в скользящем окне, заканчивающемся в ts
+func (sc *SlidingWindowCounter) estimate(ts int64) float64 {
+	elapsed := float64(ts-sc.start) / float64(sc.window)
+	return float64(sc.previous)*(1-elapsed) + float64(sc.current)
+}
@@ -0,0 +1,233 @@
+package redis
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error - ошибка, возвращенная сервером (ответ RESP с префиксом '-')
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// ErrNil возвращается, когда сервер ответил пустым значением
+var ErrNil = errors.New("redis: nil")
+
+// Options содержит параметры подключения к серверу
+type Options struct {
+	Addr     string
+	Password string
+	DB       int
+	Timeout  time.Duration // Таймаут установки соединения и одной команды
+	PoolSize int           // Максимум простаивающих соединений в пуле
+}
+
+// Client - минимальный клиент протокола RESP с пулом соединений.
+// Безопасен для конкурентного использования
+type Client struct {
+	opts Options
+	pool chan *conn
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// NewClient создает клиента; соединения устанавливаются при первом запросе
+func NewClient(opts Options) *Client {
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 16
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+	return &Client{
+		opts: opts,
+		pool: make(chan *conn, opts.PoolSize),
+	}
+}
+
+// Do выполняет команду и возвращает ответ: string, int64, []interface{} или nil
+func (c *Client) Do(args ...string) (interface{}, error) {
+	cn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := cn.do(c.opts.Timeout, args...)
+	var serverErr Error
+	if err != nil && !errors.As(err, &serverErr) && !errors.Is(err, ErrNil) {
+		// Сетевая ошибка или нарушение протокола: соединение непригодно
+		_ = cn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// Eval выполняет Lua-скрипт через EVALSHA, загружая его через EVAL,
+// если сервер еще не знает скрипт
+func (c *Client) Eval(script *Script, keys []string, args ...string) (interface{}, error) {
+	cmd := make([]string, 0, 3+len(keys)+len(args))
+	cmd = append(cmd, "EVALSHA", script.sha, strconv.Itoa(len(keys)))
+	cmd = append(cmd, keys...)
+	cmd = append(cmd, args...)
+
+	reply, err := c.Do(cmd...)
+	var serverErr Error
+	if errors.As(err, &serverErr) && strings.HasPrefix(string(serverErr), "NOSCRIPT") {
+		cmd[0], cmd[1] = "EVAL", script.src
+		return c.Do(cmd...)
+	}
+	return reply, err
+}
+
+// Close закрывает все простаивающие соединения
+func (c *Client) Close() error {
+	for {
+		select {
+		case cn := <-c.pool:
+			_ = cn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// get берет соединение из пула или устанавливает новое
+func (c *Client) get() (*conn, error) {
+	select {
+	case cn := <-c.pool:
+		return cn, nil
+	default:
+	}
+
+	nc, err := net.DialTimeout("tcp", c.opts.Addr, c.opts.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	if c.opts.Password != "" {
+		if _, err := cn.do(c.opts.Timeout, "AUTH", c.opts.Password); err != nil {
+			_ = cn.Close()
+			return nil, err
+		}
+	}
+	if c.opts.DB != 0 {
+		if _, err := cn.do(c.opts.Timeout, "SELECT", strconv.Itoa(c.opts.DB)); err != nil {
+			_ = cn.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// put возвращает соединение в пул или закрывает его, если пул заполнен
+func (c *Client) put(cn *conn) {
+	select {
+	case c.pool <- cn:
+	default:
+		_ = cn.Close()
+	}
+}
+
+// do отправляет команду и читает ответ на одном соединении
+func (cn *conn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	if err := cn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(cn.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	return cn.read()
+}
+
+// read разбирает один ответ RESP2
+func (cn *conn) read() (interface{}, error) {
+	line, err := cn.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: некорректный ответ %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, Error(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, ErrNil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(cn.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, ErrNil
+		}
+		items := make([]interface{}, size)
+		for i := range items {
+			item, err := cn.read()
+			var serverErr Error
+			switch {
+			case errors.As(err, &serverErr):
+				// Ошибка внутри массива - это значение, а не сбой соединения
+				items[i] = serverErr
+			case errors.Is(err, ErrNil):
+				items[i] = nil
+			case err != nil:
+				return nil, err
+			default:
+				items[i] = item
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: неизвестный тип ответа %q", kind)
+	}
+}
+
+// Script - Lua-скрипт с заранее вычисленным SHA1 для EVALSHA
+type Script struct {
+	src string
+	sha string
+}
+
+// NewScript подготавливает скрипт к выполнению
+func NewScript(src string) *Script {
+	sum := sha1.Sum([]byte(src))
+	return &Script{src: src, sha: hex.EncodeToString(sum[:])}
+}